@@ -3,9 +3,9 @@ package main
 import (
 	"encoding/json"
 	"strings"
+	"time"
 
 	"github.com/maxence-charriere/go-app/v10/pkg/app"
-	shell "github.com/stateless-minds/go-ipfs-api"
 )
 
 const dbRpsAccount = "rps_account"
@@ -15,7 +15,7 @@ const dbRpsAccount = "rps_account"
 type auth struct {
 	app.Compo
 	notificationPermission app.NotificationPermission
-	sh                     *shell.Shell
+	store                  DocStore
 	myPeerID               string
 	username               string
 	registered             bool
@@ -26,9 +26,10 @@ type auth struct {
 }
 
 type Account struct {
-	ID       string `mapstructure:"_id" json:"_id" validate:"uuid_rfc4122"`             // ID
-	Username string `mapstructure:"username" json:"username" validate:"uuid_rfc4122"`   // Username
-	LoggedIn bool   `mapstructure:"logged_in" json:"logged_in" validate:"uuid_rfc4122"` // LoggedIn
+	ID        string    `mapstructure:"_id" json:"_id" validate:"uuid_rfc4122"`               // ID
+	Username  string    `mapstructure:"username" json:"username" validate:"uuid_rfc4122"`     // Username
+	LoggedIn  bool      `mapstructure:"logged_in" json:"logged_in" validate:"uuid_rfc4122"`   // LoggedIn
+	CreatedAt time.Time `mapstructure:"created_at" json:"created_at" validate:"uuid_rfc4122"` // CreatedAt
 }
 
 func (a *auth) OnMount(ctx app.Context) {
@@ -41,10 +42,9 @@ func (a *auth) OnMount(ctx app.Context) {
 		return
 	}
 
-	sh := shell.NewShell("localhost:5001")
-	a.sh = sh
+	a.store = newDocStore()
 
-	myPeer, err := a.sh.ID()
+	myPeerID, err := a.store.PeerID()
 	if err != nil {
 		ctx.DelState("loggedIn")
 		ctx.Notifications().New(app.Notification{
@@ -54,7 +54,7 @@ func (a *auth) OnMount(ctx app.Context) {
 		return
 	}
 
-	a.myPeerID = myPeer.ID
+	a.myPeerID = myPeerID
 
 	ctx.GetState("loggedIn", &a.loggedIn)
 
@@ -84,7 +84,7 @@ func (a *auth) doLogout(ctx app.Context) {
 			}
 
 			ctx.Async(func() {
-				err = a.sh.OrbitDocsPut(dbRpsAccount, accountJSON)
+				err = a.store.Put(dbRpsAccount, accountJSON)
 				if err != nil {
 					ctx.Notifications().New(app.Notification{
 						Title: "Error",
@@ -109,7 +109,17 @@ func (a *auth) doLogout(ctx app.Context) {
 
 func (a *auth) getAccounts(ctx app.Context) {
 	ctx.Async(func() {
-		accountJSON, err := a.sh.OrbitDocsQuery(dbRpsAccount, "all", "")
+		// an account from before signing is signed again by its peer
+		_, err := resignLegacy(a.store, dbRpsAccount, "_id", a.myPeerID)
+		if err != nil {
+			ctx.Notifications().New(app.Notification{
+				Title: "Error",
+				Body:  err.Error(),
+			})
+			return
+		}
+
+		accountJSON, err := a.store.Query(dbRpsAccount, "all", "")
 		if err != nil {
 			ctx.Notifications().New(app.Notification{
 				Title: "Error",
@@ -229,9 +239,10 @@ func (a *auth) OnSubmit(ctx app.Context, e app.Event) {
 
 func (a *auth) registerAccount(ctx app.Context) {
 	account := Account{
-		ID:       a.myPeerID,
-		Username: a.username,
-		LoggedIn: true,
+		ID:        a.myPeerID,
+		Username:  a.username,
+		LoggedIn:  true,
+		CreatedAt: time.Now(),
 	}
 
 	accountJSON, err := json.Marshal(account)
@@ -244,7 +255,7 @@ func (a *auth) registerAccount(ctx app.Context) {
 	}
 
 	ctx.Async(func() {
-		err = a.sh.OrbitDocsPut(dbRpsAccount, accountJSON)
+		err = a.store.Put(dbRpsAccount, accountJSON)
 		if err != nil {
 			ctx.Notifications().New(app.Notification{
 				Title: "Error",
@@ -279,7 +290,7 @@ func (a *auth) loginAccount(ctx app.Context) {
 	}
 
 	ctx.Async(func() {
-		err = a.sh.OrbitDocsPut(dbRpsAccount, accountJSON)
+		err = a.store.Put(dbRpsAccount, accountJSON)
 		if err != nil {
 			ctx.Notifications().New(app.Notification{
 				Title: "Error",
@@ -2,21 +2,34 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"math"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/mar1n3r0/rps/engine"
 	"github.com/maxence-charriere/go-app/v10/pkg/app"
-	shell "github.com/stateless-minds/go-ipfs-api"
 )
 
 type challenge struct {
 	app.Compo
-	sh          *shell.Shell
+	store       DocStore
 	myPeerID    string
 	playerName  string
-	challenges  []Match
+	challenges  []engine.Match
 	inChallenge bool
+	tab         string // tab shown, the incoming challenges when empty
 }
 
+// Tabs of the challenges page.
+const (
+	tabIncoming   = ""
+	tabOutgoing   = "outgoing"
+	tabFreeForAll = "free-for-all"
+)
+
 func (c *challenge) OnMount(ctx app.Context) {
 	var loggedIn bool
 	ctx.GetState("loggedIn", &loggedIn)
@@ -25,16 +38,15 @@ func (c *challenge) OnMount(ctx app.Context) {
 		return
 	}
 
-	sh := shell.NewShell("localhost:5001")
-	c.sh = sh
+	c.store = newDocStore()
 
-	myPeer, err := c.sh.ID()
+	myPeerID, err := c.store.PeerID()
 	if err != nil {
 		ctx.Navigate("/")
 		return
 	}
 
-	c.myPeerID = myPeer.ID
+	c.myPeerID = myPeerID
 
 	ctx.GetState("playerName", &c.playerName)
 
@@ -55,7 +67,50 @@ func (c *challenge) OnNav(ctx app.Context) {
 
 func (c *challenge) getChallenges(ctx app.Context) {
 	ctx.Async(func() {
-		accountJSON, err := c.sh.OrbitDocsQuery(dbRpsChallenge, "all", "")
+		// finish settlements an earlier visit left half written
+		err := resumeSettlements(c.store, c.playerName)
+		if err != nil {
+			ctx.Notifications().New(app.Notification{
+				Title: "Error",
+				Body:  err.Error(),
+			})
+		}
+
+		// pending matches written before signing are signed again, so that
+		// they can still be declined, cancelled or expired
+		_, err = resignLegacy(c.store, dbRpsChallenge, "status", string(engine.StatusPending))
+		if err != nil {
+			ctx.Notifications().New(app.Notification{
+				Title: "Error",
+				Body:  err.Error(),
+			})
+		}
+
+		refunded, err := reconcileDeclined(c.store, c.playerName)
+		if err != nil {
+			ctx.Notifications().New(app.Notification{
+				Title: "Error",
+				Body:  err.Error(),
+			})
+		}
+
+		if refunded > 0 {
+			ctx.Notifications().New(app.Notification{
+				Title: "Refund",
+				Body:  "Your bets on " + strconv.Itoa(refunded) + " declined challenge(s) were refunded.",
+			})
+		}
+
+		// create the matches of the tournament rounds the player is paired in
+		err = advanceTournaments(c.store, c.playerName, time.Now())
+		if err != nil {
+			ctx.Notifications().New(app.Notification{
+				Title: "Error",
+				Body:  err.Error(),
+			})
+		}
+
+		accountJSON, err := c.store.Query(dbRpsChallenge, "all", "")
 		if err != nil {
 			ctx.Notifications().New(app.Notification{
 				Title: "Error",
@@ -65,7 +120,7 @@ func (c *challenge) getChallenges(ctx app.Context) {
 		}
 
 		if strings.TrimSpace(string(accountJSON)) != "null" && len(accountJSON) > 0 {
-			var challenges []Match
+			var challenges []engine.Match
 
 			err = json.Unmarshal(accountJSON, &challenges)
 			if err != nil {
@@ -76,26 +131,111 @@ func (c *challenge) getChallenges(ctx app.Context) {
 				return
 			}
 
-			for _, cc := range challenges {
-				if cc.Host.Username == c.playerName && cc.Status != "" && !cc.HostNotified {
-					if cc.Status != StatusPending {
+			for i, cc := range challenges {
+				if cc.Plays(c.playerName) && cc.Expired(time.Now()) {
+					expired, err := expireMatch(c.store, cc, c.playerName, time.Now())
+					if err != nil {
+						ctx.Notifications().New(app.Notification{
+							Title: "Error",
+							Body:  err.Error(),
+						})
+						continue
+					}
+
+					cc = expired
+				}
+
+				if cc.Plays(c.playerName) && cc.Overdue(time.Now()) {
+					forfeited, err := forfeitMatch(c.store, cc, c.playerName, time.Now())
+					if err != nil {
+						ctx.Notifications().New(app.Notification{
+							Title: "Error",
+							Body:  err.Error(),
+						})
+						continue
+					}
+
+					cc = forfeited
+				}
+
+				if cc.FreeForAll() && cc.Plays(c.playerName) && cc.Status == engine.StatusAwaitingReveal {
+					revealed, err := c.revealThrow(ctx, cc)
+					if err != nil {
+						ctx.Notifications().New(app.Notification{
+							Title: "Error",
+							Body:  err.Error(),
+						})
+						continue
+					}
+
+					cc = revealed
+				}
+
+				if cc.FreeForAll() && cc.Plays(c.playerName) && cc.Resolved() && !notified(cc, c.playerName) {
+					c.notifyFreeForAll(ctx, cc)
+
+					player := c.playerName
+					c.saveChallenge(ctx, cc.ID, func(m engine.Match) (engine.Match, error) {
+						if !notified(m, player) {
+							m.Notified = append(m.Notified[:len(m.Notified):len(m.Notified)], player)
+						}
+
+						return m, nil
+					})
+				}
+
+				if cc.Host.Username == c.playerName && !cc.FreeForAll() && cc.Status == engine.StatusAwaitingReveal {
+					revealed, err := c.revealChallenge(ctx, cc)
+					if err != nil {
+						ctx.Notifications().New(app.Notification{
+							Title: "Error",
+							Body:  err.Error(),
+						})
+						continue
+					}
+
+					cc = revealed
+				}
+
+				if cc.Host.Username == c.playerName && !cc.FreeForAll() && cc.Status != "" && !cc.HostNotified {
+					if cc.Status != engine.StatusPending && cc.Status != engine.StatusAwaitingReveal {
 						switch cc.Status {
-						case StatusCompleted:
-							if cc.Winner == c.playerName {
-								c.notifyPlayer(ctx, "winner", cc.Opponent.Username)
-							} else {
-								c.notifyPlayer(ctx, "loser", cc.Opponent.Username)
-							}
-						case StatusDraw:
-							c.notifyPlayer(ctx, "draw", cc.Opponent.Username)
+						case engine.StatusCompleted:
+							c.notifyPlayer(ctx, completedOutcome(cc, c.playerName), cc.Opponent.Username, cc.ID)
+						case engine.StatusDraw:
+							c.notifyPlayer(ctx, "draw", cc.Opponent.Username, cc.ID)
+						case engine.StatusExpired:
+							c.notifyPlayer(ctx, "expired", cc.Opponent.Username, cc.ID)
 						}
 
 						cc.HostNotified = true
-						c.saveChallenge(ctx, cc)
+						c.saveChallenge(ctx, cc.ID, func(m engine.Match) (engine.Match, error) {
+							m.HostNotified = true
+							return m, nil
+						})
 					}
 				}
+
+				// the opponent learns the outcome of a match played out or
+				// forfeited here, whoever settled it
+				if outcome, ok := opponentOutcome(cc, c.playerName); ok {
+					c.notifyPlayer(ctx, outcome, cc.Host.Username, cc.ID)
+
+					cc.OpponentNotified = true
+					c.saveChallenge(ctx, cc.ID, func(m engine.Match) (engine.Match, error) {
+						m.OpponentNotified = true
+						return m, nil
+					})
+				}
+
+				challenges[i] = cc
 			}
 
+			// Newest first
+			sort.SliceStable(challenges, func(i, j int) bool {
+				return challenges[i].CreatedAt.After(challenges[j].CreatedAt)
+			})
+
 			ctx.Dispatch(func(ctx app.Context) {
 				c.challenges = challenges
 			})
@@ -103,26 +243,219 @@ func (c *challenge) getChallenges(ctx app.Context) {
 	})
 }
 
-func (c *challenge) notifyPlayer(ctx app.Context, outcome string, opponent string) {
+// revealChallenge discloses the item the host committed to once the
+// opponent has played, and settles the match.
+func (c *challenge) revealChallenge(ctx app.Context, cc engine.Match) (engine.Match, error) {
+	var secret commitSecret
+	ctx.GetState(commitSecretKey(cc.ID), &secret)
+
+	if secret.Salt == "" {
+		return engine.Match{}, errors.New("The move you committed to against " + cc.Opponent.Username + " is not stored in this browser. Open the challenges from the browser you placed the bet in.")
+	}
+
+	mode, err := engine.ParseMode(cc.Mode)
+	if err != nil {
+		return engine.Match{}, err
+	}
+
+	_, rules, err := getRules(c.store, mode)
+	if err != nil {
+		return engine.Match{}, err
+	}
+
+	result, err := revealMatch(c.store, rules, cc, secret)
+	if err != nil {
+		return engine.Match{}, err
+	}
+
+	ctx.DelState(commitSecretKey(cc.ID))
+
+	if result.Match.Status == engine.StatusPending {
+		c.notifyRound(ctx, result.Match)
+	}
+
+	return result.Match, nil
+}
+
+// revealThrow discloses the item the player threw in a free-for-all once
+// every player has thrown. The last player to reveal settles it.
+func (c *challenge) revealThrow(ctx app.Context, cc engine.Match) (engine.Match, error) {
+	for _, p := range cc.Players {
+		if p.Username == c.playerName && p.ItemName != "" {
+			return cc, nil
+		}
+	}
+
+	var secret commitSecret
+	ctx.GetState(commitSecretKey(cc.ID), &secret)
+
+	if secret.Salt == "" {
+		return engine.Match{}, errors.New("The throw you made in the free-for-all with " + strings.Join(cc.Others(c.playerName), ", ") + " is not stored in this browser. Open the challenges from the browser you threw in.")
+	}
+
+	mode, err := engine.ParseMode(cc.Mode)
+	if err != nil {
+		return engine.Match{}, err
+	}
+
+	_, rules, err := getRules(c.store, mode)
+	if err != nil {
+		return engine.Match{}, err
+	}
+
+	result, err := revealThrow(c.store, rules, cc, c.playerName, secret)
+	if err != nil {
+		return engine.Match{}, err
+	}
+
+	ctx.DelState(commitSecretKey(cc.ID))
+
+	return result.Match, nil
+}
+
+// notified reports whether username was told how the free-for-all ended.
+func notified(cc engine.Match, username string) bool {
+	for _, n := range cc.Notified {
+		if n == username {
+			return true
+		}
+	}
+
+	return false
+}
+
+// notifyFreeForAll tells a player of a free-for-all how it ended.
+func (c *challenge) notifyFreeForAll(ctx app.Context, cc engine.Match) {
+	n := app.Notification{
+		Path: "/match/" + cc.ID,
+	}
+
+	switch {
+	case cc.Forfeited(c.playerName):
+		n.Title = "Forfeited"
+		n.Body = "You did not reveal your throw in the free-for-all in time and forfeited your bet, " + strings.Join(cc.Winners, ", ") + " split the pot."
+	case cc.Won(c.playerName) && len(cc.Winners) == 1:
+		n.Title = "Congrats"
+		n.Body = "You won the free-for-all with " + strings.Join(cc.Others(c.playerName), ", ") + " and take the whole pot."
+	case cc.Won(c.playerName):
+		n.Title = "Congrats"
+		n.Body = "Your throw survived the free-for-all, the pot is split between " + strings.Join(cc.Winners, ", ") + "."
+	case cc.Status == engine.StatusCompleted:
+		n.Title = "Try again"
+		n.Body = "Your throw was beaten in the free-for-all, " + strings.Join(cc.Winners, ", ") + " split the pot."
+	case cc.Status == engine.StatusDraw:
+		n.Title = "A tie"
+		n.Body = "Nobody won the free-for-all. Bets refunded."
+	case cc.Status == engine.StatusExpired:
+		n.Title = "Expired"
+		n.Body = "The free-for-all expired before every player threw. Any bet you placed was refunded."
+	default:
+		return
+	}
+
+	ctx.Notifications().New(n)
+}
+
+func (c *challenge) notifyPlayer(ctx app.Context, outcome, opponent, matchID string) {
 	switch outcome {
 	case "winner":
 		ctx.Notifications().New(app.Notification{
 			Title: "Congrats",
-			Body:  "You won your recent match with " + opponent,
+			Body:  "You won your recent match with " + opponent + ". Open it for a rematch.",
+			Path:  "/match/" + matchID,
 		})
 	case "loser":
 		ctx.Notifications().New(app.Notification{
 			Title: "Try again",
-			Body:  "You lost your recent match with " + opponent,
+			Body:  "You lost your recent match with " + opponent + ". Open it for a rematch.",
+			Path:  "/match/" + matchID,
+		})
+	case "walkover":
+		ctx.Notifications().New(app.Notification{
+			Title: "Congrats",
+			Body:  opponent + " did not make their move in time, you won your recent match with them by forfeit.",
+			Path:  "/match/" + matchID,
+		})
+	case "forfeited":
+		ctx.Notifications().New(app.Notification{
+			Title: "Forfeited",
+			Body:  "You did not make your move in time and lost your recent match with " + opponent + " by forfeit.",
+			Path:  "/match/" + matchID,
 		})
 	case "draw":
 		ctx.Notifications().New(app.Notification{
 			Title: "A tie",
-			Body:  "Your recent match with " + opponent + " ended in  a draw. Bets refunded.",
+			Body:  "Your recent match with " + opponent + " ended in  a draw. Bets refunded. Open it for a rematch.",
+			Path:  "/match/" + matchID,
+		})
+	case "expired":
+		if opponent == "" {
+			ctx.Notifications().New(app.Notification{
+				Title: "Expired",
+				Body:  "Nobody accepted your open challenge before it expired.",
+			})
+			return
+		}
+
+		ctx.Notifications().New(app.Notification{
+			Title: "Expired",
+			Body:  "Your challenge to " + opponent + " expired. Any bet you placed was refunded.",
 		})
 	}
 }
 
+// completedOutcome tells username how a completed match ended for them, as
+// the outcome notifyPlayer takes.
+func completedOutcome(cc engine.Match, username string) string {
+	switch {
+	case cc.Forfeited(username):
+		return "forfeited"
+	case cc.Forfeit != "":
+		return "walkover"
+	case cc.Winner == username:
+		return "winner"
+	}
+
+	return "loser"
+}
+
+// opponentOutcome returns the outcome notifyPlayer tells username, the
+// opponent of cc, once the match is played out or forfeited, including a
+// forfeit before the host committed. It returns false until then, once the
+// opponent was told, and for a match that ended any other way.
+func opponentOutcome(cc engine.Match, username string) (string, bool) {
+	if cc.FreeForAll() || cc.Opponent.Username != username || cc.OpponentNotified {
+		return "", false
+	}
+
+	switch cc.Status {
+	case engine.StatusCompleted:
+		return completedOutcome(cc, username), true
+	case engine.StatusDraw:
+		return "draw", true
+	}
+
+	return "", false
+}
+
+// notifyRound tells the host how the round of a series just revealed went.
+func (c *challenge) notifyRound(ctx app.Context, cc engine.Match) {
+	round := cc.Rounds[len(cc.Rounds)-1]
+
+	outcome := "tied"
+	switch round.Winner {
+	case c.playerName:
+		outcome = "won"
+	case cc.Opponent.Username:
+		outcome = "lost"
+	}
+
+	ctx.Notifications().New(app.Notification{
+		Title: "Round " + strconv.Itoa(len(cc.Rounds)),
+		Body:  "You " + outcome + " round " + strconv.Itoa(len(cc.Rounds)) + " against " + cc.Opponent.Username + ". " + seriesText(cc, c.playerName) + ". Pick your move for round " + strconv.Itoa(cc.Round()) + ".",
+	})
+}
+
 // The Render method is where the component appearance is defined.
 func (c *challenge) Render() app.UI {
 	return app.Div().
@@ -130,38 +463,411 @@ func (c *challenge) Render() app.UI {
 		Body(
 			newNav(),
 			app.Div().ID("main").Body(
-				app.Table().Body(
-					app.TBody().Body(
-						app.Tr().Body(
-							app.Td().ID("table-header").Text("Challenges").ColSpan(3),
-						),
-
-						app.Range(c.challenges).Slice(func(i int) app.UI {
-							return app.If(c.challenges[i].Status == StatusPending && c.challenges[i].Opponent.Username == c.playerName, func() app.UI {
-								c.inChallenge = false
-								return app.Tr().Body(
-									app.Td().Text(c.challenges[i].Host.Username),
-									app.Td().Body(
-										app.Button().
-											Class("challenge-btn").
-											Text("Decline").
-											Value(c.challenges[i].ID).
-											OnClick(c.declineChallenge),
-									),
-									app.Td().Body(
-										app.Button().
-											Class("challenge-btn").
-											Text("Accept").
-											Value(c.challenges[i].ID).
-											OnClick(c.acceptChallenge),
-									),
-								)
-							})
+				app.Div().Class("tabs").Body(
+					app.Button().
+						ID("incoming-tablink").
+						Class(tabClass(c.tab == tabIncoming)).
+						Text("Incoming").
+						OnClick(c.openIncomingTab),
+					app.Button().
+						ID("outgoing-tablink").
+						Class(tabClass(c.tab == tabOutgoing)).
+						Text("Outgoing").
+						OnClick(c.openOutgoingTab),
+					app.Button().
+						ID("free-for-all-tablink").
+						Class(tabClass(c.tab == tabFreeForAll)).
+						Text("Free-for-All").
+						OnClick(c.openFreeForAllTab),
+				),
+				app.If(c.tab == tabOutgoing, func() app.UI {
+					return c.renderOutgoing()
+				}).ElseIf(c.tab == tabFreeForAll, func() app.UI {
+					return c.renderFreeForAll()
+				}).Else(func() app.UI {
+					return c.renderIncoming()
+				}),
+			),
+		)
+}
+
+func tabClass(active bool) string {
+	if active {
+		return "tablink active"
+	}
+
+	return "tablink"
+}
+
+// renderIncoming renders the pending challenges the player received, with
+// the actions they are waiting for: agreeing on the stake or playing.
+func (c *challenge) renderIncoming() app.UI {
+	return app.Table().Body(
+		app.TBody().Body(
+			app.Tr().Body(
+				app.Td().ID("table-header").Text("Incoming Challenges").ColSpan(4),
+			),
+			app.Range(c.challenges).Slice(func(i int) app.UI {
+				cc := c.challenges[i]
+				if cc.Status != engine.StatusPending || cc.Opponent.Username != c.playerName {
+					return nil
+				}
+
+				c.inChallenge = false
+
+				return app.Tr().Body(
+					c.renderPlayer(cc),
+					c.renderStake(cc),
+					app.Td().Body(c.renderNegotiation(cc)),
+					app.Td().Body(
+						app.If(!cc.Staked() && cc.TournamentID == "", func() app.UI {
+							return app.Button().
+								Class("challenge-btn").
+								Text("Decline").
+								Value(cc.ID).
+								OnClick(c.declineChallenge)
+						}),
+						app.If(!cc.StakeAgreed && cc.StakeBy != c.playerName, func() app.UI {
+							return app.Button().
+								Class("challenge-btn").
+								Text("Accept").
+								Value(cc.ID).
+								OnClick(c.agreeStake)
+						}),
+						app.If(cc.StakeAgreed && cc.Host.Commitment != "", func() app.UI {
+							return app.Button().
+								Class("challenge-btn").
+								Text("Play").
+								Value(cc.ID).
+								OnClick(c.acceptChallenge)
 						}),
 					),
-				),
+				)
+			}),
+		),
+	)
+}
+
+// renderOutgoing renders the challenges the player sent, whatever became of
+// them, with a Cancel action for the pending ones.
+func (c *challenge) renderOutgoing() app.UI {
+	return app.Table().Body(
+		app.TBody().Body(
+			app.Tr().Body(
+				app.Td().ID("table-header").Text("Outgoing Challenges").ColSpan(4),
+			),
+			app.Range(c.challenges).Slice(func(i int) app.UI {
+				cc := c.challenges[i]
+				if !outgoing(cc, c.playerName) {
+					return nil
+				}
+
+				return app.Tr().Body(
+					c.renderPlayer(cc),
+					c.renderStake(cc),
+					app.Td().Body(
+						app.If(cc.Status == engine.StatusPending, func() app.UI {
+							return c.renderNegotiation(cc)
+						}).Else(func() app.UI {
+							return app.Text(statusText(cc, c.playerName))
+						}),
+					),
+					app.Td().Body(
+						app.If(cc.Status == engine.StatusPending && !cc.StakeAgreed && cc.StakeBy != c.playerName, func() app.UI {
+							return app.Button().
+								Class("challenge-btn").
+								Text("Accept").
+								Value(cc.ID).
+								OnClick(c.agreeStake)
+						}),
+						app.If(cc.Status == engine.StatusPending && cc.StakeAgreed && cc.Host.Commitment == "", func() app.UI {
+							text := "Place Bet"
+							if !cc.NeedsBet() {
+								text = "Play Round " + strconv.Itoa(cc.Round())
+							}
+
+							return app.Button().
+								Class("challenge-btn").
+								Text(text).
+								Value(cc.ID).
+								OnClick(c.acceptChallenge)
+						}),
+						app.If(cc.Status == engine.StatusPending && !cc.Staked() && cc.TournamentID == "", func() app.UI {
+							return app.Button().
+								Class("challenge-btn").
+								Text("Cancel").
+								Value(cc.ID).
+								OnClick(c.cancelChallenge)
+						}),
+					),
+				)
+			}),
+		),
+	)
+}
+
+// outgoing reports whether cc is a challenge username sent, which the
+// outgoing tab lists. Free-for-alls have a tab of their own.
+func outgoing(cc engine.Match, username string) bool {
+	return cc.Host.Username == username && !cc.FreeForAll()
+}
+
+// renderFreeForAll renders the free-for-alls the player takes part in.
+func (c *challenge) renderFreeForAll() app.UI {
+	return app.Table().Body(
+		app.TBody().Body(
+			app.Tr().Body(
+				app.Td().ID("table-header").Text("Free-for-All").ColSpan(4),
 			),
+			app.Range(c.challenges).Slice(func(i int) app.UI {
+				cc := c.challenges[i]
+				if !cc.FreeForAll() || !cc.Plays(c.playerName) {
+					return nil
+				}
+
+				return app.Tr().Body(
+					app.Td().Body(
+						app.Text(playersText(cc)),
+						app.If(cc.Status == engine.StatusPending && cc.TTL > 0, func() app.UI {
+							return app.Span().Class("expires").Text(expiresIn(cc, time.Now()))
+						}),
+					),
+					c.renderStake(cc),
+					app.Td().Text(freeForAllText(cc, c.playerName)),
+					app.Td().Body(
+						app.If(engine.CanBet(cc, c.playerName) == nil, func() app.UI {
+							return app.Button().
+								Class("challenge-btn").
+								Text("Throw").
+								Value(cc.ID).
+								OnClick(c.acceptChallenge)
+						}),
+						app.If(cc.Status == engine.StatusPending && cc.Host.Username == c.playerName && len(cc.Players) == 1, func() app.UI {
+							return app.Button().
+								Class("challenge-btn").
+								Text("Cancel").
+								Value(cc.ID).
+								OnClick(c.cancelChallenge)
+						}),
+						app.If(cc.Resolved(), func() app.UI {
+							return app.A().Href("/match/" + cc.ID).Text("View")
+						}),
+					),
+				)
+			}),
+		),
+	)
+}
+
+// playersText lists the players of a free-for-all with how many of the
+// places are taken.
+func playersText(cc engine.Match) string {
+	var names []string
+	for _, p := range cc.Players {
+		names = append(names, p.Username)
+	}
+
+	return strings.Join(names, ", ") + " (" + strconv.Itoa(len(cc.Players)) + "/" + strconv.Itoa(cc.Size) + ")"
+}
+
+// freeForAllText describes where a free-for-all stands from the point of
+// view of username.
+func freeForAllText(cc engine.Match, username string) string {
+	switch cc.Status {
+	case engine.StatusPending:
+		if engine.CanBet(cc, username) == nil {
+			return "Pick your throw"
+		}
+
+		return "Waiting for " + strconv.Itoa(cc.Size-cc.Thrown()) + " more to throw"
+	case engine.StatusAwaitingReveal:
+		return "Revealing, " + strconv.Itoa(cc.Revealed()) + " of " + strconv.Itoa(len(cc.Players)) + " done"
+	case engine.StatusCompleted:
+		if cc.Forfeited(username) {
+			return "Lost by forfeit"
+		}
+
+		if cc.Won(username) && len(cc.Winners) == 1 {
+			return "Won the pot"
+		}
+
+		if cc.Won(username) {
+			return "Split the pot between " + strings.Join(cc.Winners, ", ")
+		}
+
+		return "Lost to " + strings.Join(cc.Winners, ", ")
+	}
+
+	return statusText(cc, username)
+}
+
+// renderPlayer renders the other player of a challenge along with the time
+// left to answer a pending one.
+func (c *challenge) renderPlayer(cc engine.Match) app.UI {
+	other := cc.OpponentOf(c.playerName)
+	if cc.Unclaimed() {
+		other = "Open challenge"
+	}
+
+	return app.Td().Body(
+		app.Text(other),
+		app.If(cc.Status == engine.StatusPending && cc.TTL > 0, func() app.UI {
+			return app.Span().Class("expires").Text(expiresIn(cc, time.Now()))
+		}),
+	)
+}
+
+// renderStake renders the stake of a challenge, or the tournament it is
+// played for, along with the score of a series.
+func (c *challenge) renderStake(cc engine.Match) app.UI {
+	if cc.TournamentID != "" {
+		return app.Td().Body(
+			app.A().Href("/tournaments").Text("Tournament"),
+			app.If(cc.IsSeries(), func() app.UI {
+				return app.Span().Class("series").Text(seriesText(cc, c.playerName))
+			}),
 		)
+	}
+
+	return app.Td().Body(
+		app.Text("Stake "+formatStake(cc.Stake)),
+		app.If(cc.DoubleOrNothing, func() app.UI {
+			return app.Span().Class("series").Text("Double or nothing")
+		}).ElseIf(cc.PreviousID != "", func() app.UI {
+			return app.Span().Class("series").Text("Rematch")
+		}),
+		app.If(cc.IsSeries(), func() app.UI {
+			return app.Span().Class("series").Text(seriesText(cc, c.playerName))
+		}),
+	)
+}
+
+// renderNegotiation renders where a pending challenge stands: the stake
+// waiting for an answer, the counter-offer form, or whose move it is.
+func (c *challenge) renderNegotiation(cc engine.Match) app.UI {
+	other := cc.OpponentOf(c.playerName)
+
+	switch {
+	case cc.Unclaimed():
+		return app.A().Href("/lobby").Text("Waiting for a player to accept it in the lobby")
+	case !cc.StakeAgreed && cc.StakeBy == c.playerName:
+		return app.Text("Waiting for " + other + " to answer")
+	case !cc.StakeAgreed:
+		return app.Div().Body(
+			app.Input().
+				ID("counter-"+cc.ID).
+				Class("counter-amount").
+				Type("number").
+				Min(0.1).
+				Step(0.1).
+				Placeholder("0.1"),
+			app.Button().
+				Class("challenge-btn").
+				Text("Counter").
+				Value(cc.ID).
+				OnClick(c.counterStake),
+		)
+	case !cc.NeedsBet() && cc.Host.Commitment == "" && cc.Host.Username == c.playerName:
+		return app.Text("Round " + strconv.Itoa(cc.Round()) + ", pick your move")
+	case !cc.NeedsBet() && cc.Host.Commitment == "":
+		return app.Text("Waiting for " + other + " to pick round " + strconv.Itoa(cc.Round()))
+	case cc.Host.Commitment == "" && cc.Host.Username == c.playerName:
+		return app.Text("Stake agreed, place your bet")
+	case cc.Host.Commitment == "":
+		return app.Text("Waiting for " + other + " to place a bet")
+	case cc.Host.Username == c.playerName:
+		return app.Text("Waiting for " + other + " to play")
+	default:
+		return app.Text("Your move")
+	}
+}
+
+// statusText describes how a challenge that is no longer pending ended,
+// from the point of view of username.
+func statusText(cc engine.Match, username string) string {
+	switch cc.Status {
+	case engine.StatusAwaitingReveal:
+		return "Played, settled once you reveal"
+	case engine.StatusCompleted:
+		switch {
+		case cc.Forfeited(username):
+			return "Lost by forfeit"
+		case cc.Forfeit != "" && cc.Won(username):
+			return "Won by forfeit"
+		case cc.Won(username):
+			return "Won"
+		}
+
+		return "Lost"
+	case engine.StatusDraw:
+		return "Draw"
+	case engine.StatusDeclined:
+		return "Declined"
+	case engine.StatusExpired:
+		return "Expired"
+	case engine.StatusCancelled:
+		return "Cancelled"
+	}
+
+	return string(cc.Status)
+}
+
+// seriesText gives the length of a series and its score with the rounds
+// username won first, or nothing for a single throw.
+func seriesText(cc engine.Match, username string) string {
+	if !cc.IsSeries() {
+		return ""
+	}
+
+	host, opponent := cc.Score()
+	if username != cc.Host.Username {
+		host, opponent = opponent, host
+	}
+
+	return "Best of " + strconv.Itoa(cc.BestOf) + ", " + strconv.Itoa(host) + "-" + strconv.Itoa(opponent)
+}
+
+func formatStake(cents int) string {
+	return "€" + strconv.FormatFloat(float64(float32(cents)/100), 'f', 2, 32)
+}
+
+func (c *challenge) openIncomingTab(ctx app.Context, e app.Event) {
+	c.tab = tabIncoming
+}
+
+func (c *challenge) openOutgoingTab(ctx app.Context, e app.Event) {
+	c.tab = tabOutgoing
+}
+
+func (c *challenge) openFreeForAllTab(ctx app.Context, e app.Event) {
+	c.tab = tabFreeForAll
+}
+
+func (c *challenge) agreeStake(ctx app.Context, e app.Event) {
+	challengeID := ctx.JSSrc().Get("value").String()
+
+	c.saveChallenge(ctx, challengeID, func(m engine.Match) (engine.Match, error) {
+		return engine.AgreeStake(m, c.playerName, time.Now())
+	})
+}
+
+func (c *challenge) counterStake(ctx app.Context, e app.Event) {
+	challengeID := ctx.JSSrc().Get("value").String()
+
+	value, err := strconv.ParseFloat(app.Window().GetElementByID("counter-"+challengeID).Get("value").String(), 64)
+	if err != nil {
+		ctx.Notifications().New(app.Notification{
+			Title: "Error",
+			Body:  "Enter the stake you propose",
+		})
+		return
+	}
+
+	amount := int(math.Round(value * 100))
+
+	c.saveChallenge(ctx, challengeID, func(m engine.Match) (engine.Match, error) {
+		return engine.Propose(m, c.playerName, amount, time.Now())
+	})
 }
 
 func (c *challenge) acceptChallenge(ctx app.Context, e app.Event) {
@@ -175,26 +881,45 @@ func (c *challenge) acceptChallenge(ctx app.Context, e app.Event) {
 func (c *challenge) declineChallenge(ctx app.Context, e app.Event) {
 	challengeID := ctx.JSSrc().Get("value").String()
 
-	var challenge Match
+	var challenge engine.Match
 	for _, c := range c.challenges {
 		if c.ID == challengeID {
 			challenge = c
 		}
 	}
 
-	challenge.Status = StatusDeclined
+	ctx.Async(func() {
+		declined, err := declineMatch(c.store, challenge, c.playerName)
+		if err != nil {
+			ctx.Notifications().New(app.Notification{
+				Title: "Error",
+				Body:  err.Error(),
+			})
+			return
+		}
 
-	challengeJSON, err := json.Marshal(challenge)
-	if err != nil {
-		ctx.Notifications().New(app.Notification{
-			Title: "Error",
-			Body:  err.Error(),
+		ctx.Dispatch(func(ctx app.Context) {
+			for i, cc := range c.challenges {
+				if cc.ID == declined.ID {
+					c.challenges[i] = declined
+				}
+			}
 		})
-		return
+	})
+}
+
+func (c *challenge) cancelChallenge(ctx app.Context, e app.Event) {
+	challengeID := ctx.JSSrc().Get("value").String()
+
+	var challenge engine.Match
+	for _, c := range c.challenges {
+		if c.ID == challengeID {
+			challenge = c
+		}
 	}
 
 	ctx.Async(func() {
-		err = c.sh.OrbitDocsPut(dbRpsChallenge, challengeJSON)
+		cancelled, err := cancelMatch(c.store, challenge, c.playerName)
 		if err != nil {
 			ctx.Notifications().New(app.Notification{
 				Title: "Error",
@@ -202,21 +927,33 @@ func (c *challenge) declineChallenge(ctx app.Context, e app.Event) {
 			})
 			return
 		}
-	})
-}
 
-func (c *challenge) saveChallenge(ctx app.Context, challenge Match) {
-	challengeJSON, err := json.Marshal(challenge)
-	if err != nil {
-		ctx.Notifications().New(app.Notification{
-			Title: "Error",
-			Body:  err.Error(),
+		ctx.Dispatch(func(ctx app.Context) {
+			for i, cc := range c.challenges {
+				if cc.ID == cancelled.ID {
+					c.challenges[i] = cancelled
+				}
+			}
+
+			message := "Challenge to " + cancelled.Opponent.Username + " cancelled."
+			if cancelled.Unclaimed() {
+				message = "Open challenge cancelled."
+			} else if cancelled.FreeForAll() {
+				message = "Free-for-all cancelled."
+			}
+
+			ctx.Notifications().New(app.Notification{
+				Title: "Success",
+				Body:  message,
+			})
 		})
-		return
-	}
+	})
+}
 
+// saveChallenge applies update to the latest version of the challenge.
+func (c *challenge) saveChallenge(ctx app.Context, id string, update func(m engine.Match) (engine.Match, error)) {
 	ctx.Async(func() {
-		err = c.sh.OrbitDocsPut(dbRpsChallenge, challengeJSON)
+		saved, err := modifyMatch(c.store, id, update)
 		if err != nil {
 			ctx.Notifications().New(app.Notification{
 				Title: "Error",
@@ -224,5 +961,36 @@ func (c *challenge) saveChallenge(ctx app.Context, challenge Match) {
 			})
 			return
 		}
+
+		ctx.Dispatch(func(ctx app.Context) {
+			for i, cc := range c.challenges {
+				if cc.ID == saved.ID {
+					c.challenges[i] = saved
+				}
+			}
+		})
 	})
 }
+
+// expiresIn tells how long a pending challenge stays open.
+func expiresIn(cc engine.Match, now time.Time) string {
+	expiresAt, ok := cc.ExpiresAt()
+	if !ok {
+		return ""
+	}
+
+	left := expiresAt.Sub(now)
+	if left <= 0 {
+		return "Expired"
+	}
+
+	if left < time.Hour {
+		return "Expires in " + strconv.Itoa(int(left.Minutes())+1) + "m"
+	}
+
+	if left < 48*time.Hour {
+		return "Expires in " + strconv.Itoa(int(left.Hours())) + "h " + strconv.Itoa(int(left.Minutes())%60) + "m"
+	}
+
+	return "Expires in " + strconv.Itoa(int(left.Hours()/24)) + " days"
+}
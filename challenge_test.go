@@ -0,0 +1,205 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/mar1n3r0/rps/engine"
+)
+
+func TestCancelMatch(t *testing.T) {
+	players := newTestPlayers(t, 1000, "alice", "bob")
+	alice, bob := players[0], players[1]
+
+	m := openedMatch(t, alice, bob, "dddddddd-dddd-dddd-dddd-ddddddddddd1", 300)
+
+	// only the host withdraws a challenge
+	if _, err := cancelMatch(bob.store, m, bob.name); !errors.Is(err, engine.ErrNotParticipant) {
+		t.Fatalf("bob cancelled alice's challenge: %v", err)
+	}
+
+	cancelled, err := cancelMatch(alice.store, m, alice.name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := getMatch(bob.store, m.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cancelled.Status != engine.StatusCancelled || stored.Status != engine.StatusCancelled {
+		t.Fatalf("match %s, stored %s", cancelled.Status, stored.Status)
+	}
+
+	for _, p := range players {
+		check, err := verifyLedger(bob.store, p.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !check.Balanced() || check.Cached != 1000 {
+			t.Fatalf("%s has %+v once cancelled", p.name, check)
+		}
+	}
+
+	// the stake is refunded once
+	if _, err := cancelMatch(alice.store, stored, alice.name); !errors.Is(err, engine.ErrResolved) {
+		t.Fatalf("cancelled twice: %v", err)
+	}
+
+	if got := balanceOf(t, alice.store, alice.name); got != 1000 {
+		t.Fatalf("alice has %d", got)
+	}
+}
+
+func TestCancelPlayedMatch(t *testing.T) {
+	players := newTestPlayers(t, 1000, "alice", "bob")
+	alice, bob := players[0], players[1]
+
+	m := openedMatch(t, alice, bob, "dddddddd-dddd-dddd-dddd-ddddddddddd2", 300)
+
+	played, stakes, err := engine.Play(classicRules(t), m, engine.Selection{Username: bob.name, ItemName: "paper", Bet: 300}, testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := settleMatch(bob.store, bob.name, played, stakes); err != nil {
+		t.Fatal(err)
+	}
+
+	played, err = getMatch(alice.store, m.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// once bob has played, the match can only be settled
+	if _, err := cancelMatch(alice.store, played, alice.name); !errors.Is(err, engine.ErrNotPending) {
+		t.Fatalf("played match cancelled: %v", err)
+	}
+
+	for p, want := range map[string]int{alice.name: 700, bob.name: 700} {
+		if got := balanceOf(t, alice.store, p); got != want {
+			t.Fatalf("%s has %d, want %d", p, got, want)
+		}
+	}
+}
+
+func TestOutgoing(t *testing.T) {
+	tests := []struct {
+		name string
+		m    engine.Match
+		want bool
+	}{
+		{"a challenge sent", engine.Match{Host: engine.Selection{Username: "alice"}, Opponent: engine.Selection{Username: "bob"}, Status: engine.StatusPending}, true},
+		{"a challenge sent that is over", engine.Match{Host: engine.Selection{Username: "alice"}, Opponent: engine.Selection{Username: "bob"}, Status: engine.StatusCancelled}, true},
+		{"an open challenge", engine.Match{Host: engine.Selection{Username: "alice"}, Status: engine.StatusPending}, true},
+		{"a challenge received", engine.Match{Host: engine.Selection{Username: "bob"}, Opponent: engine.Selection{Username: "alice"}, Status: engine.StatusPending}, false},
+		{"a free-for-all hosted", engine.Match{Host: engine.Selection{Username: "alice"}, Size: 3, Status: engine.StatusPending}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := outgoing(tt.m, "alice"); got != tt.want {
+				t.Fatalf("outgoing %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStatusText(t *testing.T) {
+	won := engine.Match{Status: engine.StatusCompleted, Host: engine.Selection{Username: "alice"}, Opponent: engine.Selection{Username: "bob"}, Winner: "alice"}
+	forfeited := won
+	forfeited.Forfeit = "bob"
+
+	tests := []struct {
+		name     string
+		m        engine.Match
+		username string
+		want     string
+	}{
+		{"awaiting the reveal", engine.Match{Status: engine.StatusAwaitingReveal}, "alice", "Played, settled once you reveal"},
+		{"won", won, "alice", "Won"},
+		{"lost", won, "bob", "Lost"},
+		{"won by forfeit", forfeited, "alice", "Won by forfeit"},
+		{"lost by forfeit", forfeited, "bob", "Lost by forfeit"},
+		{"a draw", engine.Match{Status: engine.StatusDraw}, "alice", "Draw"},
+		{"declined", engine.Match{Status: engine.StatusDeclined}, "alice", "Declined"},
+		{"expired", engine.Match{Status: engine.StatusExpired}, "alice", "Expired"},
+		{"cancelled", engine.Match{Status: engine.StatusCancelled}, "alice", "Cancelled"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := statusText(tt.m, tt.username); got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpponentOutcome(t *testing.T) {
+	agreed, err := engine.Create("dddddddd-dddd-dddd-dddd-ddddddddddd3", engine.ModeClassic, "alice", "bob", testNow, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	agreed, err = engine.Propose(agreed, "alice", 100, testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	agreed, err = engine.AgreeStake(agreed, "bob", testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// alice never commits to her tournament match, so bob wins by forfeit
+	paired, err := engine.Pair("dddddddd-dddd-dddd-dddd-ddddddddddd4", "t1", engine.ModeClassic, engine.Pairing{Round: 1, Host: "alice", Opponent: "bob"}, testNow, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	forfeited, err := engine.Forfeit(classicRules(t), paired, testNow.Add(engine.MoveWindow))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if forfeited.Match.Host.Commitment != "" {
+		t.Fatalf("host committed: %+v", forfeited.Match.Host)
+	}
+
+	lost := engine.Match{Host: engine.Selection{Username: "alice", Commitment: "c1"}, Opponent: engine.Selection{Username: "bob"}, Status: engine.StatusCompleted, Winner: "alice"}
+
+	told := lost
+	told.OpponentNotified = true
+
+	declined := agreed
+	declined.Status = engine.StatusDeclined
+
+	tests := []struct {
+		name     string
+		m        engine.Match
+		username string
+		outcome  string
+		ok       bool
+	}{
+		{"a match lost", lost, "bob", "loser", true},
+		{"a draw", engine.Match{Host: engine.Selection{Username: "alice"}, Opponent: engine.Selection{Username: "bob"}, Status: engine.StatusDraw}, "bob", "draw", true},
+		{"a walkover before the host committed", forfeited.Match, "bob", "walkover", true},
+		{"an outcome told before", told, "bob", "", false},
+		{"the host", lost, "alice", "", false},
+		{"a match declined", declined, "bob", "", false},
+		{"a match still pending", agreed, "bob", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outcome, ok := opponentOutcome(tt.m, tt.username)
+
+			if outcome != tt.outcome || ok != tt.ok {
+				t.Fatalf("got %q, %v, want %q, %v", outcome, ok, tt.outcome, tt.ok)
+			}
+		})
+	}
+}
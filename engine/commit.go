@@ -0,0 +1,33 @@
+package engine
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+)
+
+// NewSalt returns a random salt to commit to an item with.
+func NewSalt() (string, error) {
+	b := make([]byte, 32)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// Commit returns the commitment to item made with salt. It can be published
+// without disclosing the item, and later checked with Verify once the salt
+// is revealed.
+func Commit(item ItemType, salt string) string {
+	sum := sha256.Sum256([]byte(salt + ":" + string(item)))
+	return hex.EncodeToString(sum[:])
+}
+
+// Verify reports whether commitment was made to item with salt.
+func Verify(commitment string, item ItemType, salt string) bool {
+	return subtle.ConstantTimeCompare([]byte(commitment), []byte(Commit(item, salt))) == 1
+}
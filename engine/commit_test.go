@@ -0,0 +1,78 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCommitVerify(t *testing.T) {
+	salt, err := NewSalt()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := NewSalt()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if salt == other || len(salt) != 64 {
+		t.Fatalf("salts %q and %q", salt, other)
+	}
+
+	c := Commit("rock", salt)
+
+	if c == Commit("rock", other) {
+		t.Fatal("commitment does not depend on the salt")
+	}
+
+	tests := []struct {
+		name string
+		item ItemType
+		salt string
+		want bool
+	}{
+		{"same item and salt", "rock", salt, true},
+		{"other item", "paper", salt, false},
+		{"other salt", "rock", other, false},
+		{"no salt", "rock", "", false},
+	}
+
+	for _, tt := range tests {
+		if got := Verify(c, tt.item, tt.salt); got != tt.want {
+			t.Fatalf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRevealChecksCommitment(t *testing.T) {
+	rules := classicRules(t)
+
+	m, _, err := Open(rules, agreedMatch(t, 100, 1), Selection{Username: "alice", ItemName: "rock", Bet: 100}, "salt", testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, _, err = Play(rules, m, Selection{Username: "bob", ItemName: "scissors", Bet: 100}, testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the host cannot switch to the item that beats bob's
+	if _, err := Reveal(rules, m, "paper", "salt", testNow); !errors.Is(err, ErrBadReveal) {
+		t.Fatalf("other item: got %v", err)
+	}
+
+	if _, err := Reveal(rules, m, "rock", "pepper", testNow); !errors.Is(err, ErrBadReveal) {
+		t.Fatalf("other salt: got %v", err)
+	}
+
+	res, err := Reveal(rules, m, "rock", "salt", testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Match.Host.Salt != "salt" || res.Match.Host.ItemName != "rock" {
+		t.Fatalf("reveal not disclosed: %+v", res.Match.Host)
+	}
+}
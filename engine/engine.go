@@ -0,0 +1,440 @@
+// Package engine implements the rules of a match independently of where it
+// is played. It takes a Match and the players' selections and tells what
+// the match turns into and how money has to move between wallets, leaving
+// storage and presentation to the caller.
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrNotPending     = errors.New("match is not pending")
+	ErrNotParticipant = errors.New("player is not part of the match")
+	ErrInvalidBet     = errors.New("bet must be greater than zero")
+	ErrNoHostBet      = errors.New("host has not placed a bet yet")
+	ErrAlreadyBet     = errors.New("host has already placed a bet")
+	ErrWrongMode      = errors.New("rules do not match the game mode")
+	ErrNotPlayed      = errors.New("opponent has not played yet")
+	ErrBadReveal      = errors.New("revealed item does not match the commitment")
+	ErrNotExpired     = errors.New("match has not expired yet")
+	ErrSelfChallenge  = errors.New("a player cannot challenge themselves")
+	ErrBestOf         = errors.New("a series is played over an odd number of rounds up to 7")
+)
+
+type MovementKind string
+
+const (
+	MovementStake  MovementKind = "stake"
+	MovementPayout MovementKind = "payout"
+	MovementRefund MovementKind = "refund"
+)
+
+// Movement is a change to a player's wallet. Amount is in cents and is
+// negative when money leaves the wallet.
+type Movement struct {
+	Username string
+	Kind     MovementKind
+	Amount   int
+}
+
+// Result is the resolution of a match.
+type Result struct {
+	Match     Match      // Match with both selections and the final status
+	Outcome   Outcome    // Outcome from the opponent's point of view, of the round for a series
+	Winner    string     // Winner username, empty on draw, of the round for a series
+	Loser     string     // Loser username, empty on draw, of the round for a series
+	Movements []Movement // Wallet changes in the order they have to be applied
+}
+
+// Create returns a new pending match between host and opponent with id,
+// started at now. A ttl of zero keeps it open until it is played. A bestOf
+// above 1 makes it a series won by the first player to take the majority of
+// the rounds.
+func Create(id string, mode Mode, host, opponent string, now time.Time, ttl time.Duration, bestOf int) (Match, error) {
+	if host == opponent {
+		return Match{}, ErrSelfChallenge
+	}
+
+	if bestOf < 1 || bestOf > 7 || bestOf%2 == 0 {
+		return Match{}, ErrBestOf
+	}
+
+	m := Match{
+		ID:   id,
+		Mode: string(mode),
+		Host: Selection{
+			Username: host,
+		},
+		Opponent: Selection{
+			Username: opponent,
+		},
+		CreatedAt: now,
+		TTL:       int(ttl.Seconds()),
+		BestOf:    bestOf,
+	}
+
+	if err := m.record(EventCreate, host, now); err != nil {
+		return Match{}, err
+	}
+
+	m.Status = StatusPending
+
+	return m, nil
+}
+
+// Open records the host's bet on a pending match whose stake was agreed and
+// returns the match along with the movement that stakes it. The host's item
+// is not stored: the match only carries a commitment to it, made with salt,
+// which the host has to keep until Reveal. In the later rounds of a series
+// the host only commits to the next item, the bet stays the one staked in
+// the first round.
+func Open(rules *Rules, m Match, host Selection, salt string, now time.Time) (Match, []Movement, error) {
+	if host.Username != m.Host.Username {
+		return Match{}, nil, ErrNotParticipant
+	}
+
+	if err := CanBet(m, host.Username); err != nil {
+		return Match{}, nil, err
+	}
+
+	if err := checkMode(rules, m); err != nil {
+		return Match{}, nil, err
+	}
+
+	if m.NeedsBet() && host.Bet != m.Stake {
+		return Match{}, nil, ErrStakeMismatch
+	}
+
+	if !rules.Valid(ItemType(host.ItemName)) {
+		return Match{}, nil, fmt.Errorf("unknown item %q", host.ItemName)
+	}
+
+	if err := m.record(EventCommit, host.Username, now); err != nil {
+		return Match{}, nil, err
+	}
+
+	if !m.NeedsBet() {
+		m.Host = Selection{
+			Username:   host.Username,
+			Bet:        m.Host.Bet,
+			Commitment: Commit(ItemType(host.ItemName), salt),
+		}
+
+		return m, nil, nil
+	}
+
+	m.Host = Selection{
+		Username:   host.Username,
+		Bet:        host.Bet,
+		Commitment: Commit(ItemType(host.ItemName), salt),
+	}
+	m.BetAmount = host.Bet
+
+	return m, []Movement{stake(host)}, nil
+}
+
+// Play records the opponent's selection on a match the host has committed
+// to and returns the match, now waiting for the host to reveal, along with
+// the movement that stakes the opponent's bet. The later rounds of a series
+// stake nothing.
+func Play(rules *Rules, m Match, opponent Selection, now time.Time) (Match, []Movement, error) {
+	if opponent.Username != m.Opponent.Username {
+		return Match{}, nil, ErrNotParticipant
+	}
+
+	if err := CanBet(m, opponent.Username); err != nil {
+		return Match{}, nil, err
+	}
+
+	if err := checkMode(rules, m); err != nil {
+		return Match{}, nil, err
+	}
+
+	if m.NeedsBet() && opponent.Bet <= 0 {
+		return Match{}, nil, ErrInvalidBet
+	}
+
+	// matches the host committed to before stakes were agreed take any bet
+	if m.NeedsBet() && m.StakeAgreed && opponent.Bet != m.Stake {
+		return Match{}, nil, ErrStakeMismatch
+	}
+
+	if !rules.Valid(ItemType(opponent.ItemName)) {
+		return Match{}, nil, fmt.Errorf("unknown item %q", opponent.ItemName)
+	}
+
+	if err := m.record(EventPlay, opponent.Username, now); err != nil {
+		return Match{}, nil, err
+	}
+
+	if !m.NeedsBet() {
+		m.Opponent.ItemName = opponent.ItemName
+		m.Status = StatusAwaitingReveal
+
+		return m, nil, nil
+	}
+
+	m.Opponent = Selection{
+		Username: opponent.Username,
+		ItemName: opponent.ItemName,
+		Bet:      opponent.Bet,
+	}
+	m.BetAmount = m.Host.Bet + opponent.Bet
+	m.Status = StatusAwaitingReveal
+
+	return m, []Movement{stake(opponent)}, nil
+}
+
+// Reveal discloses the host's item and salt on a played match, checks them
+// against the commitment and resolves the match. The returned movements pay
+// the whole pot to the winner, or refund both bets on a draw. A round of a
+// series that leaves both players short of the wins needed moves nothing and
+// starts the next round, so a tied round is simply played again.
+func Reveal(rules *Rules, m Match, item ItemType, salt string, now time.Time) (Result, error) {
+	if m.Resolved() {
+		return Result{}, ErrResolved
+	}
+
+	if m.Status != StatusAwaitingReveal {
+		return Result{}, ErrNotPlayed
+	}
+
+	if err := checkMode(rules, m); err != nil {
+		return Result{}, err
+	}
+
+	if !Verify(m.Host.Commitment, item, salt) {
+		return Result{}, ErrBadReveal
+	}
+
+	outcome, err := rules.Resolve(item, ItemType(m.Opponent.ItemName))
+	if err != nil {
+		return Result{}, err
+	}
+
+	res := Result{
+		Outcome: outcome,
+	}
+
+	switch outcome {
+	case OutcomeWin:
+		res.Winner = m.Opponent.Username
+		res.Loser = m.Host.Username
+	case OutcomeLoss:
+		res.Winner = m.Host.Username
+		res.Loser = m.Opponent.Username
+	}
+
+	if m.ReplaysTies() {
+		m.Rounds = append(m.Rounds[:len(m.Rounds):len(m.Rounds)], Round{
+			Host:     string(item),
+			Opponent: m.Opponent.ItemName,
+			Winner:   res.Winner,
+		})
+
+		host, opponent := m.Score()
+		if host < m.WinsNeeded() && opponent < m.WinsNeeded() {
+			return nextRound(m, res, now)
+		}
+	}
+
+	if err := m.record(EventReveal, m.Host.Username, now); err != nil {
+		return Result{}, err
+	}
+
+	m.Host.ItemName = string(item)
+	m.Host.Salt = salt
+
+	if outcome == OutcomeDraw {
+		m.Status = StatusDraw
+		res.Movements = []Movement{
+			{Username: m.Opponent.Username, Kind: MovementRefund, Amount: m.Opponent.Bet},
+			{Username: m.Host.Username, Kind: MovementRefund, Amount: m.Host.Bet},
+		}
+	} else {
+		m.Status = StatusCompleted
+		m.Winner = res.Winner
+		m.Loser = res.Loser
+		res.Movements = []Movement{
+			{Username: res.Winner, Kind: MovementPayout, Amount: m.BetAmount},
+		}
+	}
+
+	res.Match = m
+
+	return res, nil
+}
+
+// nextRound records the round of a series just revealed as over and
+// returns the match ready for the host to commit to the next item.
+func nextRound(m Match, res Result, now time.Time) (Result, error) {
+	if err := m.record(EventRound, m.Host.Username, now); err != nil {
+		return Result{}, err
+	}
+
+	m.Host.Commitment = ""
+	m.Host.ItemName = ""
+	m.Host.Salt = ""
+	m.Opponent.ItemName = ""
+	m.Status = StatusPending
+
+	res.Match = m
+
+	return res, nil
+}
+
+// Decline turns down a pending match on behalf of the opponent and returns
+// the declined match along with the movements that refund the bets already
+// staked on it.
+func Decline(m Match, username string, now time.Time) (Match, []Movement, error) {
+	if err := checkPending(m); err != nil {
+		return Match{}, nil, err
+	}
+
+	if username != m.Opponent.Username {
+		return Match{}, nil, ErrNotParticipant
+	}
+
+	if m.TournamentID != "" {
+		return Match{}, nil, ErrTournamentMatch
+	}
+
+	if err := m.record(EventDecline, username, now); err != nil {
+		return Match{}, nil, err
+	}
+
+	m.Status = StatusDeclined
+
+	return m, refunds(m), nil
+}
+
+// Cancel withdraws a pending match on behalf of the host and returns it
+// along with the movements that refund the bets already staked on it. Once
+// the opponent has played the match can only be settled.
+func Cancel(m Match, username string, now time.Time) (Match, []Movement, error) {
+	if err := checkPending(m); err != nil {
+		return Match{}, nil, err
+	}
+
+	if username != m.Host.Username {
+		return Match{}, nil, ErrNotParticipant
+	}
+
+	if m.TournamentID != "" {
+		return Match{}, nil, ErrTournamentMatch
+	}
+
+	if m.FreeForAll() && len(m.Players) > 1 {
+		return Match{}, nil, ErrJoined
+	}
+
+	if err := m.record(EventCancel, username, now); err != nil {
+		return Match{}, nil, err
+	}
+
+	m.Status = StatusCancelled
+
+	return m, refunds(m), nil
+}
+
+// Expire ends a pending match whose time limit has passed and returns it
+// along with the movements that refund the bets already staked on it.
+func Expire(m Match, now time.Time) (Match, []Movement, error) {
+	if err := checkPending(m); err != nil {
+		return Match{}, nil, err
+	}
+
+	if !m.Expired(now) {
+		return Match{}, nil, ErrNotExpired
+	}
+
+	if err := m.record(EventExpire, "", now); err != nil {
+		return Match{}, nil, err
+	}
+
+	m.Status = StatusExpired
+
+	return m, refunds(m), nil
+}
+
+// Payouts returns the movements that settled a resolved match: the pot paid
+// to the winner, or split between the winners of a free-for-all, and the
+// bets refunded when it ended any other way. It is what the settlement of
+// the match moved into the players' wallets, so that a write another peer
+// made to a wallet can be checked against it. A match that is not resolved
+// has paid out nothing.
+func (m Match) Payouts() []Movement {
+	switch {
+	case !m.Resolved():
+		return nil
+	case m.Status != StatusCompleted:
+		return refunds(m)
+	case m.FreeForAll():
+		var winners []int
+
+		for _, w := range m.Winners {
+			if i := m.player(w); i >= 0 {
+				winners = append(winners, i)
+			}
+		}
+
+		if len(winners) == 0 {
+			return nil
+		}
+
+		m.Winners = nil
+
+		return splitPot(m, winners).Movements
+	case m.BetAmount > 0:
+		return []Movement{{Username: m.Winner, Kind: MovementPayout, Amount: m.BetAmount}}
+	}
+
+	return nil
+}
+
+// refunds returns the movements that give every player of m back the bet
+// they staked.
+func refunds(m Match) []Movement {
+	var mvs []Movement
+
+	players := []Selection{m.Host, m.Opponent}
+	if m.FreeForAll() {
+		players = m.Players
+	}
+
+	for _, sel := range players {
+		if sel.Bet > 0 {
+			mvs = append(mvs, Movement{
+				Username: sel.Username,
+				Kind:     MovementRefund,
+				Amount:   sel.Bet,
+			})
+		}
+	}
+
+	return mvs
+}
+
+func stake(sel Selection) Movement {
+	return Movement{
+		Username: sel.Username,
+		Kind:     MovementStake,
+		Amount:   -sel.Bet,
+	}
+}
+
+func checkMode(rules *Rules, m Match) error {
+	mode, err := ParseMode(m.Mode)
+	if err != nil {
+		return err
+	}
+
+	if rules.Mode() != mode {
+		return ErrWrongMode
+	}
+
+	return nil
+}
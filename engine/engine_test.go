@@ -0,0 +1,318 @@
+package engine
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var testNow = time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC)
+
+func classicRules(t *testing.T) *Rules {
+	t.Helper()
+
+	rules, err := NewRules(Cyclic(ModeClassic, []string{"rock", "scissors", "paper"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rules
+}
+
+// agreedMatch returns a pending match between alice and bob with a stake of
+// stake agreed on, played best of bestOf.
+func agreedMatch(t *testing.T, stake, bestOf int) Match {
+	t.Helper()
+
+	m, err := Create("m1", ModeClassic, "alice", "bob", testNow, time.Hour, bestOf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err = Propose(m, "alice", stake, testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err = AgreeStake(m, "bob", testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return m
+}
+
+// credits adds up the movements of every player.
+func credits(mvs []Movement) map[string]int {
+	sums := make(map[string]int)
+
+	for _, mv := range mvs {
+		sums[mv.Username] += mv.Amount
+	}
+
+	return sums
+}
+
+// playRound has alice commit to host and bob play opponent, and reveals the
+// round.
+func playRound(t *testing.T, rules *Rules, m Match, host, opponent string) Result {
+	t.Helper()
+
+	m, _, err := Open(rules, m, Selection{Username: "alice", ItemName: host, Bet: m.Stake}, "salt", testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, _, err = Play(rules, m, Selection{Username: "bob", ItemName: opponent, Bet: m.Stake}, testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := Reveal(rules, m, ItemType(host), "salt", testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return res
+}
+
+func TestCreate(t *testing.T) {
+	if _, err := Create("m1", ModeClassic, "alice", "alice", testNow, 0, 1); !errors.Is(err, ErrSelfChallenge) {
+		t.Fatalf("got %v, want ErrSelfChallenge", err)
+	}
+
+	for _, bestOf := range []int{0, 2, 9} {
+		if _, err := Create("m1", ModeClassic, "alice", "bob", testNow, 0, bestOf); !errors.Is(err, ErrBestOf) {
+			t.Fatalf("best of %d: got %v, want ErrBestOf", bestOf, err)
+		}
+	}
+
+	m, err := Create("m1", ModeClassic, "alice", "bob", testNow, time.Hour, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Status != StatusPending || m.State() != StateCreated || m.TTL != 3600 {
+		t.Fatalf("got %+v", m)
+	}
+}
+
+func TestStakeNegotiation(t *testing.T) {
+	m, err := Create("m1", ModeClassic, "alice", "bob", testNow, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := AgreeStake(m, "bob", testNow); !errors.Is(err, ErrStakeNotAgreed) {
+		t.Fatalf("agree without proposal: got %v", err)
+	}
+
+	m, err = Propose(m, "alice", 100, testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := AgreeStake(m, "alice", testNow); !errors.Is(err, ErrOwnProposal) {
+		t.Fatalf("agree to own proposal: got %v", err)
+	}
+
+	if _, err := Propose(m, "carol", 100, testNow); !errors.Is(err, ErrNotParticipant) {
+		t.Fatalf("outsider proposal: got %v", err)
+	}
+
+	// bob counters and alice agrees
+	m, err = Propose(m, "bob", 50, testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err = AgreeStake(m, "alice", testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !m.StakeAgreed || m.Stake != 50 {
+		t.Fatalf("got stake %d agreed %v", m.Stake, m.StakeAgreed)
+	}
+
+	if _, err := Propose(m, "bob", 70, testNow); !errors.Is(err, ErrStakeAgreed) {
+		t.Fatalf("proposal after agreement: got %v", err)
+	}
+}
+
+func TestMatchFlow(t *testing.T) {
+	rules := classicRules(t)
+
+	tests := []struct {
+		name      string
+		host      string
+		opponent  string
+		status    Status
+		winner    string
+		movements []Movement
+	}{
+		{"host wins", "rock", "scissors", StatusCompleted, "alice", []Movement{
+			{Username: "alice", Kind: MovementPayout, Amount: 200},
+		}},
+		{"opponent wins", "rock", "paper", StatusCompleted, "bob", []Movement{
+			{Username: "bob", Kind: MovementPayout, Amount: 200},
+		}},
+		{"draw", "paper", "paper", StatusDraw, "", []Movement{
+			{Username: "bob", Kind: MovementRefund, Amount: 100},
+			{Username: "alice", Kind: MovementRefund, Amount: 100},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := agreedMatch(t, 100, 1)
+
+			if err := CanBet(m, "bob"); !errors.Is(err, ErrNoHostBet) {
+				t.Fatalf("opponent before host: got %v", err)
+			}
+
+			if _, _, err := Open(rules, m, Selection{Username: "alice", ItemName: tt.host, Bet: 90}, "salt", testNow); !errors.Is(err, ErrStakeMismatch) {
+				t.Fatalf("bet off the stake: got %v", err)
+			}
+
+			opened, stakes, err := Open(rules, m, Selection{Username: "alice", ItemName: tt.host, Bet: 100}, "salt", testNow)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if opened.Host.ItemName != "" || opened.Host.Commitment == "" {
+				t.Fatalf("host item stored in the open: %+v", opened.Host)
+			}
+
+			if !reflect.DeepEqual(stakes, []Movement{{Username: "alice", Kind: MovementStake, Amount: -100}}) {
+				t.Fatalf("host stake %+v", stakes)
+			}
+
+			if _, err := Reveal(rules, opened, ItemType(tt.host), "salt", testNow); !errors.Is(err, ErrNotPlayed) {
+				t.Fatalf("reveal before play: got %v", err)
+			}
+
+			played, stakes, err := Play(rules, opened, Selection{Username: "bob", ItemName: tt.opponent, Bet: 100}, testNow)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if played.Status != StatusAwaitingReveal || played.BetAmount != 200 {
+				t.Fatalf("played match %+v", played)
+			}
+
+			if !reflect.DeepEqual(stakes, []Movement{{Username: "bob", Kind: MovementStake, Amount: -100}}) {
+				t.Fatalf("opponent stake %+v", stakes)
+			}
+
+			res, err := Reveal(rules, played, ItemType(tt.host), "salt", testNow)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if res.Match.Status != tt.status || res.Winner != tt.winner || res.Match.Host.ItemName != tt.host {
+				t.Fatalf("got %s won by %q", res.Match.Status, res.Winner)
+			}
+
+			if !reflect.DeepEqual(res.Movements, tt.movements) {
+				t.Fatalf("got movements %+v, want %+v", res.Movements, tt.movements)
+			}
+
+			if got := credits(res.Match.Payouts()); !reflect.DeepEqual(got, credits(tt.movements)) {
+				t.Fatalf("paid out %v", got)
+			}
+
+			if _, err := Reveal(rules, res.Match, ItemType(tt.host), "salt", testNow); !errors.Is(err, ErrResolved) {
+				t.Fatalf("second reveal: got %v", err)
+			}
+		})
+	}
+}
+
+func TestSeries(t *testing.T) {
+	rules := classicRules(t)
+	m := agreedMatch(t, 100, 3)
+
+	res := playRound(t, rules, m, "rock", "scissors")
+	if res.Match.Status != StatusPending || res.Movements != nil || res.Match.State() != StateNextRound {
+		t.Fatalf("after round 1: %s %+v", res.Match.Status, res.Movements)
+	}
+
+	// a tie is replayed
+	res = playRound(t, rules, res.Match, "rock", "rock")
+	if res.Match.Round() != 3 || res.Match.Status != StatusPending {
+		t.Fatalf("after a tie: round %d %s", res.Match.Round(), res.Match.Status)
+	}
+
+	res = playRound(t, rules, res.Match, "rock", "scissors")
+	if res.Match.Status != StatusCompleted || res.Winner != "alice" {
+		t.Fatalf("got %s won by %q", res.Match.Status, res.Winner)
+	}
+
+	if !reflect.DeepEqual(res.Movements, []Movement{{Username: "alice", Kind: MovementPayout, Amount: 200}}) {
+		t.Fatalf("got movements %+v", res.Movements)
+	}
+
+	if host, opponent := res.Match.Score(); host != 2 || opponent != 0 {
+		t.Fatalf("score %d-%d", host, opponent)
+	}
+}
+
+func TestEndPending(t *testing.T) {
+	rules := classicRules(t)
+
+	m := agreedMatch(t, 100, 1)
+	opened, _, err := Open(rules, m, Selection{Username: "alice", ItemName: "rock", Bet: 100}, "salt", testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	refund := []Movement{{Username: "alice", Kind: MovementRefund, Amount: 100}}
+
+	if _, _, err := Decline(opened, "alice", testNow); !errors.Is(err, ErrNotParticipant) {
+		t.Fatalf("host declines: got %v", err)
+	}
+
+	declined, mvs, err := Decline(opened, "bob", testNow)
+	if err != nil || declined.Status != StatusDeclined || !reflect.DeepEqual(mvs, refund) {
+		t.Fatalf("decline: %v %s %+v", err, declined.Status, mvs)
+	}
+
+	if _, _, err := Cancel(opened, "bob", testNow); !errors.Is(err, ErrNotParticipant) {
+		t.Fatalf("opponent cancels: got %v", err)
+	}
+
+	cancelled, mvs, err := Cancel(opened, "alice", testNow)
+	if err != nil || cancelled.Status != StatusCancelled || !reflect.DeepEqual(mvs, refund) {
+		t.Fatalf("cancel: %v %s %+v", err, cancelled.Status, mvs)
+	}
+
+	if _, _, err := Expire(opened, testNow.Add(time.Minute)); !errors.Is(err, ErrNotExpired) {
+		t.Fatalf("early expiry: got %v", err)
+	}
+
+	expired, mvs, err := Expire(opened, testNow.Add(time.Hour))
+	if err != nil || expired.Status != StatusExpired || !reflect.DeepEqual(mvs, refund) {
+		t.Fatalf("expire: %v %s %+v", err, expired.Status, mvs)
+	}
+
+	for _, ended := range []Match{declined, cancelled, expired} {
+		if got := ended.Payouts(); !reflect.DeepEqual(got, refund) {
+			t.Fatalf("%s match paid out %+v", ended.Status, got)
+		}
+	}
+
+	played, _, err := Play(rules, opened, Selection{Username: "bob", ItemName: "paper", Bet: 100}, testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := played.Payouts(); got != nil {
+		t.Fatalf("match in play paid out %+v", got)
+	}
+
+	if _, _, err := Cancel(played, "alice", testNow); !errors.Is(err, ErrNotPending) {
+		t.Fatalf("cancel a played match: got %v", err)
+	}
+}
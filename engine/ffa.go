@@ -0,0 +1,346 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrPlayers       = errors.New("a free-for-all is played by 3 to 8 players")
+	ErrNotFreeForAll = errors.New("match is not a free-for-all")
+	ErrFull          = errors.New("the free-for-all is full")
+	ErrAlreadyThrown = errors.New("player has already thrown")
+	ErrThrowsOpen    = errors.New("not every player has thrown yet")
+	ErrRevealed      = errors.New("player has already revealed")
+	ErrJoined        = errors.New("players have already joined the free-for-all")
+)
+
+// MinPlayers and MaxPlayers bound the number of players of a free-for-all.
+const (
+	MinPlayers = 3
+	MaxPlayers = 8
+)
+
+// CreateFreeForAll returns a new pending free-for-all hosted by host for
+// size players, each betting stake. Players join by throwing, the host
+// included, and once the last one has thrown every player reveals.
+func CreateFreeForAll(id string, mode Mode, host string, now time.Time, ttl time.Duration, size, stake int) (Match, error) {
+	if size < MinPlayers || size > MaxPlayers {
+		return Match{}, ErrPlayers
+	}
+
+	m, err := Create(id, mode, host, "", now, ttl, 1)
+	if err != nil {
+		return Match{}, err
+	}
+
+	m, err = Propose(m, host, stake, now)
+	if err != nil {
+		return Match{}, err
+	}
+
+	// joining a free-for-all is agreeing to its stake
+	m.StakeAgreed = true
+	m.Size = size
+	m.Players = []Selection{{Username: host}}
+
+	return m, nil
+}
+
+// FreeForAll reports whether the match is played by more than two players
+// throwing at once.
+func (m Match) FreeForAll() bool {
+	return m.Size > 0
+}
+
+// Plays reports whether username takes part in the match.
+func (m Match) Plays(username string) bool {
+	if username == m.Host.Username || username == m.Opponent.Username {
+		return true
+	}
+
+	return m.player(username) >= 0
+}
+
+// Won reports whether username won the match, or a share of the pot of a
+// free-for-all.
+func (m Match) Won(username string) bool {
+	if !m.FreeForAll() {
+		return m.Status == StatusCompleted && m.Winner == username
+	}
+
+	for _, w := range m.Winners {
+		if w == username {
+			return m.Status == StatusCompleted
+		}
+	}
+
+	return false
+}
+
+// Others returns the players of the match other than username.
+func (m Match) Others(username string) []string {
+	if !m.FreeForAll() {
+		return []string{m.OpponentOf(username)}
+	}
+
+	var others []string
+
+	for _, p := range m.Players {
+		if p.Username != username {
+			others = append(others, p.Username)
+		}
+	}
+
+	return others
+}
+
+// Thrown returns how many players of a free-for-all have thrown.
+func (m Match) Thrown() int {
+	var n int
+
+	for _, p := range m.Players {
+		if p.Commitment != "" {
+			n++
+		}
+	}
+
+	return n
+}
+
+// Revealed returns how many players of a free-for-all have revealed.
+func (m Match) Revealed() int {
+	var n int
+
+	for _, p := range m.Players {
+		if p.ItemName != "" {
+			n++
+		}
+	}
+
+	return n
+}
+
+func (m Match) player(username string) int {
+	for i, p := range m.Players {
+		if p.Username == username {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// canThrow reports whether username can throw in a free-for-all: the match
+// is still taking throws, they have not thrown yet and there is room for
+// them if they have not joined.
+func canThrow(m Match, username string) error {
+	if m.Status == StatusAwaitingReveal {
+		return ErrAwaitingReveal
+	}
+
+	if err := checkPending(m); err != nil {
+		return err
+	}
+
+	i := m.player(username)
+	if i >= 0 && m.Players[i].Commitment != "" {
+		return ErrAlreadyThrown
+	}
+
+	if i < 0 && len(m.Players) >= m.Size {
+		return ErrFull
+	}
+
+	return nil
+}
+
+// Throw records the bet of a player of a free-for-all along with a
+// commitment to their item made with salt, adding them to the players when
+// they were not in yet. The last throw closes the match to new players and
+// waits for every player to reveal.
+func Throw(rules *Rules, m Match, sel Selection, salt string, now time.Time) (Match, []Movement, error) {
+	if !m.FreeForAll() {
+		return Match{}, nil, ErrNotFreeForAll
+	}
+
+	if err := CanBet(m, sel.Username); err != nil {
+		return Match{}, nil, err
+	}
+
+	if err := checkMode(rules, m); err != nil {
+		return Match{}, nil, err
+	}
+
+	if sel.Bet != m.Stake {
+		return Match{}, nil, ErrStakeMismatch
+	}
+
+	if !rules.Valid(ItemType(sel.ItemName)) {
+		return Match{}, nil, fmt.Errorf("unknown item %q", sel.ItemName)
+	}
+
+	last := m.Thrown()+1 == m.Size
+
+	event := EventThrow
+	if last {
+		event = EventLastThrow
+	}
+
+	if err := m.record(event, sel.Username, now); err != nil {
+		return Match{}, nil, err
+	}
+
+	thrown := Selection{
+		Username:   sel.Username,
+		Bet:        sel.Bet,
+		Commitment: Commit(ItemType(sel.ItemName), salt),
+	}
+
+	players := append([]Selection{}, m.Players...)
+	if i := m.player(sel.Username); i >= 0 {
+		players[i] = thrown
+	} else {
+		players = append(players, thrown)
+	}
+
+	m.Players = players
+	m.BetAmount += sel.Bet
+
+	if last {
+		m.Status = StatusAwaitingReveal
+	}
+
+	return m, []Movement{stake(sel)}, nil
+}
+
+// RevealThrow discloses the item and salt username committed to in a
+// free-for-all every player has thrown in. The last reveal resolves the
+// match: the pot is split between the players whose throw survived, and
+// every bet is refunded when nobody or everybody survived. Players who do
+// not reveal within MoveWindow of the last throw forfeit, see Forfeit.
+func RevealThrow(rules *Rules, m Match, username string, item ItemType, salt string, now time.Time) (Result, error) {
+	if m.Resolved() {
+		return Result{}, ErrResolved
+	}
+
+	if m.Status != StatusAwaitingReveal {
+		return Result{}, ErrThrowsOpen
+	}
+
+	if err := checkMode(rules, m); err != nil {
+		return Result{}, err
+	}
+
+	i := m.player(username)
+	if i < 0 {
+		return Result{}, ErrNotParticipant
+	}
+
+	if m.Players[i].ItemName != "" {
+		return Result{}, ErrRevealed
+	}
+
+	if !Verify(m.Players[i].Commitment, item, salt) {
+		return Result{}, ErrBadReveal
+	}
+
+	last := m.Revealed()+1 == len(m.Players)
+
+	event := EventRevealThrow
+	if last {
+		event = EventReveal
+	}
+
+	if err := m.record(event, username, now); err != nil {
+		return Result{}, err
+	}
+
+	players := append([]Selection{}, m.Players...)
+	players[i].ItemName = string(item)
+	players[i].Salt = salt
+	m.Players = players
+
+	if !last {
+		return Result{Match: m}, nil
+	}
+
+	throws := make([]ItemType, len(m.Players))
+	for i, p := range m.Players {
+		throws[i] = ItemType(p.ItemName)
+	}
+
+	survivors := Survivors(rules, throws)
+
+	res := Result{}
+
+	if len(survivors) == 0 {
+		m.Status = StatusDraw
+		res.Outcome = OutcomeDraw
+		res.Movements = refunds(m)
+		res.Match = m
+
+		return res, nil
+	}
+
+	return splitPot(m, survivors), nil
+}
+
+// splitPot completes a free-for-all with a win for the players at winners,
+// who split the pot. The cents that do not split evenly go to the first
+// winner to join.
+func splitPot(m Match, winners []int) Result {
+	m.Status = StatusCompleted
+
+	res := Result{Outcome: OutcomeWin}
+
+	share := m.BetAmount / len(winners)
+
+	for n, i := range winners {
+		amount := share
+		if n == 0 {
+			amount += m.BetAmount % len(winners)
+		}
+
+		m.Winners = append(m.Winners, m.Players[i].Username)
+		res.Movements = append(res.Movements, Movement{
+			Username: m.Players[i].Username,
+			Kind:     MovementPayout,
+			Amount:   amount,
+		})
+	}
+
+	res.Match = m
+
+	return res
+}
+
+// Survivors returns the positions of the throws not beaten by any other
+// throw. It returns nothing when every throw is beaten, as when rock, paper
+// and scissors all appear, and when all throws survive, as when everybody
+// threw the same item, since in both cases nobody won.
+func Survivors(rules *Rules, throws []ItemType) []int {
+	var survivors []int
+
+	for i, a := range throws {
+		beaten := false
+
+		for _, b := range throws {
+			if rules.Beats(b, a) {
+				beaten = true
+				break
+			}
+		}
+
+		if !beaten {
+			survivors = append(survivors, i)
+		}
+	}
+
+	if len(survivors) == len(throws) {
+		return nil
+	}
+
+	return survivors
+}
@@ -0,0 +1,202 @@
+package engine
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSurvivors(t *testing.T) {
+	rules := classicRules(t)
+
+	tests := []struct {
+		name   string
+		throws []ItemType
+		want   []int
+	}{
+		{"one beats the rest", []ItemType{"scissors", "rock", "scissors"}, []int{1}},
+		{"two share", []ItemType{"rock", "paper", "paper"}, []int{1, 2}},
+		{"all three items", []ItemType{"rock", "paper", "scissors"}, nil},
+		{"everybody threw the same", []ItemType{"rock", "rock", "rock"}, nil},
+		{"a single throw", []ItemType{"rock"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Survivors(rules, tt.throws); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// thrownFreeForAll returns a free-for-all of alice, bob and carol, in that
+// order, every one of whom bet 100 and threw the item at their position in
+// items with the salt "salt".
+func thrownFreeForAll(t *testing.T, rules *Rules, items ...string) Match {
+	t.Helper()
+
+	m, err := CreateFreeForAll("f1", ModeClassic, "alice", testNow, time.Hour, len(items), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, username := range []string{"alice", "bob", "carol"}[:len(items)] {
+		m, _, err = Throw(rules, m, Selection{Username: username, ItemName: items[i], Bet: 100}, "salt", testNow)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return m
+}
+
+func TestRevealThrow(t *testing.T) {
+	rules := classicRules(t)
+
+	tests := []struct {
+		name      string
+		items     []string
+		status    Status
+		movements []Movement
+	}{
+		{"one survivor takes the pot", []string{"rock", "scissors", "scissors"}, StatusCompleted, []Movement{
+			{Username: "alice", Kind: MovementPayout, Amount: 300},
+		}},
+		{"survivors split the pot", []string{"paper", "paper", "rock"}, StatusCompleted, []Movement{
+			{Username: "alice", Kind: MovementPayout, Amount: 150},
+			{Username: "bob", Kind: MovementPayout, Amount: 150},
+		}},
+		{"nobody survives", []string{"rock", "paper", "scissors"}, StatusDraw, []Movement{
+			{Username: "alice", Kind: MovementRefund, Amount: 100},
+			{Username: "bob", Kind: MovementRefund, Amount: 100},
+			{Username: "carol", Kind: MovementRefund, Amount: 100},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := thrownFreeForAll(t, rules, tt.items...)
+
+			if m.Status != StatusAwaitingReveal {
+				t.Fatalf("%s once everybody threw", m.Status)
+			}
+
+			if _, err := RevealThrow(rules, m, "dave", "rock", "salt", testNow); !errors.Is(err, ErrNotParticipant) {
+				t.Fatalf("outsider: got %v", err)
+			}
+
+			if _, err := RevealThrow(rules, m, "alice", ItemType(tt.items[0]), "pepper", testNow); !errors.Is(err, ErrBadReveal) {
+				t.Fatalf("wrong salt: got %v", err)
+			}
+
+			var res Result
+
+			for i, username := range []string{"alice", "bob", "carol"} {
+				var err error
+
+				res, err = RevealThrow(rules, m, username, ItemType(tt.items[i]), "salt", testNow)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				m = res.Match
+			}
+
+			if m.Status != tt.status || !reflect.DeepEqual(res.Movements, tt.movements) {
+				t.Fatalf("got %s with movements %+v", m.Status, res.Movements)
+			}
+
+			if got := m.Payouts(); !reflect.DeepEqual(got, tt.movements) {
+				t.Fatalf("paid out %+v", got)
+			}
+
+			if _, err := RevealThrow(rules, m, "alice", ItemType(tt.items[0]), "salt", testNow); !errors.Is(err, ErrResolved) {
+				t.Fatalf("reveal after the end: got %v", err)
+			}
+		})
+	}
+}
+
+func TestForfeitFreeForAll(t *testing.T) {
+	rules := classicRules(t)
+
+	tests := []struct {
+		name      string
+		items     []string
+		revealing []string
+		status    Status
+		winners   []string
+		movements []Movement
+	}{
+		{"the only player to reveal takes the pot", []string{"rock", "paper", "scissors"}, []string{"alice"}, StatusCompleted, []string{"alice"}, []Movement{
+			{Username: "alice", Kind: MovementPayout, Amount: 300},
+		}},
+		{"settled among the players who revealed", []string{"rock", "paper", "scissors"}, []string{"alice", "bob"}, StatusCompleted, []string{"bob"}, []Movement{
+			{Username: "bob", Kind: MovementPayout, Amount: 300},
+		}},
+		{"a tie among them splits the pot", []string{"rock", "rock", "paper"}, []string{"alice", "bob"}, StatusCompleted, []string{"alice", "bob"}, []Movement{
+			{Username: "alice", Kind: MovementPayout, Amount: 150},
+			{Username: "bob", Kind: MovementPayout, Amount: 150},
+		}},
+		{"nobody revealed", []string{"rock", "paper", "scissors"}, nil, StatusDraw, nil, []Movement{
+			{Username: "alice", Kind: MovementRefund, Amount: 100},
+			{Username: "bob", Kind: MovementRefund, Amount: 100},
+			{Username: "carol", Kind: MovementRefund, Amount: 100},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := thrownFreeForAll(t, rules, tt.items...)
+
+			deadline, ok := m.Deadline()
+			if !ok {
+				t.Fatal("no deadline once everybody threw")
+			}
+
+			for i, username := range tt.revealing {
+				res, err := RevealThrow(rules, m, username, ItemType(tt.items[i]), "salt", testNow)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				m = res.Match
+			}
+
+			// revealing does not move the deadline of the others
+			if d, _ := m.Deadline(); !d.Equal(deadline) {
+				t.Fatalf("deadline moved from %v to %v", deadline, d)
+			}
+
+			if _, err := Forfeit(rules, m, deadline.Add(-time.Second)); !errors.Is(err, ErrNotOverdue) {
+				t.Fatalf("before the deadline: got %v", err)
+			}
+
+			res, err := Forfeit(rules, m, deadline)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if res.Match.Status != tt.status || !reflect.DeepEqual(res.Match.Winners, tt.winners) || !reflect.DeepEqual(res.Movements, tt.movements) {
+				t.Fatalf("got %s won by %v with movements %+v", res.Match.Status, res.Match.Winners, res.Movements)
+			}
+
+			if got := res.Match.Payouts(); !reflect.DeepEqual(got, tt.movements) {
+				t.Fatalf("paid out %+v", got)
+			}
+
+			for _, username := range []string{"alice", "bob", "carol"} {
+				revealed := res.Match.Players[res.Match.player(username)].ItemName != ""
+				if want := tt.status == StatusCompleted && !revealed; res.Match.Forfeited(username) != want {
+					t.Fatalf("%s forfeited: %v, want %v", username, !want, want)
+				}
+			}
+
+			if last := res.Match.Transitions[len(res.Match.Transitions)-1]; last.Event != EventForfeit || last.From != StateAccepted || last.To != StateResolved {
+				t.Fatalf("logged %+v", last)
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package engine
+
+import (
+	"errors"
+	"time"
+)
+
+// MoveWindow is how long a player has to make the move a match is waiting
+// for once it reaches that point. A player who lets it pass forfeits.
+const MoveWindow = 48 * time.Hour
+
+var ErrNotOverdue = errors.New("match is not waiting on a move past its deadline")
+
+// movedAt returns when the match entered the state it is in, which is when
+// the clock of the move it is waiting for started.
+func (m Match) movedAt() time.Time {
+	for i := len(m.Transitions) - 1; i >= 0; i-- {
+		t := m.Transitions[i]
+		if t.From != t.To {
+			return t.At
+		}
+	}
+
+	return m.CreatedAt
+}
+
+// waitingOn returns the player the match is waiting for a move from that
+// has to be made in time, or nothing when there is none: the host has to
+// reveal once the opponent played, and once the bets of a series are
+// staked every round has to be committed and played in time too. Tournament
+// matches cannot be declined or expire, so every move of theirs has a
+// deadline, and the player who moved gets a walkover.
+func (m Match) waitingOn() string {
+	if m.FreeForAll() {
+		return ""
+	}
+
+	switch m.State() {
+	case StateAccepted, StateNextRound:
+		return m.Host.Username
+	case StateCreated:
+		if m.TournamentID != "" {
+			return m.Host.Username
+		}
+	case StateCommitted:
+		if m.Staked() || m.TournamentID != "" {
+			return m.Opponent.Username
+		}
+	}
+
+	return ""
+}
+
+// unrevealed returns the players of a free-for-all every player has thrown
+// in who have not revealed yet. The last throw starts the clock for all of
+// them.
+func (m Match) unrevealed() []string {
+	if !m.FreeForAll() || m.Status != StatusAwaitingReveal {
+		return nil
+	}
+
+	var players []string
+
+	for _, p := range m.Players {
+		if p.ItemName == "" {
+			players = append(players, p.Username)
+		}
+	}
+
+	return players
+}
+
+// Deadline returns when the players the match is waiting for forfeit, and
+// false for a match that is not waiting on a move with a deadline.
+func (m Match) Deadline() (time.Time, bool) {
+	if m.waitingOn() == "" && len(m.unrevealed()) == 0 {
+		return time.Time{}, false
+	}
+
+	return m.movedAt().Add(MoveWindow), true
+}
+
+// Overdue reports whether the deadline of the move the match is waiting for
+// has passed.
+func (m Match) Overdue(now time.Time) bool {
+	deadline, ok := m.Deadline()
+	return ok && !now.Before(deadline)
+}
+
+// Forfeit ends a match whose deadline has passed with a win for the player
+// who was not holding it up, and returns the movement that pays them the
+// bets staked on it. A free-for-all is settled between the players who
+// revealed by the rules of its mode, see forfeitThrows.
+func Forfeit(rules *Rules, m Match, now time.Time) (Result, error) {
+	if !m.Overdue(now) {
+		return Result{}, ErrNotOverdue
+	}
+
+	if m.FreeForAll() {
+		return forfeitThrows(rules, m, now)
+	}
+
+	loser := m.waitingOn()
+
+	if err := m.record(EventForfeit, "", now); err != nil {
+		return Result{}, err
+	}
+
+	res := Result{
+		Winner:  m.OpponentOf(loser),
+		Loser:   loser,
+		Outcome: OutcomeWin,
+	}
+
+	if res.Winner == m.Host.Username {
+		res.Outcome = OutcomeLoss
+	}
+
+	m.Status = StatusCompleted
+	m.Winner = res.Winner
+	m.Loser = res.Loser
+	m.Forfeit = loser
+
+	if m.BetAmount > 0 {
+		res.Movements = []Movement{
+			{Username: res.Winner, Kind: MovementPayout, Amount: m.BetAmount},
+		}
+	}
+
+	res.Match = m
+
+	return res, nil
+}
+
+// forfeitThrows ends a free-for-all some players did not reveal in time.
+// Their bets are forfeited to the pot, which is split between the players
+// whose revealed throw survived the other revealed throws, or between all
+// the players who revealed when none or all of theirs survived. Every bet is
+// refunded when nobody revealed.
+func forfeitThrows(rules *Rules, m Match, now time.Time) (Result, error) {
+	if err := checkMode(rules, m); err != nil {
+		return Result{}, err
+	}
+
+	if err := m.record(EventForfeit, "", now); err != nil {
+		return Result{}, err
+	}
+
+	var (
+		revealed []int
+		throws   []ItemType
+	)
+
+	for i, p := range m.Players {
+		if p.ItemName != "" {
+			revealed = append(revealed, i)
+			throws = append(throws, ItemType(p.ItemName))
+		}
+	}
+
+	if len(revealed) == 0 {
+		m.Status = StatusDraw
+
+		return Result{Match: m, Outcome: OutcomeDraw, Movements: refunds(m)}, nil
+	}
+
+	winners := revealed
+	if survivors := Survivors(rules, throws); survivors != nil {
+		winners = nil
+		for _, i := range survivors {
+			winners = append(winners, revealed[i])
+		}
+	}
+
+	return splitPot(m, winners), nil
+}
+
+// Forfeited reports whether username lost the match, or their bet on a
+// free-for-all, by not moving in time.
+func (m Match) Forfeited(username string) bool {
+	if !m.FreeForAll() {
+		return m.Forfeit != "" && m.Forfeit == username
+	}
+
+	if m.Status != StatusCompleted || len(m.Transitions) == 0 || m.Transitions[len(m.Transitions)-1].Event != EventForfeit {
+		return false
+	}
+
+	i := m.player(username)
+
+	return i >= 0 && m.Players[i].ItemName == ""
+}
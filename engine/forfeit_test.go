@@ -0,0 +1,181 @@
+package engine
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestForfeitReveal(t *testing.T) {
+	rules := classicRules(t)
+
+	m, _, err := Open(rules, agreedMatch(t, 100, 1), Selection{Username: "alice", ItemName: "rock", Bet: 100}, "salt", testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := m.Deadline(); ok {
+		t.Fatal("deadline before the opponent played")
+	}
+
+	m, _, err = Play(rules, m, Selection{Username: "bob", ItemName: "paper", Bet: 100}, testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	played := m.Transitions[len(m.Transitions)-1].At
+
+	deadline, ok := m.Deadline()
+	if !ok || !deadline.Equal(played.Add(MoveWindow)) {
+		t.Fatalf("deadline %v, want %v after the play", deadline, MoveWindow)
+	}
+
+	if _, err := Forfeit(rules, m, deadline.Add(-time.Second)); !errors.Is(err, ErrNotOverdue) {
+		t.Fatalf("before the deadline: got %v", err)
+	}
+
+	res, err := Forfeit(rules, m, deadline)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Match.Status != StatusCompleted || res.Winner != "bob" || res.Match.Forfeit != "alice" || res.Outcome != OutcomeWin {
+		t.Fatalf("got %s won by %q, forfeited by %q", res.Match.Status, res.Winner, res.Match.Forfeit)
+	}
+
+	if !reflect.DeepEqual(res.Movements, []Movement{{Username: "bob", Kind: MovementPayout, Amount: 200}}) {
+		t.Fatalf("got movements %+v", res.Movements)
+	}
+
+	last := res.Match.Transitions[len(res.Match.Transitions)-1]
+	if last.Event != EventForfeit || last.From != StateAccepted || last.To != StateResolved || last.By != "" {
+		t.Fatalf("logged %+v", last)
+	}
+
+	// the host can no longer reveal the match they forfeited
+	if _, err := Reveal(rules, res.Match, "rock", "salt", testNow); !errors.Is(err, ErrResolved) {
+		t.Fatalf("reveal after forfeit: got %v", err)
+	}
+
+	if _, err := Forfeit(rules, res.Match, deadline); !errors.Is(err, ErrNotOverdue) {
+		t.Fatalf("second forfeit: got %v", err)
+	}
+}
+
+func TestForfeitSeries(t *testing.T) {
+	rules := classicRules(t)
+
+	m := agreedMatch(t, 100, 3)
+
+	// a series has no deadline until its bets are staked
+	opened, _, err := Open(rules, m, Selection{Username: "alice", ItemName: "rock", Bet: 100}, "salt", testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := opened.Deadline(); ok {
+		t.Fatal("deadline on the first round of a series")
+	}
+
+	round := playRound(t, rules, m, "rock", "scissors").Match
+
+	tests := []struct {
+		name   string
+		match  func() Match
+		winner string
+		from   State
+	}{
+		{"host does not commit", func() Match { return round }, "bob", StateNextRound},
+		{"opponent does not play", func() Match {
+			committed, _, err := Open(rules, round, Selection{Username: "alice", ItemName: "paper"}, "salt", testNow)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			return committed
+		}, "alice", StateCommitted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := tt.match()
+
+			deadline, ok := m.Deadline()
+			if !ok {
+				t.Fatal("no deadline")
+			}
+
+			if m.Overdue(deadline.Add(-time.Second)) || m.Expired(deadline) {
+				t.Fatal("overdue before the deadline or expired")
+			}
+
+			res, err := Forfeit(rules, m, deadline)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if res.Winner != tt.winner || res.Match.Forfeit != m.OpponentOf(tt.winner) {
+				t.Fatalf("won by %q, forfeited by %q", res.Winner, res.Match.Forfeit)
+			}
+
+			// the whole pot staked in the first round
+			if !reflect.DeepEqual(res.Movements, []Movement{{Username: tt.winner, Kind: MovementPayout, Amount: 200}}) {
+				t.Fatalf("got movements %+v", res.Movements)
+			}
+
+			if last := res.Match.Transitions[len(res.Match.Transitions)-1]; last.From != tt.from || last.To != StateResolved {
+				t.Fatalf("logged %+v", last)
+			}
+		})
+	}
+}
+
+func TestForfeitTournament(t *testing.T) {
+	rules := classicRules(t)
+
+	m, err := Pair("m1", "t1", ModeClassic, Pairing{Round: 1, Host: "alice", Opponent: "bob"}, testNow, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deadline, ok := m.Deadline()
+	if !ok || !deadline.Equal(testNow.Add(MoveWindow)) {
+		t.Fatalf("deadline %v, want %v after the pairing", deadline, MoveWindow)
+	}
+
+	// alice never commits, bob gets a walkover
+	res, err := Forfeit(rules, m, deadline)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Winner != "bob" || res.Match.Forfeit != "alice" || res.Movements != nil {
+		t.Fatalf("won by %q, forfeited by %q, moved %+v", res.Winner, res.Match.Forfeit, res.Movements)
+	}
+
+	// alice commits, bob never plays, alice gets the walkover
+	committed, _, err := Open(rules, m, Selection{Username: "alice", ItemName: "rock"}, "salt", testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deadline, ok = committed.Deadline()
+	if !ok {
+		t.Fatal("no deadline for the opponent")
+	}
+
+	res, err = Forfeit(rules, committed, deadline)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Winner != "alice" || res.Match.Forfeit != "bob" {
+		t.Fatalf("won by %q, forfeited by %q", res.Winner, res.Match.Forfeit)
+	}
+
+	// a challenge outside a tournament expires rather than being forfeited
+	if _, ok := agreedMatch(t, 100, 1).Deadline(); ok {
+		t.Fatal("deadline on a pending challenge")
+	}
+}
@@ -0,0 +1,77 @@
+package engine
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrClaimed     = errors.New("the challenge was already accepted by another player")
+	ErrOutOfRange  = errors.New("your rating is outside the range the host asked for")
+	ErrRatingRange = errors.New("the lowest rating cannot be above the highest")
+)
+
+// Post returns a new pending match hosted by host without an opponent, for
+// the first player to claim it at the stake the host proposes. Only players
+// rated between minRating and maxRating can claim it, a bound of 0 leaves
+// that side open.
+func Post(id string, mode Mode, host string, now time.Time, ttl time.Duration, bestOf, stake, minRating, maxRating int) (Match, error) {
+	if minRating > 0 && maxRating > 0 && minRating > maxRating {
+		return Match{}, ErrRatingRange
+	}
+
+	m, err := Create(id, mode, host, "", now, ttl, bestOf)
+	if err != nil {
+		return Match{}, err
+	}
+
+	m, err = Propose(m, host, stake, now)
+	if err != nil {
+		return Match{}, err
+	}
+
+	m.MinRating = minRating
+	m.MaxRating = maxRating
+
+	return m, nil
+}
+
+// Unclaimed reports whether the match is a posted challenge nobody has
+// claimed yet.
+func (m Match) Unclaimed() bool {
+	return m.Opponent.Username == "" && !m.FreeForAll()
+}
+
+// InRange reports whether a player with rating can claim the match.
+func (m Match) InRange(rating int) bool {
+	return (m.MinRating <= 0 || rating >= m.MinRating) && (m.MaxRating <= 0 || rating <= m.MaxRating)
+}
+
+// Claim makes username the opponent of a posted challenge, agreeing to the
+// stake the host proposed. The host can then bet as on any other match.
+func Claim(m Match, username string, rating int, now time.Time) (Match, error) {
+	if err := checkPending(m); err != nil {
+		return Match{}, err
+	}
+
+	if !m.Unclaimed() {
+		return Match{}, ErrClaimed
+	}
+
+	if username == m.Host.Username {
+		return Match{}, ErrSelfChallenge
+	}
+
+	if !m.InRange(rating) {
+		return Match{}, ErrOutOfRange
+	}
+
+	if err := m.record(EventClaim, username, now); err != nil {
+		return Match{}, err
+	}
+
+	m.Opponent.Username = username
+	m.StakeAgreed = true
+
+	return m, nil
+}
@@ -0,0 +1,173 @@
+package engine
+
+import "time"
+
+type Status string
+
+const (
+	StatusPending        Status = "pending"
+	StatusAwaitingReveal Status = "awaiting_reveal"
+	StatusDeclined       Status = "declined"
+	StatusDraw           Status = "draw"
+	StatusCompleted      Status = "completed"
+	StatusExpired        Status = "expired"
+	StatusCancelled      Status = "cancelled"
+)
+
+type Outcome string
+
+const (
+	OutcomeWin  Outcome = "win"
+	OutcomeDraw Outcome = "draw"
+	OutcomeLoss Outcome = "loss"
+)
+
+type ItemType string
+
+type Item struct {
+	ID    string   `mapstructure:"_id" json:"_id" validate:"uuid_rfc4122"`     // ID
+	Name  string   `mapstructure:"name" json:"name" validate:"uuid_rfc4122"`   // Name
+	Image string   `mapstructure:"image" json:"image" validate:"uuid_rfc4122"` // Image base64
+	Beats []string `mapstructure:"beats" json:"beats" validate:"uuid_rfc4122"` // Names of the items it defeats
+	Mode  string   `mapstructure:"mode" json:"mode" validate:"uuid_rfc4122"`   // Game mode the item belongs to
+	Order int      `mapstructure:"order" json:"order" validate:"uuid_rfc4122"` // Position in the inventory
+}
+
+type Selection struct {
+	Username   string
+	ItemName   string // Empty for the host until the commitment is revealed
+	Bet        int
+	Commitment string // Host only - hash of the item and a secret salt
+	Salt       string // Host only - disclosed on reveal
+}
+
+type Match struct {
+	ID               string       `mapstructure:"_id" json:"_id" validate:"uuid_rfc4122"`                                       // ID
+	Status           Status       `mapstructure:"status" json:"status" validate:"uuid_rfc4122"`                                 // Status - pending, completed
+	Mode             string       `mapstructure:"mode" json:"mode" validate:"uuid_rfc4122"`                                     // Game mode, classic when empty
+	BetAmount        int          `mapstructure:"bet_amount" json:"bet_amount" validate:"uuid_rfc4122"`                         // Amount in cents
+	Stake            int          `mapstructure:"stake" json:"stake" validate:"uuid_rfc4122"`                                   // Stake each player bets, in cents
+	StakeBy          string       `mapstructure:"stake_by" json:"stake_by" validate:"uuid_rfc4122"`                             // Player who proposed the stake
+	StakeAgreed      bool         `mapstructure:"stake_agreed" json:"stake_agreed" validate:"uuid_rfc4122"`                     // Both players agreed to the stake
+	Host             Selection    `mapstructure:"host" json:"host" validate:"uuid_rfc4122"`                                     // Host selection
+	Opponent         Selection    `mapstructure:"opponent" json:"opponent" validate:"uuid_rfc4122"`                             // Opponent selection
+	Winner           string       `mapstructure:"winner" json:"winner" validate:"uuid_rfc4122"`                                 // Winner username
+	Loser            string       `mapstructure:"loser" json:"loser" validate:"uuid_rfc4122"`                                   // Loser username
+	HostNotified     bool         `mapstructure:"host_notified" json:"host_notified" validate:"uuid_rfc4122"`                   // Host Notified
+	OpponentNotified bool         `mapstructure:"opponent_notified" json:"opponent_notified" validate:"uuid_rfc4122"`           // Opponent Notified
+	Version          int          `mapstructure:"version" json:"version" validate:"uuid_rfc4122"`                               // Incremented on every write
+	CreatedAt        time.Time    `mapstructure:"created_at" json:"created_at" validate:"uuid_rfc4122"`                         // CreatedAt
+	TTL              int          `mapstructure:"ttl" json:"ttl" validate:"uuid_rfc4122"`                                       // Seconds the challenge stays pending, 0 for no limit
+	Transitions      []Transition `mapstructure:"transitions" json:"transitions" validate:"uuid_rfc4122"`                       // Log of the events that led to the status
+	BestOf           int          `mapstructure:"best_of" json:"best_of" validate:"uuid_rfc4122"`                               // Rounds of a series, 0 or 1 for a single throw
+	Rounds           []Round      `mapstructure:"rounds" json:"rounds" validate:"uuid_rfc4122"`                                 // Rounds of a series played so far
+	TournamentID     string       `mapstructure:"tournament_id" json:"tournament_id,omitempty" validate:"uuid_rfc4122"`         // Tournament the match is a pairing of
+	MinRating        int          `mapstructure:"min_rating" json:"min_rating,omitempty" validate:"uuid_rfc4122"`               // Lowest rating that can claim a posted challenge, 0 for any
+	MaxRating        int          `mapstructure:"max_rating" json:"max_rating,omitempty" validate:"uuid_rfc4122"`               // Highest rating that can claim a posted challenge, 0 for any
+	PreviousID       string       `mapstructure:"previous_id" json:"previous_id,omitempty" validate:"uuid_rfc4122"`             // Match this one is a rematch of
+	RematchID        string       `mapstructure:"rematch_id" json:"rematch_id,omitempty" validate:"uuid_rfc4122"`               // Rematch of this match, claimed by whichever player asked first
+	Size             int          `mapstructure:"size" json:"size,omitempty" validate:"uuid_rfc4122"`                           // Players of a free-for-all, 0 for a match between two
+	Players          []Selection  `mapstructure:"players" json:"players,omitempty" validate:"uuid_rfc4122"`                     // Players of a free-for-all in the order they joined, host first
+	Winners          []string     `mapstructure:"winners" json:"winners,omitempty" validate:"uuid_rfc4122"`                     // Players sharing the pot of a free-for-all
+	Notified         []string     `mapstructure:"notified" json:"notified,omitempty" validate:"uuid_rfc4122"`                   // Players of a free-for-all told how it ended
+	Forfeit          string       `mapstructure:"forfeit" json:"forfeit,omitempty" validate:"uuid_rfc4122"`                     // Player who lost by not moving in time
+	DoubleOrNothing  bool         `mapstructure:"double_or_nothing" json:"double_or_nothing,omitempty" validate:"uuid_rfc4122"` // Rematch at twice the stake of the previous match
+}
+
+// Round is a throw of a series that has been revealed.
+type Round struct {
+	Host     string `mapstructure:"host" json:"host" validate:"uuid_rfc4122"`         // Host's item
+	Opponent string `mapstructure:"opponent" json:"opponent" validate:"uuid_rfc4122"` // Opponent's item
+	Winner   string `mapstructure:"winner" json:"winner" validate:"uuid_rfc4122"`     // Winner username, empty on a tie
+}
+
+// ExpiresAt returns when the match expires if it is still pending, and
+// false for a match without a time limit.
+func (m Match) ExpiresAt() (time.Time, bool) {
+	if m.TTL <= 0 || m.CreatedAt.IsZero() {
+		return time.Time{}, false
+	}
+
+	return m.CreatedAt.Add(time.Duration(m.TTL) * time.Second), true
+}
+
+// Expired reports whether the match is pending past its time limit. A
+// series expires only until its first round is played, after that a player
+// who does not move in time forfeits it, see Overdue.
+func (m Match) Expired(now time.Time) bool {
+	expiresAt, ok := m.ExpiresAt()
+	return ok && m.Status == StatusPending && !m.Staked() && !now.Before(expiresAt)
+}
+
+// IsSeries reports whether the match is played over several rounds.
+func (m Match) IsSeries() bool {
+	return m.BestOf > 1
+}
+
+// Staked reports whether both bets are in and the rounds left are played
+// without betting again.
+func (m Match) Staked() bool {
+	return len(m.Rounds) > 0
+}
+
+// NeedsBet reports whether the next move on the match also stakes a bet. The
+// later rounds of a series are played on the bets of the first one, and
+// tournament matches are played for nothing.
+func (m Match) NeedsBet() bool {
+	return !m.Staked() && !(m.StakeAgreed && m.Stake == 0)
+}
+
+// ReplaysTies reports whether a tied round is played again instead of
+// ending the match in a draw.
+func (m Match) ReplaysTies() bool {
+	return m.IsSeries() || m.TournamentID != ""
+}
+
+// Round returns the number of the round being played, starting at 1.
+func (m Match) Round() int {
+	return len(m.Rounds) + 1
+}
+
+// WinsNeeded returns how many rounds a player has to win to take the match.
+func (m Match) WinsNeeded() int {
+	if !m.IsSeries() {
+		return 1
+	}
+
+	return m.BestOf/2 + 1
+}
+
+// Score returns the rounds won by the host and by the opponent. Ties count
+// for neither.
+func (m Match) Score() (host, opponent int) {
+	for _, r := range m.Rounds {
+		switch r.Winner {
+		case m.Host.Username:
+			host++
+		case m.Opponent.Username:
+			opponent++
+		}
+	}
+
+	return host, opponent
+}
+
+// OpponentOf returns the other player of the match than username.
+func (m Match) OpponentOf(username string) string {
+	if username == m.Host.Username {
+		return m.Opponent.Username
+	}
+
+	return m.Host.Username
+}
+
+// Resolved reports whether the match is over, whichever way it ended. No
+// player can bet on a resolved match.
+func (m Match) Resolved() bool {
+	switch m.Status {
+	case StatusCompleted, StatusDraw, StatusDeclined, StatusExpired, StatusCancelled:
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,176 @@
+package engine
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Mode is a variant of the game, identified by the set of items it is
+// played with.
+type Mode string
+
+const (
+	ModeClassic Mode = "classic"
+	ModeRPSLS   Mode = "rpsls"
+	ModeRPS7    Mode = "rps7"
+	ModeRPS15   Mode = "rps15"
+)
+
+// classicItems are the items of the classic game, each beating the one
+// that follows it.
+var classicItems = []string{"rock", "scissors", "paper"}
+
+// cyclicModes are the balanced odd-N tournaments. Every item beats the
+// (N-1)/2 items that follow it in the list, wrapping around at the end.
+var cyclicModes = map[Mode][]string{
+	ModeRPS7: {
+		"rock", "fire", "scissors", "sponge", "paper", "air", "water",
+	},
+	ModeRPS15: {
+		"rock", "fire", "scissors", "snake", "human", "tree", "wolf", "sponge",
+		"paper", "air", "water", "dragon", "devil", "lightning", "gun",
+	},
+}
+
+// Modes returns the built-in game modes.
+func Modes() []Mode {
+	return []Mode{ModeClassic, ModeRPSLS, ModeRPS7, ModeRPS15}
+}
+
+// ParseMode returns the mode named s. Documents written before modes
+// existed have no mode and are classic games.
+func ParseMode(s string) (Mode, error) {
+	if s == "" {
+		return ModeClassic, nil
+	}
+
+	for _, m := range Modes() {
+		if Mode(s) == m {
+			return m, nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown game mode %q", s)
+}
+
+// Title returns the name of the mode shown to players.
+func (m Mode) Title() string {
+	switch m {
+	case ModeClassic:
+		return "Rock Paper Scissors"
+	case ModeRPSLS:
+		return "Rock Paper Scissors Lizard Spock"
+	case ModeRPS7:
+		return "RPS-7"
+	case ModeRPS15:
+		return "RPS-15"
+	}
+
+	return string(m)
+}
+
+// CyclicItems returns the items of the cyclic modes, whose beats relation
+// is derived from the order of their items rather than defined by hand.
+func CyclicItems() []Item {
+	var items []Item
+
+	for _, m := range Modes() {
+		names, ok := cyclicModes[m]
+		if !ok {
+			continue
+		}
+
+		items = append(items, Cyclic(m, names)...)
+	}
+
+	return items
+}
+
+// Cyclic builds a balanced tournament of an odd number of items in which
+// every item beats the (N-1)/2 items that follow it.
+func Cyclic(mode Mode, names []string) []Item {
+	n := len(names)
+	items := make([]Item, n)
+
+	for i, name := range names {
+		items[i] = Item{
+			ID:    ItemID(mode, i+1),
+			Name:  name,
+			Mode:  string(mode),
+			Order: i + 1,
+		}
+
+		for j := 1; j <= (n-1)/2; j++ {
+			items[i].Beats = append(items[i].Beats, names[(i+j)%n])
+		}
+	}
+
+	return items
+}
+
+// Builtin returns the items of mode as the engine defines them, or nil
+// when the beats table of the mode is only stored with its items.
+func Builtin(mode Mode) []Item {
+	if mode == ModeClassic {
+		return Cyclic(mode, classicItems)
+	}
+
+	if names, ok := cyclicModes[mode]; ok {
+		return Cyclic(mode, names)
+	}
+
+	return nil
+}
+
+// WithBuiltin completes the stored items of mode from its built-in
+// definition. Items stored before beats tables existed only have a name,
+// and a store that has none of the items of the mode gets them all.
+func WithBuiltin(items []Item, mode Mode) []Item {
+	builtin := Builtin(mode)
+	if builtin == nil {
+		return items
+	}
+
+	if len(items) == 0 {
+		return builtin
+	}
+
+	res := make([]Item, len(items))
+
+	for i, item := range items {
+		res[i] = item
+
+		for _, b := range builtin {
+			if b.Name != item.Name || len(item.Beats) > 0 {
+				continue
+			}
+
+			res[i].Beats = b.Beats
+
+			if item.Order == 0 {
+				res[i].Order = b.Order
+			}
+		}
+	}
+
+	return res
+}
+
+// ItemID returns the document ID of the item at position order in mode.
+func ItemID(mode Mode, order int) string {
+	return string(mode) + "-" + strconv.Itoa(order)
+}
+
+// ModeItems returns the items of items that belong to mode.
+func ModeItems(items []Item, mode Mode) []Item {
+	var res []Item
+
+	for _, item := range items {
+		m, err := ParseMode(item.Mode)
+		if err == nil && m == mode {
+			res = append(res, item)
+		}
+	}
+
+	return res
+}
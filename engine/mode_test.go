@@ -0,0 +1,115 @@
+package engine
+
+import (
+	"testing"
+)
+
+func TestCyclic(t *testing.T) {
+	for _, n := range []int{3, 5, 7, 15} {
+		names := make([]string, n)
+		for i := range names {
+			names[i] = ItemID("test", i+1)
+		}
+
+		items := Cyclic(ModeRPS7, names)
+
+		if _, err := NewRules(items); err != nil {
+			t.Fatalf("%d items: %v", n, err)
+		}
+
+		for i, item := range items {
+			if len(item.Beats) != (n-1)/2 {
+				t.Fatalf("%d items: %s beats %d", n, item.Name, len(item.Beats))
+			}
+
+			if item.Order != i+1 || item.ID != ItemID(ModeRPS7, i+1) {
+				t.Fatalf("%d items: %+v", n, item)
+			}
+
+			// beats the items that follow it, wrapping around
+			if item.Beats[0] != names[(i+1)%n] {
+				t.Fatalf("%d items: %s beats %s first", n, item.Name, item.Beats[0])
+			}
+		}
+	}
+}
+
+func TestCyclicItems(t *testing.T) {
+	items := CyclicItems()
+
+	for mode, size := range map[Mode]int{ModeRPS7: 7, ModeRPS15: 15} {
+		rules, err := NewRules(ModeItems(items, mode))
+		if err != nil {
+			t.Fatalf("%s: %v", mode, err)
+		}
+
+		if rules.Mode() != mode || len(rules.Items()) != size {
+			t.Fatalf("%s: %d items", mode, len(rules.Items()))
+		}
+	}
+
+	if got := ModeItems(items, ModeClassic); got != nil {
+		t.Fatalf("classic items among the cyclic ones: %+v", got)
+	}
+}
+
+func TestWithBuiltin(t *testing.T) {
+	// the classic items as seeded before modes and beats tables existed
+	legacy := []Item{{ID: "1", Name: "rock"}, {ID: "2", Name: "paper"}, {ID: "3", Name: "scissors"}}
+
+	for name, items := range map[string][]Item{"legacy": legacy, "none": nil} {
+		rules, err := NewRules(WithBuiltin(items, ModeClassic))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		if outcome, err := rules.Resolve("rock", "scissors"); err != nil || outcome != OutcomeLoss {
+			t.Fatalf("%s: rock against scissors is %v: %v", name, outcome, err)
+		}
+	}
+
+	// items that have a beats table keep it
+	stored := Cyclic(ModeClassic, []string{"rock", "scissors", "paper"})
+	stored[0].Image = "rock.png"
+
+	if got := WithBuiltin(stored, ModeClassic); got[0].Image != "rock.png" || len(got) != 3 {
+		t.Fatalf("got %+v", got)
+	}
+
+	if got := WithBuiltin(nil, ModeRPS15); len(got) != 15 {
+		t.Fatalf("got %d RPS-15 items", len(got))
+	}
+
+	if got := WithBuiltin(nil, ModeRPSLS); got != nil {
+		t.Fatalf("built-in RPSLS items %+v", got)
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	if m, err := ParseMode(""); err != nil || m != ModeClassic {
+		t.Fatalf("empty mode: got %s %v", m, err)
+	}
+
+	for _, mode := range Modes() {
+		if m, err := ParseMode(string(mode)); err != nil || m != mode {
+			t.Fatalf("%s: got %s %v", mode, m, err)
+		}
+	}
+
+	if _, err := ParseMode("rps9"); err == nil {
+		t.Fatal("unknown mode parsed")
+	}
+}
+
+func TestCheckMode(t *testing.T) {
+	rules, err := NewRules(ModeItems(CyclicItems(), ModeRPS7))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := agreedMatch(t, 100, 1)
+
+	if _, _, err := Open(rules, m, Selection{Username: "alice", ItemName: "fire", Bet: 100}, "salt", testNow); err != ErrWrongMode {
+		t.Fatalf("got %v, want ErrWrongMode", err)
+	}
+}
@@ -0,0 +1,76 @@
+package engine
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// InitialRating is the rating of a player who has not finished a match yet.
+const InitialRating = 1200
+
+// ratingK is how far a single match moves a rating.
+const ratingK = 32
+
+// Ratings returns the Elo rating of every player of matches, computed by
+// going through the completed and drawn ones in the order they ended.
+// Free-for-alls are not rated. Players missing from the result are rated
+// InitialRating.
+func Ratings(matches []Match) map[string]int {
+	var played []Match
+
+	for _, m := range matches {
+		if (m.Status == StatusCompleted || m.Status == StatusDraw) && !m.FreeForAll() {
+			played = append(played, m)
+		}
+	}
+
+	sort.SliceStable(played, func(i, j int) bool {
+		return endedAt(played[i]).Before(endedAt(played[j]))
+	})
+
+	ratings := make(map[string]float64)
+
+	rating := func(username string) float64 {
+		if r, ok := ratings[username]; ok {
+			return r
+		}
+
+		return InitialRating
+	}
+
+	for _, m := range played {
+		host, opponent := rating(m.Host.Username), rating(m.Opponent.Username)
+
+		// score of the host: 1 for a win, 0.5 for a draw, 0 for a loss
+		score := 0.5
+		switch m.Winner {
+		case m.Host.Username:
+			score = 1
+		case m.Opponent.Username:
+			score = 0
+		}
+
+		expected := 1 / (1 + math.Pow(10, (opponent-host)/400))
+
+		ratings[m.Host.Username] = host + ratingK*(score-expected)
+		ratings[m.Opponent.Username] = opponent - ratingK*(score-expected)
+	}
+
+	rounded := make(map[string]int, len(ratings))
+	for username, r := range ratings {
+		rounded[username] = int(math.Round(r))
+	}
+
+	return rounded
+}
+
+// endedAt returns when the match was resolved, as far as its transition log
+// tells, or when it was created.
+func endedAt(m Match) time.Time {
+	if len(m.Transitions) > 0 {
+		return m.Transitions[len(m.Transitions)-1].At
+	}
+
+	return m.CreatedAt
+}
@@ -0,0 +1,76 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// ended returns a match between alice and bob with the given status and
+// winner, resolved at.
+func ended(status Status, winner string, at time.Time) Match {
+	return Match{
+		Host:        Selection{Username: "alice"},
+		Opponent:    Selection{Username: "bob"},
+		Status:      status,
+		Winner:      winner,
+		CreatedAt:   testNow,
+		Transitions: []Transition{{Event: EventReveal, From: StateAccepted, To: StateResolved, At: at}},
+	}
+}
+
+func TestRatings(t *testing.T) {
+	earlier, later := testNow.Add(time.Hour), testNow.Add(2*time.Hour)
+
+	tests := []struct {
+		name    string
+		matches []Match
+		want    map[string]int
+	}{
+		{"no matches", nil, map[string]int{}},
+		{"win", []Match{ended(StatusCompleted, "alice", earlier)}, map[string]int{"alice": 1216, "bob": 1184}},
+		{"draw", []Match{ended(StatusDraw, "", earlier)}, map[string]int{"alice": 1200, "bob": 1200}},
+		{"unfinished and free-for-all", []Match{
+			ended(StatusPending, "", earlier),
+			ended(StatusDeclined, "", earlier),
+			{Size: 3, Status: StatusCompleted, Winner: "alice", Players: []Selection{{Username: "alice"}, {Username: "bob"}, {Username: "carol"}}},
+		}, map[string]int{}},
+		// bob won first, so alice beating the better rated bob gains more
+		{"in the order they ended", []Match{
+			ended(StatusCompleted, "alice", later),
+			ended(StatusCompleted, "bob", earlier),
+		}, map[string]int{"alice": 1201, "bob": 1199}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Ratings(tt.matches); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRatingsZeroSum(t *testing.T) {
+	var matches []Match
+
+	for i, winner := range []string{"alice", "alice", "bob", "", "alice"} {
+		status := StatusCompleted
+		if winner == "" {
+			status = StatusDraw
+		}
+
+		matches = append(matches, ended(status, winner, testNow.Add(time.Duration(i)*time.Hour)))
+	}
+
+	ratings := Ratings(matches)
+
+	if ratings["alice"] <= ratings["bob"] {
+		t.Fatalf("alice won more but has %v", ratings)
+	}
+
+	// rounding may lose a point between the two
+	if sum := ratings["alice"] + ratings["bob"]; sum < 2*InitialRating-1 || sum > 2*InitialRating+1 {
+		t.Fatalf("ratings sum to %d", sum)
+	}
+}
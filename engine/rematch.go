@@ -0,0 +1,100 @@
+package engine
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrNoRematch = errors.New("only a finished match played for a stake can be rematched")
+	ErrNotPlayer = errors.New("only the players of a match can ask for a rematch")
+	ErrRematched = errors.New("this match was already rematched")
+)
+
+// Rematch returns a new challenge from username to the other player of the
+// finished match prev, in the same mode and over the same number of rounds,
+// linked to prev so that the chain of rematches can be followed. The stake
+// proposed is the one of prev, or twice that when double is set - double or
+// nothing. The other player answers it like any other challenge. A match
+// whose RematchID is set was already rematched.
+func Rematch(id string, prev Match, username string, now time.Time, ttl time.Duration, double bool) (Match, error) {
+	if prev.Status != StatusCompleted && prev.Status != StatusDraw || prev.TournamentID != "" || prev.FreeForAll() || prev.Stake <= 0 {
+		return Match{}, ErrNoRematch
+	}
+
+	if username != prev.Host.Username && username != prev.Opponent.Username {
+		return Match{}, ErrNotPlayer
+	}
+
+	if prev.RematchID != "" {
+		return Match{}, ErrRematched
+	}
+
+	mode := Mode(prev.Mode)
+	if mode == "" {
+		mode = ModeClassic
+	}
+
+	bestOf := prev.BestOf
+	if bestOf < 1 {
+		bestOf = 1
+	}
+
+	m, err := Create(id, mode, username, prev.OpponentOf(username), now, ttl, bestOf)
+	if err != nil {
+		return Match{}, err
+	}
+
+	stake := prev.Stake
+	if double {
+		stake *= 2
+	}
+
+	m, err = Propose(m, username, stake, now)
+	if err != nil {
+		return Match{}, err
+	}
+
+	m.PreviousID = prev.ID
+	m.DoubleOrNothing = double
+
+	return m, nil
+}
+
+// Chain returns the matches of the rematch chain m belongs to, from the
+// match that started it to the latest rematch.
+func Chain(matches []Match, m Match) []Match {
+	byID := make(map[string]Match, len(matches))
+	next := make(map[string]Match, len(matches))
+
+	for _, mm := range matches {
+		byID[mm.ID] = mm
+		if mm.PreviousID != "" {
+			next[mm.PreviousID] = mm
+		}
+	}
+
+	first := m
+	for seen := map[string]bool{first.ID: true}; first.PreviousID != ""; {
+		prev, ok := byID[first.PreviousID]
+		if !ok || seen[prev.ID] {
+			break
+		}
+
+		seen[prev.ID] = true
+		first = prev
+	}
+
+	chain := []Match{first}
+	for seen := map[string]bool{first.ID: true}; ; {
+		n, ok := next[chain[len(chain)-1].ID]
+		if !ok || seen[n.ID] {
+			break
+		}
+
+		seen[n.ID] = true
+		chain = append(chain, n)
+	}
+
+	return chain
+}
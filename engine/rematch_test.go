@@ -0,0 +1,59 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRematch(t *testing.T) {
+	prev := agreedMatch(t, 100, 3)
+	prev.Status = StatusCompleted
+
+	m, err := Rematch("m2", prev, "bob", testNow, time.Hour, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Host.Username != "bob" || m.Opponent.Username != "alice" || m.PreviousID != "m1" || m.BestOf != 3 || !m.DoubleOrNothing {
+		t.Fatalf("got %+v", m)
+	}
+
+	if m.Stake != 200 || m.StakeBy != "bob" {
+		t.Fatalf("%s proposed %d, want 200", m.StakeBy, m.Stake)
+	}
+
+	if _, err := Rematch("m3", prev, "carol", testNow, time.Hour, false); !errors.Is(err, ErrNotPlayer) {
+		t.Fatalf("not a player: got %v", err)
+	}
+
+	pending := agreedMatch(t, 100, 1)
+	if _, err := Rematch("m3", pending, "alice", testNow, time.Hour, false); !errors.Is(err, ErrNoRematch) {
+		t.Fatalf("pending match: got %v", err)
+	}
+
+	prev.RematchID = m.ID
+	if _, err := Rematch("m3", prev, "alice", testNow, time.Hour, false); !errors.Is(err, ErrRematched) {
+		t.Fatalf("rematched match: got %v", err)
+	}
+}
+
+func TestChain(t *testing.T) {
+	first := Match{ID: "m1"}
+	second := Match{ID: "m2", PreviousID: "m1"}
+	third := Match{ID: "m3", PreviousID: "m2"}
+	other := Match{ID: "m4"}
+
+	matches := []Match{third, other, first, second}
+
+	for _, m := range []Match{first, second, third} {
+		chain := Chain(matches, m)
+		if len(chain) != 3 || chain[0].ID != "m1" || chain[1].ID != "m2" || chain[2].ID != "m3" {
+			t.Fatalf("chain of %s: %+v", m.ID, chain)
+		}
+	}
+
+	if chain := Chain(matches, other); len(chain) != 1 {
+		t.Fatalf("chain of a match never rematched: %+v", chain)
+	}
+}
@@ -0,0 +1,130 @@
+package engine
+
+import (
+	"fmt"
+)
+
+// Rules is the beats relation of a game, built from the items it is played
+// with. Each item lists the items it defeats and every pair of distinct
+// items has exactly one winner.
+type Rules struct {
+	mode  Mode
+	items []ItemType
+	beats map[ItemType]map[ItemType]bool
+}
+
+// NewRules builds the rules for items and checks that the relation they
+// describe is complete and consistent: items belong to the same mode, names
+// are unique, items only beat known items other than themselves, and of any
+// two items exactly one beats the other.
+func NewRules(items []Item) (*Rules, error) {
+	if len(items) == 0 {
+		return nil, fmt.Errorf("rules need at least one item")
+	}
+
+	mode, err := ParseMode(items[0].Mode)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Rules{
+		mode:  mode,
+		beats: make(map[ItemType]map[ItemType]bool, len(items)),
+	}
+
+	for _, item := range items {
+		name := ItemType(item.Name)
+
+		m, err := ParseMode(item.Mode)
+		if err != nil {
+			return nil, err
+		}
+
+		if m != mode {
+			return nil, fmt.Errorf("item %q belongs to %s, not %s", name, m, mode)
+		}
+
+		if name == "" {
+			return nil, fmt.Errorf("item %q has no name", item.ID)
+		}
+
+		if _, ok := r.beats[name]; ok {
+			return nil, fmt.Errorf("item %q is defined twice", name)
+		}
+
+		r.items = append(r.items, name)
+		r.beats[name] = make(map[ItemType]bool, len(item.Beats))
+	}
+
+	for _, item := range items {
+		name := ItemType(item.Name)
+
+		for _, beaten := range item.Beats {
+			b := ItemType(beaten)
+
+			if b == name {
+				return nil, fmt.Errorf("item %q beats itself", name)
+			}
+
+			if _, ok := r.beats[b]; !ok {
+				return nil, fmt.Errorf("item %q beats unknown item %q", name, b)
+			}
+
+			r.beats[name][b] = true
+		}
+	}
+
+	for i, a := range r.items {
+		for _, b := range r.items[i+1:] {
+			switch {
+			case r.beats[a][b] && r.beats[b][a]:
+				return nil, fmt.Errorf("items %q and %q beat each other", a, b)
+			case !r.beats[a][b] && !r.beats[b][a]:
+				return nil, fmt.Errorf("no rule between %q and %q", a, b)
+			}
+		}
+	}
+
+	return r, nil
+}
+
+// Mode returns the game mode the rules are for.
+func (r *Rules) Mode() Mode {
+	return r.mode
+}
+
+// Items returns the items of the game in the order they were defined.
+func (r *Rules) Items() []ItemType {
+	return append([]ItemType(nil), r.items...)
+}
+
+// Valid reports whether item is part of the game.
+func (r *Rules) Valid(item ItemType) bool {
+	_, ok := r.beats[item]
+	return ok
+}
+
+// Beats reports whether a defeats b.
+func (r *Rules) Beats(a, b ItemType) bool {
+	return r.beats[a][b]
+}
+
+// Resolve returns the outcome of a throw from the opponent's point of view.
+func (r *Rules) Resolve(host, opponent ItemType) (Outcome, error) {
+	if !r.Valid(host) {
+		return "", fmt.Errorf("unknown item %q", host)
+	}
+
+	if !r.Valid(opponent) {
+		return "", fmt.Errorf("unknown item %q", opponent)
+	}
+
+	switch {
+	case host == opponent:
+		return OutcomeDraw, nil
+	case r.Beats(opponent, host):
+		return OutcomeWin, nil
+	default:
+		return OutcomeLoss, nil
+	}
+}
@@ -0,0 +1,84 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewRulesValidation(t *testing.T) {
+	item := func(name, mode string, beats ...string) Item {
+		return Item{ID: name, Name: name, Mode: mode, Beats: beats}
+	}
+
+	tests := []struct {
+		name  string
+		items []Item
+		err   string
+	}{
+		{"no items", nil, "at least one item"},
+		{"unknown mode", []Item{item("rock", "chess")}, "unknown game mode"},
+		{"mixed modes", []Item{
+			item("rock", "classic", "scissors"),
+			item("scissors", "rpsls"),
+		}, "belongs to rpsls"},
+		{"no name", []Item{item("", "classic")}, "has no name"},
+		{"defined twice", []Item{
+			item("rock", "classic"),
+			item("rock", "classic"),
+		}, "defined twice"},
+		{"beats itself", []Item{item("rock", "classic", "rock")}, "beats itself"},
+		{"beats unknown", []Item{item("rock", "classic", "lizard")}, "unknown item"},
+		{"beat each other", []Item{
+			item("rock", "classic", "scissors"),
+			item("scissors", "classic", "rock"),
+		}, "beat each other"},
+		{"incomplete", []Item{
+			item("rock", "classic", "scissors"),
+			item("scissors", "classic", "paper"),
+			item("paper", "classic"),
+		}, "no rule between"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewRules(tt.items)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("got %v, want an error containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	rules := classicRules(t)
+
+	if rules.Mode() != ModeClassic {
+		t.Fatalf("mode %s", rules.Mode())
+	}
+
+	tests := []struct {
+		host, opponent ItemType
+		want           Outcome
+	}{
+		{"rock", "scissors", OutcomeLoss},
+		{"rock", "paper", OutcomeWin},
+		{"scissors", "paper", OutcomeLoss},
+		{"paper", "scissors", OutcomeWin},
+		{"paper", "paper", OutcomeDraw},
+	}
+
+	for _, tt := range tests {
+		got, err := rules.Resolve(tt.host, tt.opponent)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got != tt.want {
+			t.Fatalf("%s against %s: got %s, want %s", tt.host, tt.opponent, got, tt.want)
+		}
+	}
+
+	if _, err := rules.Resolve("rock", "lizard"); err == nil {
+		t.Fatal("unknown item resolved")
+	}
+}
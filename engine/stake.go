@@ -0,0 +1,79 @@
+package engine
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrStakeNotAgreed = errors.New("stake has not been agreed yet")
+	ErrStakeAgreed    = errors.New("stake has already been agreed")
+	ErrStakeMismatch  = errors.New("bet does not match the agreed stake")
+	ErrOwnProposal    = errors.New("the other player has to answer the proposed stake")
+)
+
+// Propose offers amount as the stake each player bets on a pending match.
+// The host makes the first proposal when challenging, after that each
+// proposal is a counter-offer to the one the other player made.
+func Propose(m Match, username string, amount int, now time.Time) (Match, error) {
+	if err := checkNegotiable(m, username); err != nil {
+		return Match{}, err
+	}
+
+	if m.StakeBy == username {
+		return Match{}, ErrOwnProposal
+	}
+
+	if amount <= 0 {
+		return Match{}, ErrInvalidBet
+	}
+
+	if err := m.record(EventPropose, username, now); err != nil {
+		return Match{}, err
+	}
+
+	m.Stake = amount
+	m.StakeBy = username
+
+	return m, nil
+}
+
+// AgreeStake accepts the stake the other player proposed. The host can
+// place a bet once it is agreed.
+func AgreeStake(m Match, username string, now time.Time) (Match, error) {
+	if err := checkNegotiable(m, username); err != nil {
+		return Match{}, err
+	}
+
+	if m.StakeBy == "" || m.Stake <= 0 {
+		return Match{}, ErrStakeNotAgreed
+	}
+
+	if m.StakeBy == username {
+		return Match{}, ErrOwnProposal
+	}
+
+	if err := m.record(EventAgree, username, now); err != nil {
+		return Match{}, err
+	}
+
+	m.StakeAgreed = true
+
+	return m, nil
+}
+
+func checkNegotiable(m Match, username string) error {
+	if err := checkPending(m); err != nil {
+		return err
+	}
+
+	if username != m.Host.Username && username != m.Opponent.Username {
+		return ErrNotParticipant
+	}
+
+	if m.StakeAgreed {
+		return ErrStakeAgreed
+	}
+
+	return nil
+}
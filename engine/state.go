@@ -0,0 +1,205 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrInvalidTransition = errors.New("transition not allowed")
+	ErrLogRewritten      = errors.New("transition log can only be appended to")
+)
+
+// State is the stage of a match in its state machine. It is derived from
+// the Status and the host's commitment, so matches stored before the state
+// machine was introduced have one too.
+type State string
+
+const (
+	StateCreated   State = "created"        // Stake being agreed, no bet yet
+	StateCommitted State = "host_committed" // Host bet and committed to an item
+	StateAccepted  State = "accepted"       // Opponent played, waiting for the reveal
+	StateNextRound State = "next_round"     // Round of a series over, the host picks again
+	StateResolved  State = "resolved"       // Won, lost or drawn
+	StateDeclined  State = "declined"
+	StateExpired   State = "expired"
+	StateCancelled State = "cancelled"
+)
+
+// Event is what a player, or the clock, does to a match.
+type Event string
+
+const (
+	EventCreate  Event = "create"
+	EventPropose Event = "propose_stake"
+	EventAgree   Event = "agree_stake"
+	EventClaim   Event = "claim"
+	EventCommit  Event = "commit"
+	EventPlay    Event = "play"
+	EventReveal  Event = "reveal"
+	EventRound   Event = "finish_round"
+	EventDecline Event = "decline"
+	EventCancel  Event = "cancel"
+	EventExpire  Event = "expire"
+	EventForfeit Event = "forfeit"
+
+	// free-for-all
+	EventThrow       Event = "throw"
+	EventLastThrow   Event = "last_throw"
+	EventRevealThrow Event = "reveal_throw"
+)
+
+// transitions lists the state each event leads to from the states it is
+// allowed in. Any event missing from a state is refused.
+var transitions = map[State]map[Event]State{
+	"": {
+		EventCreate: StateCreated,
+	},
+	StateCreated: {
+		EventPropose:   StateCreated,
+		EventAgree:     StateCreated,
+		EventClaim:     StateCreated,
+		EventThrow:     StateCreated,
+		EventLastThrow: StateAccepted,
+		EventCommit:    StateCommitted,
+		EventDecline:   StateDeclined,
+		EventCancel:    StateCancelled,
+		EventExpire:    StateExpired,
+		EventForfeit:   StateResolved,
+	},
+	StateCommitted: {
+		EventPlay:    StateAccepted,
+		EventDecline: StateDeclined,
+		EventCancel:  StateCancelled,
+		EventExpire:  StateExpired,
+		EventForfeit: StateResolved,
+	},
+	StateAccepted: {
+		EventReveal:      StateResolved,
+		EventRound:       StateNextRound,
+		EventRevealThrow: StateAccepted,
+		EventForfeit:     StateResolved,
+	},
+	StateNextRound: {
+		EventCommit:  StateCommitted,
+		EventForfeit: StateResolved,
+	},
+}
+
+// Transition is an entry of the log every match keeps of what happened to
+// it. Entries are only ever appended.
+type Transition struct {
+	Event Event     `mapstructure:"event" json:"event" validate:"uuid_rfc4122"` // Event
+	From  State     `mapstructure:"from" json:"from" validate:"uuid_rfc4122"`   // State before the event
+	To    State     `mapstructure:"to" json:"to" validate:"uuid_rfc4122"`       // State after the event
+	By    string    `mapstructure:"by" json:"by" validate:"uuid_rfc4122"`       // Player who made it, empty for an expiry or a forfeit
+	At    time.Time `mapstructure:"at" json:"at" validate:"uuid_rfc4122"`       // Timestamp
+}
+
+// State returns the stage of the match in its state machine.
+func (m Match) State() State {
+	switch m.Status {
+	case "":
+		return ""
+	case StatusPending:
+		if m.Host.Commitment != "" {
+			return StateCommitted
+		}
+
+		if m.Staked() {
+			return StateNextRound
+		}
+
+		return StateCreated
+	case StatusAwaitingReveal:
+		return StateAccepted
+	case StatusCompleted, StatusDraw:
+		return StateResolved
+	}
+
+	return State(m.Status)
+}
+
+// record checks that e is allowed in the current state of the match and
+// appends it to the transition log. It is called before the match is
+// changed, so From is the state the event applies to.
+func (m *Match) record(e Event, by string, at time.Time) error {
+	from := m.State()
+
+	to, ok := transitions[from][e]
+	if !ok {
+		return fmt.Errorf("%w: %s on a %s match", ErrInvalidTransition, e, from)
+	}
+
+	// copies of the match never share the entry appended here
+	log := m.Transitions[:len(m.Transitions):len(m.Transitions)]
+
+	m.Transitions = append(log, Transition{
+		Event: e,
+		From:  from,
+		To:    to,
+		By:    by,
+		At:    at,
+	})
+
+	return nil
+}
+
+// CheckLog returns ErrLogRewritten unless the transition log of m starts with
+// the whole log of prev, the version of the match it replaces.
+func (m Match) CheckLog(prev Match) error {
+	if len(m.Transitions) < len(prev.Transitions) {
+		return ErrLogRewritten
+	}
+
+	for i, t := range prev.Transitions {
+		n := m.Transitions[i]
+		if n.Event != t.Event || n.From != t.From || n.To != t.To || n.By != t.By || !n.At.Equal(t.At) {
+			return ErrLogRewritten
+		}
+	}
+
+	return nil
+}
+
+// CheckHistory returns ErrLogRewritten unless the transition log of m is a
+// path through the state machine: every entry follows the one before it in
+// time and state, and it ends in the state the match is in. A match stored
+// before the log was kept has none, or starts it in the state it was in.
+func (m Match) CheckHistory() error {
+	if len(m.Transitions) == 0 {
+		return nil
+	}
+
+	var prev Transition
+
+	for i, t := range m.Transitions {
+		to, ok := transitions[t.From][t.Event]
+		if !ok || to != t.To {
+			return fmt.Errorf("%w: %s on a %s match", ErrLogRewritten, t.Event, t.From)
+		}
+
+		if i > 0 && (t.From != prev.To || t.At.Before(prev.At)) {
+			return fmt.Errorf("%w: %s does not follow %s", ErrLogRewritten, t.Event, prev.Event)
+		}
+
+		prev = t
+	}
+
+	if prev.To != m.State() {
+		return fmt.Errorf("%w: the log ends in %s, the match is %s", ErrLogRewritten, prev.To, m.State())
+	}
+
+	return nil
+}
+
+// String returns the name of the state, "new" for a match that is not
+// created yet.
+func (s State) String() string {
+	if s == "" {
+		return "new"
+	}
+
+	return string(s)
+}
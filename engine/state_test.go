@@ -0,0 +1,196 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTransitionTable(t *testing.T) {
+	// every event in every state, refused unless the table lists it
+	events := []Event{
+		EventCreate, EventPropose, EventAgree, EventClaim, EventCommit,
+		EventPlay, EventReveal, EventRound, EventDecline, EventCancel,
+		EventExpire, EventForfeit, EventThrow, EventLastThrow, EventRevealThrow,
+	}
+
+	states := []State{
+		"", StateCreated, StateCommitted, StateAccepted, StateNextRound,
+		StateResolved, StateDeclined, StateExpired, StateCancelled,
+	}
+
+	for _, from := range states {
+		for _, e := range events {
+			m := matchIn(from)
+
+			want, allowed := transitions[from][e]
+
+			err := m.record(e, "alice", testNow)
+			if !allowed {
+				if !errors.Is(err, ErrInvalidTransition) {
+					t.Fatalf("%s on %s: got %v, want ErrInvalidTransition", e, from, err)
+				}
+
+				if len(m.Transitions) != 0 {
+					t.Fatalf("%s on %s: refused event logged", e, from)
+				}
+
+				continue
+			}
+
+			if err != nil {
+				t.Fatalf("%s on %s: %v", e, from, err)
+			}
+
+			got := m.Transitions[len(m.Transitions)-1]
+			if got.Event != e || got.From != from || got.To != want || got.By != "alice" || !got.At.Equal(testNow) {
+				t.Fatalf("%s on %s: logged %+v", e, from, got)
+			}
+		}
+	}
+
+	// states a match ends in accept nothing
+	for _, end := range []State{StateResolved, StateDeclined, StateExpired, StateCancelled} {
+		if len(transitions[end]) != 0 {
+			t.Fatalf("%s has transitions %v", end, transitions[end])
+		}
+	}
+}
+
+// matchIn returns a match whose State is s.
+func matchIn(s State) Match {
+	switch s {
+	case "":
+		return Match{}
+	case StateCreated:
+		return Match{Status: StatusPending}
+	case StateCommitted:
+		return Match{Status: StatusPending, Host: Selection{Commitment: "c"}}
+	case StateAccepted:
+		return Match{Status: StatusAwaitingReveal}
+	case StateNextRound:
+		return Match{Status: StatusPending, Rounds: []Round{{}}}
+	case StateResolved:
+		return Match{Status: StatusCompleted}
+	}
+
+	return Match{Status: Status(s)}
+}
+
+func TestState(t *testing.T) {
+	for _, s := range []State{
+		"", StateCreated, StateCommitted, StateAccepted, StateNextRound,
+		StateResolved, StateDeclined, StateExpired, StateCancelled,
+	} {
+		if got := matchIn(s).State(); got != s {
+			t.Fatalf("got %s, want %s", got, s)
+		}
+	}
+
+	if got := (Match{Status: StatusDraw}).State(); got != StateResolved {
+		t.Fatalf("draw is %s", got)
+	}
+
+	if State("").String() != "new" {
+		t.Fatalf("empty state is %q", State("").String())
+	}
+}
+
+func TestCheckLog(t *testing.T) {
+	m := agreedMatch(t, 100, 1)
+
+	prev := m
+	if err := m.record(EventDecline, "bob", testNow); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.CheckLog(prev); err != nil {
+		t.Fatalf("appended log: %v", err)
+	}
+
+	// the entry appended to m is not shared with prev
+	if len(prev.Transitions) != len(m.Transitions)-1 {
+		t.Fatalf("prev has %d entries", len(prev.Transitions))
+	}
+
+	if err := prev.CheckLog(m); !errors.Is(err, ErrLogRewritten) {
+		t.Fatalf("dropped entry: got %v", err)
+	}
+
+	changed := m
+	changed.Transitions = append([]Transition(nil), m.Transitions...)
+	changed.Transitions[0].At = testNow.Add(time.Hour)
+
+	if err := changed.CheckLog(prev); !errors.Is(err, ErrLogRewritten) {
+		t.Fatalf("changed entry: got %v", err)
+	}
+}
+
+func TestCheckHistory(t *testing.T) {
+	rules := classicRules(t)
+
+	played := agreedMatch(t, 100, 3)
+
+	played, _, err := Open(rules, played, Selection{Username: "alice", ItemName: "rock", Bet: 100}, "salt", testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	played, _, err = Play(rules, played, Selection{Username: "bob", ItemName: "scissors", Bet: 100}, testNow.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := Reveal(rules, played, "rock", "salt", testNow.Add(2*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	played = result.Match
+
+	// rewrite returns played with its log changed by change
+	rewrite := func(change func(log []Transition) []Transition) Match {
+		m := played
+		m.Transitions = change(append([]Transition(nil), played.Transitions...))
+
+		return m
+	}
+
+	won := agreedMatch(t, 100, 1)
+	won.Status = StatusCompleted
+	won.Winner = "alice"
+
+	tests := []struct {
+		name string
+		m    Match
+		want error
+	}{
+		{"a match played", played, nil},
+		{"a match stored before the log", Match{Status: StatusCompleted}, nil},
+		{"a log started on a match already created", Match{Status: StatusDeclined, Transitions: []Transition{{Event: EventDecline, From: StateCreated, To: StateDeclined}}}, nil},
+		{"an event leading elsewhere", rewrite(func(log []Transition) []Transition {
+			log[len(log)-1].To = StateCancelled
+			return log
+		}), ErrLogRewritten},
+		{"an event refused in its state", rewrite(func(log []Transition) []Transition {
+			log[len(log)-1].Event = EventDecline
+			return log
+		}), ErrLogRewritten},
+		{"an entry left out", rewrite(func(log []Transition) []Transition {
+			return append(log[:3], log[4:]...)
+		}), ErrLogRewritten},
+		{"an entry backdated", rewrite(func(log []Transition) []Transition {
+			log[len(log)-1].At = testNow.Add(-time.Minute)
+			return log
+		}), ErrLogRewritten},
+		{"an outcome the log does not lead to", won, ErrLogRewritten},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.m.CheckHistory(); !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,328 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+var (
+	ErrTournamentMatch = errors.New("tournament matches cannot be declined or cancelled")
+	ErrTooFewPlayers   = errors.New("a tournament needs at least two players")
+)
+
+// Format is how the players of a tournament are paired.
+type Format string
+
+const (
+	FormatSingleElimination Format = "single_elimination"
+	FormatRoundRobin        Format = "round_robin"
+)
+
+// Formats returns the tournament formats in the order they are offered.
+func Formats() []Format {
+	return []Format{FormatSingleElimination, FormatRoundRobin}
+}
+
+// ParseFormat returns the format named s.
+func ParseFormat(s string) (Format, error) {
+	for _, f := range Formats() {
+		if string(f) == s {
+			return f, nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown tournament format %q", s)
+}
+
+func (f Format) Title() string {
+	switch f {
+	case FormatSingleElimination:
+		return "Single Elimination"
+	case FormatRoundRobin:
+		return "Round Robin"
+	}
+
+	return string(f)
+}
+
+// Pairing is a match of a tournament. A pairing without an opponent is a
+// bye, won by the host without playing.
+type Pairing struct {
+	Round    int    `mapstructure:"round" json:"round" validate:"uuid_rfc4122"`       // Round of the tournament, starting at 1
+	Host     string `mapstructure:"host" json:"host" validate:"uuid_rfc4122"`         // Host username
+	Opponent string `mapstructure:"opponent" json:"opponent" validate:"uuid_rfc4122"` // Opponent username, empty for a bye
+	MatchID  string `mapstructure:"match_id" json:"match_id" validate:"uuid_rfc4122"` // Match played, empty for a bye
+	Winner   string `mapstructure:"winner" json:"winner" validate:"uuid_rfc4122"`     // Winner username once the match is resolved
+}
+
+// Bye reports whether the pairing is a bye.
+func (p Pairing) Bye() bool {
+	return p.Opponent == ""
+}
+
+// Loser returns the player who lost the pairing, empty for a bye or a
+// pairing not decided yet.
+func (p Pairing) Loser() string {
+	switch p.Winner {
+	case "":
+		return ""
+	case p.Host:
+		return p.Opponent
+	}
+
+	return p.Host
+}
+
+// Bracket returns the first round of a single elimination bracket. Players
+// are seeded in the order given and placed the standard way, the top seed
+// against the lowest, so that the top two seeds can only meet in the final.
+// When their number is not a power of two, the top seeds get a bye into the
+// second round in place of the lowest seeds.
+func Bracket(players []string) ([]Pairing, error) {
+	if len(players) < 2 {
+		return nil, ErrTooFewPlayers
+	}
+
+	var pairings []Pairing
+
+	seeds := seedOrder(len(players))
+
+	for i := 0; i < len(seeds); i += 2 {
+		host, opponent := seeds[i], seeds[i+1]
+
+		// seeds past the last player are byes
+		if opponent >= len(players) {
+			pairings = append(pairings, Pairing{
+				Round:  1,
+				Host:   players[host],
+				Winner: players[host],
+			})
+			continue
+		}
+
+		pairings = append(pairings, Pairing{
+			Round:    1,
+			Host:     players[host],
+			Opponent: players[opponent],
+		})
+	}
+
+	return pairings, nil
+}
+
+// seedOrder returns the seeds, counted from 0, in the order they are placed
+// in a bracket big enough for players, the smallest power of two that fits
+// them. Each pair of the order is a match of the first round with the better
+// seed first, and the winners of neighbouring pairs meet in the next round.
+func seedOrder(players int) []int {
+	order := []int{0}
+
+	for len(order) < players {
+		size := len(order) * 2
+		next := make([]int, 0, size)
+
+		for _, seed := range order {
+			next = append(next, seed, size-1-seed)
+		}
+
+		order = next
+	}
+
+	return order
+}
+
+// NextRound pairs the winners of round of a single elimination bracket in
+// the order of their pairings. It returns nothing while a pairing of the
+// round is not decided, and when the round was the final.
+func NextRound(pairings []Pairing, round int) []Pairing {
+	var winners []string
+
+	for _, p := range pairings {
+		if p.Round != round {
+			continue
+		}
+
+		if p.Winner == "" {
+			return nil
+		}
+
+		winners = append(winners, p.Winner)
+	}
+
+	var next []Pairing
+
+	for i := 0; i+1 < len(winners); i += 2 {
+		next = append(next, Pairing{
+			Round:    round + 1,
+			Host:     winners[i],
+			Opponent: winners[i+1],
+		})
+	}
+
+	return next
+}
+
+// RoundRobin returns the pairings of a tournament where every player meets
+// every other one once, spread over rounds with the circle method so that
+// nobody plays twice in a round.
+func RoundRobin(players []string) ([]Pairing, error) {
+	if len(players) < 2 {
+		return nil, ErrTooFewPlayers
+	}
+
+	circle := append([]string{}, players...)
+	if len(circle)%2 == 1 {
+		circle = append(circle, "")
+	}
+
+	n := len(circle)
+
+	var pairings []Pairing
+
+	for round := 1; round < n; round++ {
+		for i := 0; i < n/2; i++ {
+			host, opponent := circle[i], circle[n-1-i]
+			if host == "" || opponent == "" {
+				continue
+			}
+
+			// alternate who hosts so that nobody always commits first
+			if round%2 == 0 {
+				host, opponent = opponent, host
+			}
+
+			pairings = append(pairings, Pairing{
+				Round:    round,
+				Host:     host,
+				Opponent: opponent,
+			})
+		}
+
+		// keep the first player in place and rotate the others
+		circle = append([]string{circle[0], circle[n-1]}, circle[1:n-1]...)
+	}
+
+	return pairings, nil
+}
+
+// Decided reports whether every pairing has a winner.
+func Decided(pairings []Pairing) bool {
+	for _, p := range pairings {
+		if p.Winner == "" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Placings returns the players of a finished tournament grouped by the place
+// they finished in, best first. Players who share a place are in the same
+// group. In single elimination only the winner and the runner-up are
+// placed; in round robin players are placed by the number of matches won.
+func Placings(format Format, players []string, pairings []Pairing) [][]string {
+	if len(pairings) == 0 {
+		return nil
+	}
+
+	if format == FormatSingleElimination {
+		final := pairings[0]
+		for _, p := range pairings {
+			if p.Round > final.Round {
+				final = p
+			}
+		}
+
+		return [][]string{{final.Winner}, {final.Loser()}}
+	}
+
+	wins := make(map[string]int)
+	for _, p := range pairings {
+		if !p.Bye() && p.Winner != "" {
+			wins[p.Winner]++
+		}
+	}
+
+	ranked := append([]string{}, players...)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return wins[ranked[i]] > wins[ranked[j]]
+	})
+
+	var placings [][]string
+
+	for i, p := range ranked {
+		if i > 0 && wins[p] == wins[ranked[i-1]] {
+			placings[len(placings)-1] = append(placings[len(placings)-1], p)
+			continue
+		}
+
+		placings = append(placings, []string{p})
+	}
+
+	return placings
+}
+
+// prizeShares are the percentages of the prize pool paid to the first
+// places. A tournament of two players pays it all to the winner.
+var prizeShares = []int{70, 30}
+
+// Prizes splits pool between the players placed first and second. Players
+// who share a place split the shares of the places they take up equally,
+// and the cents that do not split evenly go to the first of them, so the
+// whole pool is always paid out.
+func Prizes(pool int, players int, placings [][]string) map[string]int {
+	shares := prizeShares
+	if players <= 2 {
+		shares = []int{100}
+	}
+
+	prizes := make(map[string]int)
+	paid := 0
+	place := 0
+
+	for _, group := range placings {
+		if place >= len(shares) {
+			break
+		}
+
+		var percent int
+		for i := place; i < place+len(group) && i < len(shares); i++ {
+			percent += shares[i]
+		}
+
+		amount := pool * percent / 100
+		for i, p := range group {
+			prizes[p] += amount / len(group)
+			if i == 0 {
+				prizes[p] += amount % len(group)
+			}
+		}
+
+		paid += amount
+		place += len(group)
+	}
+
+	// rounding leftovers go to the winner
+	if len(placings) > 0 && len(placings[0]) > 0 {
+		prizes[placings[0][0]] += pool - paid
+	}
+
+	return prizes
+}
+
+// Pair returns the match a pairing of tournament is played in. Tournament
+// matches are played for nothing, the entry fees make the prize, and a tied
+// round is played again until one of the players wins.
+func Pair(id, tournament string, mode Mode, p Pairing, now time.Time, bestOf int) (Match, error) {
+	m, err := Create(id, mode, p.Host, p.Opponent, now, 0, bestOf)
+	if err != nil {
+		return Match{}, err
+	}
+
+	m.TournamentID = tournament
+	m.StakeAgreed = true
+
+	return m, nil
+}
@@ -0,0 +1,210 @@
+package engine
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func players(n int) []string {
+	names := []string{"s1", "s2", "s3", "s4", "s5", "s6", "s7", "s8"}
+	return names[:n]
+}
+
+func TestBracket(t *testing.T) {
+	if _, err := Bracket(players(1)); !errors.Is(err, ErrTooFewPlayers) {
+		t.Fatalf("got %v, want ErrTooFewPlayers", err)
+	}
+
+	tests := []struct {
+		players int
+		want    []Pairing
+	}{
+		{2, []Pairing{
+			{Round: 1, Host: "s1", Opponent: "s2"},
+		}},
+		{3, []Pairing{
+			{Round: 1, Host: "s1", Winner: "s1"},
+			{Round: 1, Host: "s2", Opponent: "s3"},
+		}},
+		{5, []Pairing{
+			{Round: 1, Host: "s1", Winner: "s1"},
+			{Round: 1, Host: "s4", Opponent: "s5"},
+			{Round: 1, Host: "s2", Winner: "s2"},
+			{Round: 1, Host: "s3", Winner: "s3"},
+		}},
+		{6, []Pairing{
+			{Round: 1, Host: "s1", Winner: "s1"},
+			{Round: 1, Host: "s4", Opponent: "s5"},
+			{Round: 1, Host: "s2", Winner: "s2"},
+			{Round: 1, Host: "s3", Opponent: "s6"},
+		}},
+		{8, []Pairing{
+			{Round: 1, Host: "s1", Opponent: "s8"},
+			{Round: 1, Host: "s4", Opponent: "s5"},
+			{Round: 1, Host: "s2", Opponent: "s7"},
+			{Round: 1, Host: "s3", Opponent: "s6"},
+		}},
+	}
+
+	for _, tt := range tests {
+		got, err := Bracket(players(tt.players))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("%d players: got %+v, want %+v", tt.players, got, tt.want)
+		}
+	}
+}
+
+// TestBracketTopSeedsMeetInFinal plays out brackets where the better seed
+// always wins and checks the final is between the top two seeds.
+func TestBracketTopSeedsMeetInFinal(t *testing.T) {
+	for n := 2; n <= 8; n++ {
+		pairings, err := Bracket(players(n))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		round := 1
+
+		for {
+			for i, p := range pairings {
+				if p.Round == round && p.Winner == "" {
+					pairings[i].Winner = p.Host
+				}
+			}
+
+			next := NextRound(pairings, round)
+			if next == nil {
+				break
+			}
+
+			pairings = append(pairings, next...)
+			round++
+		}
+
+		final := pairings[len(pairings)-1]
+		if final.Host != "s1" || final.Opponent != "s2" {
+			t.Fatalf("%d players: final %+v", n, final)
+		}
+
+		if placings := Placings(FormatSingleElimination, players(n), pairings); !reflect.DeepEqual(placings, [][]string{{"s1"}, {"s2"}}) {
+			t.Fatalf("%d players: placings %v", n, placings)
+		}
+	}
+}
+
+func TestNextRoundWaitsForWinners(t *testing.T) {
+	pairings, err := Bracket(players(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pairings[0].Winner = "s4"
+
+	if next := NextRound(pairings, 1); next != nil {
+		t.Fatalf("next round before the round is decided: %+v", next)
+	}
+
+	pairings[1].Winner = "s2"
+
+	want := []Pairing{{Round: 2, Host: "s4", Opponent: "s2"}}
+	if next := NextRound(pairings, 1); !reflect.DeepEqual(next, want) {
+		t.Fatalf("got %+v, want %+v", next, want)
+	}
+}
+
+func TestRoundRobin(t *testing.T) {
+	for n := 2; n <= 7; n++ {
+		pairings, err := RoundRobin(players(n))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		met := make(map[[2]string]bool)
+		busy := make(map[int]map[string]bool)
+
+		for _, p := range pairings {
+			key := [2]string{p.Host, p.Opponent}
+			if p.Host > p.Opponent {
+				key = [2]string{p.Opponent, p.Host}
+			}
+
+			if met[key] {
+				t.Fatalf("%d players: %v meet twice", n, key)
+			}
+
+			met[key] = true
+
+			if busy[p.Round] == nil {
+				busy[p.Round] = make(map[string]bool)
+			}
+
+			for _, player := range key {
+				if busy[p.Round][player] {
+					t.Fatalf("%d players: %s plays twice in round %d", n, player, p.Round)
+				}
+
+				busy[p.Round][player] = true
+			}
+		}
+
+		if len(met) != n*(n-1)/2 {
+			t.Fatalf("%d players: %d pairings", n, len(met))
+		}
+	}
+}
+
+func TestRoundRobinPlacings(t *testing.T) {
+	pairings := []Pairing{
+		{Round: 1, Host: "s1", Opponent: "s2", Winner: "s1"},
+		{Round: 2, Host: "s3", Opponent: "s1", Winner: "s3"},
+		{Round: 3, Host: "s2", Opponent: "s3", Winner: "s3"},
+		{Round: 1, Host: "s4", Opponent: "s2", Winner: "s4"},
+	}
+
+	got := Placings(FormatRoundRobin, players(4), pairings)
+	want := [][]string{{"s3"}, {"s1", "s4"}, {"s2"}}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestPrizes(t *testing.T) {
+	tests := []struct {
+		name     string
+		pool     int
+		players  int
+		placings [][]string
+		want     map[string]int
+	}{
+		{"two players", 200, 2, [][]string{{"s1"}, {"s2"}}, map[string]int{"s1": 200}},
+		{"first and second", 1000, 4, [][]string{{"s1"}, {"s2"}}, map[string]int{"s1": 700, "s2": 300}},
+		{"rounding to the winner", 333, 3, [][]string{{"s1"}, {"s2"}, {"s3"}}, map[string]int{"s1": 234, "s2": 99}},
+		{"shared first place", 1001, 4, [][]string{{"s1", "s2"}, {"s3"}}, map[string]int{"s1": 501, "s2": 500}},
+		{"shared second place", 1000, 4, [][]string{{"s1"}, {"s2", "s3"}, {"s4"}}, map[string]int{"s1": 700, "s2": 150, "s3": 150}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Prizes(tt.pool, tt.players, tt.placings)
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+
+			var paid int
+			for _, amount := range got {
+				paid += amount
+			}
+
+			if paid != tt.pool {
+				t.Fatalf("paid %d of %d", paid, tt.pool)
+			}
+		})
+	}
+}
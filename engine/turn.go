@@ -0,0 +1,63 @@
+package engine
+
+import "errors"
+
+var (
+	ErrResolved       = errors.New("match is already over")
+	ErrAwaitingReveal = errors.New("match is waiting for the host to reveal")
+)
+
+// CanBet reports whether username is the player the match is waiting for a
+// bet from: the host once the stake is agreed, then the opponent once the
+// host has committed. A free-for-all takes a bet from every player who has
+// not thrown yet while there is room. Any other player, or any bet on a
+// match that has moved on, gets an error telling why.
+func CanBet(m Match, username string) error {
+	if m.FreeForAll() {
+		return canThrow(m, username)
+	}
+
+	if username != m.Host.Username && username != m.Opponent.Username {
+		return ErrNotParticipant
+	}
+
+	if m.Status == StatusAwaitingReveal {
+		return ErrAwaitingReveal
+	}
+
+	if err := checkPending(m); err != nil {
+		return err
+	}
+
+	if m.Host.Commitment == "" {
+		if username != m.Host.Username {
+			return ErrNoHostBet
+		}
+
+		if !m.StakeAgreed {
+			return ErrStakeNotAgreed
+		}
+
+		return nil
+	}
+
+	if username != m.Opponent.Username {
+		return ErrAlreadyBet
+	}
+
+	return nil
+}
+
+// checkPending returns ErrResolved for a match that is over and
+// ErrNotPending for any other match that is not pending.
+func checkPending(m Match) error {
+	if m.Resolved() {
+		return ErrResolved
+	}
+
+	if m.Status != StatusPending {
+		return ErrNotPending
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCanBet(t *testing.T) {
+	created := Match{Host: Selection{Username: "alice"}, Opponent: Selection{Username: "bob"}, Status: StatusPending}
+
+	agreed := created
+	agreed.StakeAgreed = true
+
+	committed := agreed
+	committed.Host.Commitment = "c1"
+
+	awaiting := committed
+	awaiting.Status = StatusAwaitingReveal
+
+	ffa := Match{Size: 3, Status: StatusPending, Players: []Selection{{Username: "alice", Commitment: "c1"}, {Username: "bob"}}}
+
+	full := ffa
+	full.Players = append(full.Players, Selection{Username: "carol"})
+
+	type test struct {
+		name     string
+		m        Match
+		username string
+		want     error
+	}
+
+	tests := []test{
+		{"the host before the stake is agreed", created, "alice", ErrStakeNotAgreed},
+		{"the host once the stake is agreed", agreed, "alice", nil},
+		{"the opponent before the host", agreed, "bob", ErrNoHostBet},
+		{"the opponent after the host", committed, "bob", nil},
+		{"the host a second time", committed, "alice", ErrAlreadyBet},
+		{"somebody else", committed, "carol", ErrNotParticipant},
+		{"a match awaiting the reveal", awaiting, "bob", ErrAwaitingReveal},
+		{"a free-for-all with room", ffa, "carol", nil},
+		{"a free-for-all player who has not thrown", ffa, "bob", nil},
+		{"a free-for-all player who has thrown", ffa, "alice", ErrAlreadyThrown},
+		{"a full free-for-all", full, "dave", ErrFull},
+	}
+
+	for _, status := range []Status{StatusCompleted, StatusDraw, StatusDeclined, StatusExpired, StatusCancelled} {
+		over := committed
+		over.Status = status
+
+		overFFA := ffa
+		overFFA.Status = status
+
+		tests = append(tests,
+			test{"a match " + string(status), over, "bob", ErrResolved},
+			test{"a free-for-all " + string(status), overFFA, "bob", ErrResolved},
+		)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := CanBet(tt.m, tt.username); !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckPending(t *testing.T) {
+	tests := []struct {
+		status Status
+		want   error
+	}{
+		{StatusPending, nil},
+		{StatusAwaitingReveal, ErrNotPending},
+		{StatusCompleted, ErrResolved},
+		{StatusDraw, ErrResolved},
+		{StatusDeclined, ErrResolved},
+		{StatusExpired, ErrResolved},
+		{StatusCancelled, ErrResolved},
+	}
+
+	for _, tt := range tests {
+		if err := checkPending(Match{Status: tt.status}); !errors.Is(err, tt.want) {
+			t.Fatalf("%s: got %v, want %v", tt.status, err, tt.want)
+		}
+	}
+}
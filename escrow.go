@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/mar1n3r0/rps/engine"
+)
+
+const dbRpsEscrow = "rps_escrow"
+
+type EscrowStatus string
+
+const (
+	EscrowHeld     EscrowStatus = "held"
+	EscrowReleased EscrowStatus = "released"
+)
+
+// Escrow holds the stakes of a match from the moment they leave the wallets
+// until they are paid out or refunded. There is one per match, keyed by the
+// match ID.
+type Escrow struct {
+	ID     string        `mapstructure:"_id" json:"_id" validate:"uuid_rfc4122"`       // Match ID
+	Stakes []EscrowStake `mapstructure:"stakes" json:"stakes" validate:"uuid_rfc4122"` // Stakes per player
+	Status EscrowStatus  `mapstructure:"status" json:"status" validate:"uuid_rfc4122"` // Status - held, released
+}
+
+type EscrowStake struct {
+	Username string `mapstructure:"username" json:"username" validate:"uuid_rfc4122"` // Username
+	Amount   int    `mapstructure:"amount" json:"amount" validate:"uuid_rfc4122"`     // Amount in cents still held
+}
+
+// Total returns the amount held for all players.
+func (e Escrow) Total() int {
+	var total int
+
+	for _, s := range e.Stakes {
+		total += s.Amount
+	}
+
+	return total
+}
+
+// Held returns the amount held for username.
+func (e Escrow) Held(username string) int {
+	for _, s := range e.Stakes {
+		if s.Username == username {
+			return s.Amount
+		}
+	}
+
+	return 0
+}
+
+// apply moves mv in or out of the escrow. A stake is added to the player's
+// share, a refund is taken from it and a payout takes its amount out of the
+// pot - the whole pot, unless it is split between the winners of a
+// free-for-all.
+func (e *Escrow) apply(mv engine.Movement) error {
+	switch mv.Kind {
+	case engine.MovementStake:
+		e.add(mv.Username, -mv.Amount)
+	case engine.MovementRefund:
+		if e.Held(mv.Username) < mv.Amount {
+			return fmt.Errorf("escrow of match %s holds %d for %s, cannot refund %d", e.ID, e.Held(mv.Username), mv.Username, mv.Amount)
+		}
+
+		e.add(mv.Username, -mv.Amount)
+	case engine.MovementPayout:
+		if mv.Amount <= 0 || e.Total() < mv.Amount {
+			return fmt.Errorf("escrow of match %s holds %d, cannot pay out %d", e.ID, e.Total(), mv.Amount)
+		}
+
+		left := mv.Amount
+		for i := range e.Stakes {
+			taken := min(e.Stakes[i].Amount, left)
+			e.Stakes[i].Amount -= taken
+			left -= taken
+		}
+	default:
+		return fmt.Errorf("unknown movement %q", mv.Kind)
+	}
+
+	e.Status = EscrowHeld
+	if e.Total() == 0 {
+		e.Status = EscrowReleased
+	}
+
+	return nil
+}
+
+// refunds returns the movements that give every player back what is still
+// held for them.
+func (e Escrow) refunds() []engine.Movement {
+	var mvs []engine.Movement
+
+	for _, s := range e.Stakes {
+		if s.Amount > 0 {
+			mvs = append(mvs, engine.Movement{
+				Username: s.Username,
+				Kind:     engine.MovementRefund,
+				Amount:   s.Amount,
+			})
+		}
+	}
+
+	return mvs
+}
+
+func (e *Escrow) add(username string, amount int) {
+	for i, s := range e.Stakes {
+		if s.Username == username {
+			e.Stakes[i].Amount += amount
+			return
+		}
+	}
+
+	e.Stakes = append(e.Stakes, EscrowStake{
+		Username: username,
+		Amount:   amount,
+	})
+}
+
+// getEscrow returns the escrow of the match with id, or an empty one when
+// nothing has been staked yet.
+func getEscrow(store DocStore, id string) (Escrow, error) {
+	escrowJSON, err := store.Get(dbRpsEscrow, id)
+	if err != nil {
+		return Escrow{}, err
+	}
+
+	if strings.TrimSpace(string(escrowJSON)) == "null" || len(escrowJSON) == 0 {
+		return Escrow{ID: id}, nil
+	}
+
+	var escrows []Escrow
+
+	err = json.Unmarshal(escrowJSON, &escrows)
+	if err != nil {
+		return Escrow{}, err
+	}
+
+	return escrows[0], nil
+}
+
+// inEscrow returns the total amount of username's stakes still held.
+func inEscrow(store DocStore, username string) (int, error) {
+	escrowJSON, err := store.Query(dbRpsEscrow, "status", string(EscrowHeld))
+	if err != nil {
+		return 0, err
+	}
+
+	if strings.TrimSpace(string(escrowJSON)) == "null" || len(escrowJSON) == 0 {
+		return 0, nil
+	}
+
+	var escrows []Escrow
+
+	err = json.Unmarshal(escrowJSON, &escrows)
+	if err != nil {
+		return 0, err
+	}
+
+	var total int
+
+	for _, e := range escrows {
+		total += e.Held(username)
+	}
+
+	return total, nil
+}
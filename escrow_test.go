@@ -0,0 +1,129 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mar1n3r0/rps/engine"
+)
+
+func TestEscrowApply(t *testing.T) {
+	stake := func(username string, amount int) engine.Movement {
+		return engine.Movement{Username: username, Kind: engine.MovementStake, Amount: -amount}
+	}
+
+	refund := func(username string, amount int) engine.Movement {
+		return engine.Movement{Username: username, Kind: engine.MovementRefund, Amount: amount}
+	}
+
+	payout := func(username string, amount int) engine.Movement {
+		return engine.Movement{Username: username, Kind: engine.MovementPayout, Amount: amount}
+	}
+
+	tests := []struct {
+		name      string
+		movements []engine.Movement
+		held      map[string]int
+		status    EscrowStatus
+		wantErr   bool
+	}{
+		{"stakes are held per player", []engine.Movement{stake("alice", 300), stake("bob", 300)}, map[string]int{"alice": 300, "bob": 300}, EscrowHeld, false},
+		{"a refund gives a stake back", []engine.Movement{stake("alice", 300), stake("bob", 300), refund("bob", 300)}, map[string]int{"alice": 300, "bob": 0}, EscrowHeld, false},
+		{"refunding everything releases it", []engine.Movement{stake("alice", 300), refund("alice", 300)}, map[string]int{"alice": 0}, EscrowReleased, false},
+		{"a refund beyond the stake", []engine.Movement{stake("alice", 300), refund("alice", 400)}, nil, "", true},
+		{"a refund of a player who staked nothing", []engine.Movement{stake("alice", 300), refund("bob", 100)}, nil, "", true},
+		{"the payout takes the whole pot", []engine.Movement{stake("alice", 300), stake("bob", 300), payout("bob", 600)}, map[string]int{"alice": 0, "bob": 0}, EscrowReleased, false},
+		{"split payouts take it share by share", []engine.Movement{stake("alice", 100), stake("bob", 100), stake("carol", 100), payout("alice", 150)}, map[string]int{"alice": 0, "bob": 50, "carol": 100}, EscrowHeld, false},
+		{"a payout beyond the pot", []engine.Movement{stake("alice", 300), payout("alice", 301)}, nil, "", true},
+		{"an empty payout", []engine.Movement{stake("alice", 300), payout("alice", 0)}, nil, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := Escrow{ID: "m1"}
+
+			var err error
+
+			for _, mv := range tt.movements {
+				if err = e.apply(mv); err != nil {
+					break
+				}
+			}
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("applied, escrow %+v", e)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var total int
+
+			for username, amount := range tt.held {
+				if got := e.Held(username); got != amount {
+					t.Fatalf("%s has %d held, want %d", username, got, amount)
+				}
+
+				total += amount
+			}
+
+			if e.Total() != total || e.Status != tt.status {
+				t.Fatalf("holds %d %s, want %d %s", e.Total(), e.Status, total, tt.status)
+			}
+		})
+	}
+}
+
+func TestEscrowRefunds(t *testing.T) {
+	e := Escrow{ID: "m1"}
+	e.add("alice", 300)
+	e.add("bob", 0)
+	e.add("carol", 150)
+
+	want := []engine.Movement{
+		{Username: "alice", Kind: engine.MovementRefund, Amount: 300},
+		{Username: "carol", Kind: engine.MovementRefund, Amount: 150},
+	}
+
+	if got := e.refunds(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v", got)
+	}
+
+	for _, mv := range want {
+		if err := e.apply(mv); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if e.Total() != 0 || e.Status != EscrowReleased || e.refunds() != nil {
+		t.Fatalf("escrow %+v after the refunds", e)
+	}
+}
+
+func TestInEscrow(t *testing.T) {
+	players := newTestPlayers(t, 1000, "alice", "bob")
+	alice, bob := players[0], players[1]
+
+	openedMatch(t, alice, bob, "88888888-8888-8888-8888-888888888881", 300)
+	declined := openedMatch(t, alice, bob, "88888888-8888-8888-8888-888888888882", 200)
+
+	if _, err := declineMatch(bob.store, declined, bob.name); err != nil {
+		t.Fatal(err)
+	}
+
+	// only the escrow still held counts
+	for p, want := range map[string]int{alice.name: 300, bob.name: 0} {
+		got, err := inEscrow(bob.store, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got != want {
+			t.Fatalf("%s has %d in escrow, want %d", p, got, want)
+		}
+	}
+}
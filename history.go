@@ -0,0 +1,256 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/mar1n3r0/rps/engine"
+	"github.com/maxence-charriere/go-app/v10/pkg/app"
+)
+
+type history struct {
+	app.Compo
+	store      DocStore
+	myPeerID   string
+	playerName string
+	matches    []engine.Match
+	chains     map[string]string // rematch chain text by match ID
+}
+
+func (h *history) OnMount(ctx app.Context) {
+	var loggedIn bool
+	ctx.GetState("loggedIn", &loggedIn)
+	if !loggedIn {
+		ctx.Navigate("/")
+		return
+	}
+
+	h.store = newDocStore()
+
+	myPeerID, err := h.store.PeerID()
+	if err != nil {
+		ctx.Navigate("/")
+		return
+	}
+
+	h.myPeerID = myPeerID
+
+	ctx.GetState("playerName", &h.playerName)
+
+	h.getMatches(ctx)
+}
+
+func (h *history) OnNav(ctx app.Context) {
+	url := ctx.Page().URL().Path
+	path := strings.ReplaceAll(url, "/", "")
+	linkElName := "link-" + path
+
+	if !app.Window().GetElementByID(linkElName).IsNull() && !app.Window().GetElementByID(linkElName).IsNaN() && !app.Window().GetElementByID(linkElName).IsUndefined() {
+		app.Window().GetElementByID(linkElName).Get("classList").Call("toggle", "active")
+	}
+}
+
+func (h *history) getMatches(ctx app.Context) {
+	ctx.Async(func() {
+		matches, err := getPlayerMatches(h.store, h.playerName)
+		if err != nil {
+			ctx.Notifications().New(app.Notification{
+				Title: "Error",
+				Body:  err.Error(),
+			})
+			return
+		}
+
+		chains := make(map[string]string, len(matches))
+		for _, m := range matches {
+			chains[m.ID] = rematchText(engine.Chain(matches, m), m)
+		}
+
+		ctx.Dispatch(func(ctx app.Context) {
+			h.matches = matches
+			h.chains = chains
+		})
+	})
+}
+
+// getPlayerMatches returns every match username took part in, newest first.
+func getPlayerMatches(store DocStore, username string) ([]engine.Match, error) {
+	all, err := getAllMatches(store)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []engine.Match
+
+	for _, m := range all {
+		if m.Plays(username) {
+			matches = append(matches, m)
+		}
+	}
+
+	return matches, nil
+}
+
+// The Render method is where the component appearance is defined.
+func (h *history) Render() app.UI {
+	return app.Div().
+		Class("container").
+		Body(
+			newNav(),
+			app.Div().ID("main").Body(
+				app.Table().Body(
+					app.TBody().Body(
+						app.Tr().Body(
+							app.Td().ID("table-header").Text("Match History").ColSpan(8),
+						),
+						app.Tr().Body(
+							app.Td().Text("Date"),
+							app.Td().Text("Opponent"),
+							app.Td().Text("Your Pick"),
+							app.Td().Text("Their Pick"),
+							app.Td().Text("Stakes"),
+							app.Td().Text("Outcome"),
+							app.Td().Text("Rematch"),
+							app.Td().Text("Match"),
+						),
+						app.Range(h.matches).Slice(func(i int) app.UI {
+							m := h.matches[i]
+							mine, theirs := picks(m, h.playerName)
+
+							return app.Tr().Body(
+								app.Td().Text(matchDate(m)),
+								app.Td().Text(strings.Join(m.Others(h.playerName), ", ")),
+								app.Td().Text(mine),
+								app.Td().Text(theirs),
+								app.Td().Text(stakesText(m)),
+								app.Td().Text(outcomeText(m, h.playerName)),
+								app.Td().Body(
+									app.If(m.PreviousID != "", func() app.UI {
+										return app.A().Href("/match/" + m.PreviousID).Text(h.chains[m.ID])
+									}).Else(func() app.UI {
+										return app.Text(h.chains[m.ID])
+									}),
+								),
+								app.Td().Body(
+									app.A().Href("/match/"+m.ID).Text("View"),
+								),
+							)
+						}),
+					),
+				),
+			),
+		)
+}
+
+// rematchText tells which rematch of its chain m is, or that it started a
+// chain of rematches.
+func rematchText(chain []engine.Match, m engine.Match) string {
+	if len(chain) < 2 {
+		return "-"
+	}
+
+	for i, c := range chain {
+		if c.ID != m.ID {
+			continue
+		}
+
+		switch {
+		case i == 0:
+			return "Rematched " + strconv.Itoa(len(chain)-1) + "x"
+		case m.DoubleOrNothing:
+			return "Double or nothing #" + strconv.Itoa(i)
+		}
+
+		return "Rematch #" + strconv.Itoa(i)
+	}
+
+	return "-"
+}
+
+// stakesText gives the bets of the host and the opponent of m, or the bet
+// of every player of a free-for-all.
+func stakesText(m engine.Match) string {
+	if m.FreeForAll() {
+		return formatStake(m.Stake) + " each"
+	}
+
+	return formatStake(m.Host.Bet) + " / " + formatStake(m.Opponent.Bet)
+}
+
+// picks returns the items username and their opponent played in m, as far
+// as they are known. The host's item stays hidden until it is revealed, as
+// do the throws of a free-for-all, whose other players' items are listed
+// together.
+func picks(m engine.Match, username string) (mine, theirs string) {
+	if m.FreeForAll() {
+		mine = "-"
+
+		var others []string
+
+		for _, p := range m.Players {
+			if p.Username == username {
+				mine = pickName(p, p.Commitment != "")
+				continue
+			}
+
+			others = append(others, pickName(p, p.Commitment != ""))
+		}
+
+		return mine, strings.Join(others, ", ")
+	}
+
+	host := pickName(m.Host, m.Host.Commitment != "")
+	opponent := pickName(m.Opponent, false)
+
+	if username == m.Host.Username {
+		return host, opponent
+	}
+
+	return opponent, host
+}
+
+func pickName(s engine.Selection, committed bool) string {
+	if s.ItemName != "" {
+		return s.ItemName
+	}
+
+	if committed {
+		return "Hidden"
+	}
+
+	return "-"
+}
+
+// outcomeText describes where m stands from the point of view of username,
+// pending matches included.
+func outcomeText(m engine.Match, username string) string {
+	if m.FreeForAll() {
+		return freeForAllText(m, username)
+	}
+
+	if m.Status == engine.StatusPending && m.Staked() {
+		return "Round " + strconv.Itoa(m.Round()) + " (" + seriesText(m, username) + ")"
+	}
+
+	if m.Status == engine.StatusPending {
+		return "Pending"
+	}
+
+	if m.Status == engine.StatusAwaitingReveal && m.Host.Username != username {
+		return "Awaiting reveal"
+	}
+
+	if m.IsSeries() && m.Staked() {
+		return statusText(m, username) + " (" + seriesText(m, username) + ")"
+	}
+
+	return statusText(m, username)
+}
+
+func matchDate(m engine.Match) string {
+	if m.CreatedAt.IsZero() {
+		return "-"
+	}
+
+	return m.CreatedAt.Local().Format("2006-01-02 15:04")
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mar1n3r0/rps/engine"
+)
+
+func TestGetPlayerMatches(t *testing.T) {
+	players := newTestPlayers(t, 1000, "alice", "bob", "carol")
+	alice := players[0]
+
+	for i, m := range []engine.Match{
+		{ID: "eeeeeeee-eeee-eeee-eeee-eeeeeeeeeee1", Status: engine.StatusPending, Host: engine.Selection{Username: "alice"}, Opponent: engine.Selection{Username: "bob"}},
+		{ID: "eeeeeeee-eeee-eeee-eeee-eeeeeeeeeee2", Status: engine.StatusPending, Host: engine.Selection{Username: "bob"}, Opponent: engine.Selection{Username: "carol"}},
+		{ID: "eeeeeeee-eeee-eeee-eeee-eeeeeeeeeee3", Status: engine.StatusPending, Host: engine.Selection{Username: "carol"}, Opponent: engine.Selection{Username: "alice"}},
+		{ID: "eeeeeeee-eeee-eeee-eeee-eeeeeeeeeee4", Status: engine.StatusPending, Host: engine.Selection{Username: "bob"}, Size: 3, Players: []engine.Selection{{Username: "bob"}, {Username: "alice"}}},
+	} {
+		m.CreatedAt = testNow.Add(time.Duration(i) * time.Hour)
+		matchJSON, _ := json.Marshal(m)
+
+		if err := players[i%len(players)].store.Put(dbRpsChallenge, matchJSON); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	matches, err := getPlayerMatches(alice.store, alice.name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+
+	for _, m := range matches {
+		got = append(got, m.ID)
+	}
+
+	want := []string{"eeeeeeee-eeee-eeee-eeee-eeeeeeeeeee4", "eeeeeeee-eeee-eeee-eeee-eeeeeeeeeee3", "eeeeeeee-eeee-eeee-eeee-eeeeeeeeeee1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestRematchText(t *testing.T) {
+	first := engine.Match{ID: "m1"}
+	second := engine.Match{ID: "m2"}
+	double := engine.Match{ID: "m3", DoubleOrNothing: true}
+	chain := []engine.Match{first, second, double}
+
+	tests := []struct {
+		name  string
+		chain []engine.Match
+		m     engine.Match
+		want  string
+	}{
+		{"no rematch", []engine.Match{first}, first, "-"},
+		{"the first of a chain", chain, first, "Rematched 2x"},
+		{"a rematch", chain, second, "Rematch #1"},
+		{"double or nothing", chain, double, "Double or nothing #2"},
+		{"a match outside the chain", chain, engine.Match{ID: "m4"}, "-"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rematchText(tt.chain, tt.m); got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStakesText(t *testing.T) {
+	tests := []struct {
+		name string
+		m    engine.Match
+		want string
+	}{
+		{"both bets", engine.Match{Host: engine.Selection{Bet: 300}, Opponent: engine.Selection{Bet: 250}}, "€3.00 / €2.50"},
+		{"no bets yet", engine.Match{}, "€0.00 / €0.00"},
+		{"a free-for-all", engine.Match{Size: 3, Stake: 150}, "€1.50 each"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stakesText(tt.m); got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPicks(t *testing.T) {
+	committed := engine.Match{
+		Host:     engine.Selection{Username: "alice", Commitment: "c1"},
+		Opponent: engine.Selection{Username: "bob", ItemName: "paper"},
+	}
+
+	revealed := committed
+	revealed.Host.ItemName = "rock"
+
+	ffa := engine.Match{
+		Size: 3,
+		Players: []engine.Selection{
+			{Username: "alice", Commitment: "c1", ItemName: "rock"},
+			{Username: "bob", Commitment: "c2"},
+			{Username: "carol"},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		m        engine.Match
+		username string
+		mine     string
+		theirs   string
+	}{
+		{"the host before the reveal", committed, "alice", "Hidden", "paper"},
+		{"the opponent before the reveal", committed, "bob", "paper", "Hidden"},
+		{"the opponent once revealed", revealed, "bob", "paper", "rock"},
+		{"nothing played yet", engine.Match{Host: engine.Selection{Username: "alice"}, Opponent: engine.Selection{Username: "bob"}}, "bob", "-", "-"},
+		{"a free-for-all", ffa, "alice", "rock", "Hidden, -"},
+		{"a free-for-all watched", ffa, "dave", "-", "rock, Hidden, -"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mine, theirs := picks(tt.m, tt.username)
+
+			if mine != tt.mine || theirs != tt.theirs {
+				t.Fatalf("got %q, %q, want %q, %q", mine, theirs, tt.mine, tt.theirs)
+			}
+		})
+	}
+}
+
+func TestOutcomeText(t *testing.T) {
+	host := engine.Selection{Username: "alice"}
+	opponent := engine.Selection{Username: "bob"}
+
+	series := engine.Match{Host: host, Opponent: opponent, BestOf: 3, Status: engine.StatusPending, Rounds: []engine.Round{{Winner: "alice"}}}
+
+	won := series
+	won.Status = engine.StatusCompleted
+	won.Winner = "alice"
+	won.Rounds = []engine.Round{{Winner: "alice"}, {Winner: "bob"}, {Winner: "alice"}}
+
+	tests := []struct {
+		name     string
+		m        engine.Match
+		username string
+		want     string
+	}{
+		{"pending", engine.Match{Host: host, Opponent: opponent, Status: engine.StatusPending}, "bob", "Pending"},
+		{"a series under way", series, "bob", "Round 2 (Best of 3, 0-1)"},
+		{"awaiting the host's reveal", engine.Match{Host: host, Opponent: opponent, Status: engine.StatusAwaitingReveal}, "bob", "Awaiting reveal"},
+		{"awaiting your reveal", engine.Match{Host: host, Opponent: opponent, Status: engine.StatusAwaitingReveal}, "alice", "Played, settled once you reveal"},
+		{"a series won", won, "alice", "Won (Best of 3, 2-1)"},
+		{"a single throw lost", engine.Match{Host: host, Opponent: opponent, Status: engine.StatusCompleted, Winner: "alice"}, "bob", "Lost"},
+		{"a free-for-all", engine.Match{Size: 3, Status: engine.StatusCompleted, Winners: []string{"alice", "carol"}}, "bob", "Lost to alice, carol"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := outcomeText(tt.m, tt.username); got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchDate(t *testing.T) {
+	if got := matchDate(engine.Match{}); got != "-" {
+		t.Fatalf("undated match shows %q", got)
+	}
+
+	at := time.Date(2026, 1, 2, 15, 4, 0, 0, time.Local)
+
+	if got := matchDate(engine.Match{CreatedAt: at}); got != "2026-01-02 15:04" {
+		t.Fatalf("got %q", got)
+	}
+}
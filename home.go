@@ -4,14 +4,13 @@ import (
 	"strings"
 
 	"github.com/maxence-charriere/go-app/v10/pkg/app"
-	shell "github.com/stateless-minds/go-ipfs-api"
 )
 
 // A component is a customizable, independent, and reusable UI element. It is created by
 // embedding app.Compo into a struct.
 type home struct {
 	app.Compo
-	sh         *shell.Shell
+	store      DocStore
 	myPeerID   string
 	playerName string
 }
@@ -24,16 +23,15 @@ func (h *home) OnMount(ctx app.Context) {
 		return
 	}
 
-	sh := shell.NewShell("localhost:5001")
-	h.sh = sh
+	h.store = newDocStore()
 
-	myPeer, err := h.sh.ID()
+	myPeerID, err := h.store.PeerID()
 	if err != nil {
 		ctx.Navigate("/")
 		return
 	}
 
-	h.myPeerID = myPeer.ID
+	h.myPeerID = myPeerID
 
 	ctx.GetState("playerName", &h.playerName)
 }
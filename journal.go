@@ -0,0 +1,524 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mar1n3r0/rps/engine"
+)
+
+const dbRpsJournal = "rps_journal"
+
+type JournalStatus string
+
+const (
+	JournalPending    JournalStatus = "pending"
+	JournalCommitted  JournalStatus = "committed"
+	JournalRolledBack JournalStatus = "rolled_back"
+	JournalFailed     JournalStatus = "failed"
+)
+
+// errConflict means a document changed since it was read, so writing it
+// would lose that change. Documents that can be changed concurrently carry a
+// version that every write increments.
+var errConflict = errors.New("document was changed by someone else")
+
+// Journal records every write of a settlement step before any of them is
+// made, so that the step can be finished or undone as a whole when it is
+// interrupted. Each write keeps the document as it was before and as it is
+// meant to be after; since both are known, applying and undoing a write is
+// idempotent and can be repeated until it succeeds.
+type Journal struct {
+	ID           string         `mapstructure:"_id" json:"_id" validate:"uuid_rfc4122"`                               // ID
+	MatchID      string         `mapstructure:"match_id" json:"match_id" validate:"uuid_rfc4122"`                     // Match the writes settle, empty for deposits and withdrawals
+	TournamentID string         `mapstructure:"tournament_id" json:"tournament_id,omitempty" validate:"uuid_rfc4122"` // Tournament whose entry fees or prizes the writes move
+	Owner        string         `mapstructure:"owner" json:"owner" validate:"uuid_rfc4122"`                           // Username of the player applying it
+	Status       JournalStatus  `mapstructure:"status" json:"status" validate:"uuid_rfc4122"`                         // Status - pending, committed, rolled_back, failed
+	Error        string         `mapstructure:"error" json:"error" validate:"uuid_rfc4122"`                           // Why the journal failed
+	Writes       []JournalWrite `mapstructure:"writes" json:"writes" validate:"uuid_rfc4122"`                         // Writes in the order they are applied
+	CreatedAt    time.Time      `mapstructure:"created_at" json:"created_at" validate:"uuid_rfc4122"`                 // CreatedAt
+	Signer       string         `mapstructure:"signer" json:"signer,omitempty" validate:"uuid_rfc4122"`               // Peer that signed the journal
+
+	applied int // writes known to be made, the ones to undo on rollback
+}
+
+type JournalWrite struct {
+	DB     string          `mapstructure:"db" json:"db" validate:"uuid_rfc4122"`         // Collection
+	ID     string          `mapstructure:"id" json:"id" validate:"uuid_rfc4122"`         // Document ID
+	Before json.RawMessage `mapstructure:"before" json:"before" validate:"uuid_rfc4122"` // Document before, null if it did not exist
+	After  json.RawMessage `mapstructure:"after" json:"after" validate:"uuid_rfc4122"`   // Document after
+}
+
+// settlement collects the writes of one step of a match - staking a bet,
+// playing, revealing - and applies them as a unit.
+type settlement struct {
+	store    DocStore
+	journal  Journal
+	balances map[string]Balance
+	escrow   *Escrow
+}
+
+func newSettlement(store DocStore, matchID, owner string) *settlement {
+	return &settlement{
+		store: store,
+		journal: Journal{
+			ID:        uuid.NewString(),
+			MatchID:   matchID,
+			Owner:     owner,
+			Status:    JournalPending,
+			CreatedAt: time.Now(),
+		},
+		balances: make(map[string]Balance),
+	}
+}
+
+// putMatch adds the write that saves m. It fails with errConflict when the
+// match was changed since m was read.
+func (s *settlement) putMatch(m engine.Match) error {
+	current, err := getMatch(s.store, m.ID)
+	if err != nil {
+		return err
+	}
+
+	err = checkMatchWrite(current, m)
+	if err != nil {
+		return err
+	}
+
+	// the escrow follows the match as stored, which holds the bet of a
+	// match staked before escrows were kept
+	if current.ID != "" && s.escrow == nil {
+		escrow, err := matchEscrow(s.store, current)
+		if err != nil {
+			return err
+		}
+
+		s.escrow = &escrow
+	}
+
+	m.Version++
+
+	return s.put(dbRpsChallenge, m.ID, m)
+}
+
+// move adds the writes that apply mv to the player's wallet and the escrow
+// of the match. Several movements on the same wallet add up. counterparty is
+// the other player of the match.
+func (s *settlement) move(mv engine.Movement, counterparty string) error {
+	if s.escrow == nil {
+		escrow, err := getEscrow(s.store, s.journal.MatchID)
+		if err != nil {
+			return err
+		}
+
+		s.escrow = &escrow
+	}
+
+	err := s.escrow.apply(mv)
+	if err != nil {
+		return err
+	}
+
+	err = s.put(dbRpsEscrow, s.escrow.ID, s.escrow)
+	if err != nil {
+		return err
+	}
+
+	return s.post(mv.Username, mv.Amount, escrowAccount(s.journal.MatchID), TransactionKind(mv.Kind), counterparty)
+}
+
+// post adds the writes that move amount into the wallet of username from
+// the counter account, or out of it into that account when amount is
+// negative: the ledger posting, the transaction and the cached balance.
+func (s *settlement) post(username string, amount int, counter string, kind TransactionKind, counterparty string) error {
+	balance, ok := s.balances[username]
+	if !ok {
+		var err error
+
+		balance, err = getBalance(s.store, username)
+		if err != nil {
+			return err
+		}
+
+		if balance.ID == "" {
+			return fmt.Errorf("could not transfer funds to %s: wallet not found", username)
+		}
+
+		balance.Version++
+
+		opened, err := hasOpening(s.store, username)
+		if err != nil {
+			return err
+		}
+
+		// the opening balance of a wallet is only known to its owner
+		if !opened && username != s.journal.Owner {
+			return fmt.Errorf("could not transfer funds to %s: wallet not on the ledger yet", username)
+		}
+
+		if !opened {
+			err = s.open(balance)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if balance.Amount+amount < 0 {
+		return fmt.Errorf("not enough funds in the wallet of %s", username)
+	}
+
+	balance.Amount += amount
+	s.balances[username] = balance
+
+	// the posting goes first, a wallet written by another peer has to hold
+	// what its ledger account does
+	posting := newPosting(walletAccount(username), counter, amount, kind, s.journal.MatchID)
+
+	err := s.put(dbRpsLedger, posting.ID, posting)
+	if err != nil {
+		return err
+	}
+
+	transaction := Transaction{
+		ID:           uuid.NewString(),
+		Username:     username,
+		Type:         TypeDebit,
+		Amount:       amount,
+		Timestamp:    time.Now(),
+		Kind:         kind,
+		MatchID:      s.journal.MatchID,
+		Counterparty: counterparty,
+		TournamentID: s.journal.TournamentID,
+	}
+
+	if amount < 0 {
+		transaction.Type = TypeCredit
+		transaction.Amount = -amount
+	}
+
+	err = s.put(dbRpsTransaction, transaction.ID, transaction)
+	if err != nil {
+		return err
+	}
+
+	return s.put(dbRpsWallet, balance.ID, balance)
+}
+
+// open adds the posting that brings the cached balance of a wallet that is
+// not on the ledger yet onto it.
+func (s *settlement) open(balance Balance) error {
+	ledger, err := ledgerBalance(s.store, walletAccount(balance.ID))
+	if err != nil {
+		return err
+	}
+
+	posting := newPosting(walletAccount(balance.ID), accountOpening, balance.Amount-ledger, KindAdjustment, "")
+	posting.ID = openingID(balance.ID)
+
+	return s.put(dbRpsLedger, posting.ID, posting)
+}
+
+// put adds a write of doc. An earlier write of the same document in this
+// settlement is replaced and moves to the end, after the writes it depends
+// on.
+func (s *settlement) put(db, id string, doc any) error {
+	after, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	for i, w := range s.journal.Writes {
+		if w.DB == db && w.ID == id {
+			w.After = after
+			s.journal.Writes = append(s.journal.Writes[:i], s.journal.Writes[i+1:]...)
+			s.journal.Writes = append(s.journal.Writes, w)
+
+			return nil
+		}
+	}
+
+	before, err := getDoc(s.store, db, id)
+	if err != nil {
+		return err
+	}
+
+	s.journal.Writes = append(s.journal.Writes, JournalWrite{
+		DB:     db,
+		ID:     id,
+		Before: before,
+		After:  after,
+	})
+
+	return nil
+}
+
+// commit stores the journal and then applies its writes. When a write fails
+// the ones already made are undone; if even that fails the journal stays
+// pending and resumeSettlements finishes it later.
+func (s *settlement) commit() error {
+	err := putJournal(s.store, s.journal)
+	if err != nil {
+		return err
+	}
+
+	err = s.journal.apply(s.store, false)
+	if err != nil {
+		return s.journal.abort(s.store, err)
+	}
+
+	s.journal.Status = JournalCommitted
+
+	// should this fail, resuming finds every write made and only updates
+	// the status
+	_ = putJournal(s.store, s.journal)
+
+	return nil
+}
+
+// balance returns the balance of username once the settlement is applied,
+// and whether the settlement changes it.
+func (s *settlement) balance(username string) (int, bool) {
+	balance, ok := s.balances[username]
+	return balance.Amount, ok
+}
+
+// apply makes the writes of the journal in order. Every document has to be
+// as it was before; when resuming, one already written is skipped.
+func (j *Journal) apply(store DocStore, resume bool) error {
+	for i, w := range j.Writes {
+		j.applied = i
+
+		current, err := getDoc(store, w.DB, w.ID)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case sameDoc(current, w.Before):
+			err = store.Put(w.DB, w.After)
+			if err != nil {
+				return err
+			}
+
+			// the store has no compare-and-swap, a write that raced with
+			// this one shows when reading it back
+			current, err = getDoc(store, w.DB, w.ID)
+			if err != nil {
+				return err
+			}
+
+			if !sameDoc(current, w.After) {
+				return fmt.Errorf("%w: %s %s", errConflict, w.DB, w.ID)
+			}
+		case resume && sameDoc(current, w.After):
+			continue
+		default:
+			return fmt.Errorf("%w: %s %s", errConflict, w.DB, w.ID)
+		}
+	}
+
+	j.applied = len(j.Writes)
+
+	return nil
+}
+
+// rollback undoes the writes apply made, newest first.
+func (j *Journal) rollback(store DocStore) error {
+	for i := j.applied - 1; i >= 0; i-- {
+		w := j.Writes[i]
+
+		current, err := getDoc(store, w.DB, w.ID)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case sameDoc(current, w.Before):
+			continue
+		case sameDoc(current, w.After):
+			if isNull(w.Before) {
+				err = store.Delete(w.DB, w.ID)
+			} else {
+				err = store.Put(w.DB, w.Before)
+			}
+
+			if err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("%w: %s %s", errConflict, w.DB, w.ID)
+		}
+	}
+
+	return nil
+}
+
+// abort undoes the writes of a journal that could not be applied because of
+// cause. The journal is kept pending when it cannot be undone yet, and marked
+// failed when undoing it would overwrite someone else's change.
+func (j *Journal) abort(store DocStore, cause error) error {
+	err := j.rollback(store)
+	switch {
+	case err == nil:
+		j.Status = JournalRolledBack
+		j.Error = cause.Error()
+	case errors.Is(err, errConflict):
+		j.Status = JournalFailed
+		j.Error = cause.Error() + ", rollback: " + err.Error()
+	default:
+		return fmt.Errorf("settlement interrupted, it is finished next time you open your challenges: %w", cause)
+	}
+
+	_ = putJournal(store, *j)
+
+	if j.Status == JournalFailed {
+		return fmt.Errorf("settlement failed and could not be undone: %s", j.Error)
+	}
+
+	return fmt.Errorf("settlement rolled back: %w", cause)
+}
+
+// resumeSettlements finishes the pending journals of owner left behind by an
+// interrupted settlement. Those that cannot be finished are undone. Only the
+// journals the peer of store signed are resumed: a journal is replayed with
+// that peer's signature, so one written by anyone else is left alone.
+func resumeSettlements(store DocStore, owner string) error {
+	peerID, err := store.PeerID()
+	if err != nil {
+		return err
+	}
+
+	journalsJSON, err := store.Query(dbRpsJournal, "owner", owner)
+	if err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(string(journalsJSON)) == "null" || len(journalsJSON) == 0 {
+		return nil
+	}
+
+	var journals []Journal
+
+	err = json.Unmarshal(journalsJSON, &journals)
+	if err != nil {
+		return err
+	}
+
+	for _, j := range journals {
+		if j.Status != JournalPending || j.Signer != peerID {
+			continue
+		}
+
+		err = j.apply(store, true)
+		if errors.Is(err, errConflict) {
+			err = j.abort(store, err)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		j.Status = JournalCommitted
+
+		err = putJournal(store, j)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writes reports whether the journal writes doc to db, or puts it back
+// there when undoing a write.
+func (j Journal) writes(db string, doc json.RawMessage) bool {
+	for _, w := range j.Writes {
+		if w.DB == db && (sameDoc(w.After, doc) || sameDoc(w.Before, doc)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// releases reports whether the journal releases the escrow of the match
+// with id, paying out or refunding all it held.
+func (j Journal) releases(id string) bool {
+	for _, w := range j.Writes {
+		if w.DB != dbRpsEscrow || w.ID != id {
+			continue
+		}
+
+		var e Escrow
+
+		return json.Unmarshal(w.After, &e) == nil && e.Status == EscrowReleased
+	}
+
+	return false
+}
+
+func putJournal(store DocStore, j Journal) error {
+	journalJSON, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+
+	return store.Put(dbRpsJournal, journalJSON)
+}
+
+// getDoc returns the document with id, or nil when there is none.
+func getDoc(store DocStore, db, id string) (json.RawMessage, error) {
+	docsJSON, err := store.Get(db, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.TrimSpace(string(docsJSON)) == "null" || len(docsJSON) == 0 {
+		return nil, nil
+	}
+
+	var docs []json.RawMessage
+
+	err = json.Unmarshal(docsJSON, &docs)
+	if err != nil {
+		return nil, err
+	}
+
+	return docs[0], nil
+}
+
+// sameDoc reports whether two documents hold the same data, ignoring who
+// signed them. A nil document stands for one that does not exist.
+func sameDoc(a, b json.RawMessage) bool {
+	if isNull(a) || isNull(b) {
+		return isNull(a) && isNull(b)
+	}
+
+	fa, err := decodeFields(a)
+	if err != nil {
+		return false
+	}
+
+	fb, err := decodeFields(b)
+	if err != nil {
+		return false
+	}
+
+	for _, f := range []map[string]any{fa, fb} {
+		delete(f, "signer")
+		delete(f, "signature")
+	}
+
+	return reflect.DeepEqual(fa, fb)
+}
+
+func isNull(doc json.RawMessage) bool {
+	return len(doc) == 0 || bytes.Equal(bytes.TrimSpace(doc), []byte("null"))
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/mar1n3r0/rps/engine"
+)
+
+var errBroken = errors.New("store unavailable")
+
+// failingStore fails the writes to db once it has let through the first ok
+// of them, only the first of those when once, and every write after that
+// while broken.
+type failingStore struct {
+	DocStore
+	db     string
+	ok     int
+	broken bool // fail every write, not only the one to db
+	once   bool // fail only the first write to db past ok
+	failed bool
+}
+
+func (s *failingStore) Put(db string, doc []byte) error {
+	if s.fail(db) {
+		return errBroken
+	}
+
+	return s.DocStore.Put(db, doc)
+}
+
+func (s *failingStore) Delete(db, id string) error {
+	if s.fail(db) {
+		return errBroken
+	}
+
+	return s.DocStore.Delete(db, id)
+}
+
+func (s *failingStore) fail(db string) bool {
+	if s.failed && s.broken {
+		return true
+	}
+
+	if db != s.db || (s.once && s.failed) {
+		return false
+	}
+
+	if s.ok > 0 {
+		s.ok--
+		return false
+	}
+
+	s.failed = true
+
+	return true
+}
+
+// failing returns a store writing as the peer of p that fails its writes
+// like f.
+func failing(p testPlayer, f *failingStore) DocStore {
+	f.DocStore = p.store.(*signedStore).DocStore
+
+	return newSignedStore(f)
+}
+
+// openedMatch saves a match between host and opponent with a stake of bet
+// agreed on and the host's bet staked.
+func openedMatch(t *testing.T, host, opponent testPlayer, id string, bet int) engine.Match {
+	t.Helper()
+
+	m, err := engine.Create(id, engine.ModeClassic, host.name, opponent.name, testNow, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err = engine.Propose(m, host.name, bet, testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err = engine.AgreeStake(m, opponent.name, testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err = saveMatch(host.store, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opened, stakes, err := engine.Open(classicRules(t), m, engine.Selection{Username: host.name, ItemName: "rock", Bet: bet}, "salt", testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := settleMatch(host.store, host.name, opened, stakes); err != nil {
+		t.Fatal(err)
+	}
+
+	opened, err = getMatch(opponent.store, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return opened
+}
+
+// journalOf returns the only journal of owner on match.
+func journalOf(t *testing.T, store DocStore, owner, match string) Journal {
+	t.Helper()
+
+	journalsJSON, err := store.Query(dbRpsJournal, "owner", owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var journals []Journal
+
+	if err := json.Unmarshal(journalsJSON, &journals); err != nil {
+		t.Fatal(err)
+	}
+
+	var found []Journal
+
+	for _, j := range journals {
+		if j.MatchID == match {
+			found = append(found, j)
+		}
+	}
+
+	if len(found) != 1 {
+		t.Fatalf("%d journals of %s on %s", len(found), owner, match)
+	}
+
+	return found[0]
+}
+
+// assertHeld checks that the decline of m left nothing behind: the match is
+// still pending, the escrow holds the host's stake and the host's wallet
+// balances.
+func assertHeld(t *testing.T, store DocStore, m engine.Match, balance int) {
+	t.Helper()
+
+	current, err := getMatch(store, m.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	escrow, err := getEscrow(store, m.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if current.Status != engine.StatusPending || escrow.Held(m.Host.Username) != m.Host.Bet {
+		t.Fatalf("match %s, escrow holds %d", current.Status, escrow.Held(m.Host.Username))
+	}
+
+	check, err := verifyLedger(store, m.Host.Username)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !check.Balanced() || check.Cached != balance {
+		t.Fatalf("host has %d: %+v", check.Cached, check)
+	}
+}
+
+func TestSettlementRollback(t *testing.T) {
+	players := newTestPlayers(t, 1000, "alice", "bob")
+	alice, bob := players[0], players[1]
+
+	m := openedMatch(t, alice, bob, "66666666-6666-6666-6666-666666666661", 300)
+
+	// the refund reaches everything but alice's wallet
+	store := failing(bob, &failingStore{db: dbRpsWallet})
+
+	if _, err := declineMatch(store, m, bob.name); !errors.Is(err, errBroken) {
+		t.Fatalf("got %v, want the write error", err)
+	}
+
+	assertHeld(t, alice.store, m, 700)
+
+	j := journalOf(t, bob.store, bob.name, m.ID)
+	if j.Status != JournalRolledBack || j.Error == "" {
+		t.Fatalf("journal %s: %q", j.Status, j.Error)
+	}
+
+	// a rolled back journal is not resumed
+	if err := resumeSettlements(bob.store, bob.name); err != nil {
+		t.Fatal(err)
+	}
+
+	assertHeld(t, alice.store, m, 700)
+}
+
+func TestSettlementResume(t *testing.T) {
+	players := newTestPlayers(t, 1000, "alice", "bob", "mallory")
+	alice, bob, mallory := players[0], players[1], players[2]
+
+	m := openedMatch(t, alice, bob, "66666666-6666-6666-6666-666666666662", 300)
+
+	// the store goes away halfway through, so the writes made cannot be
+	// undone either
+	store := failing(bob, &failingStore{db: dbRpsWallet, broken: true})
+
+	if _, err := declineMatch(store, m, bob.name); !errors.Is(err, errBroken) {
+		t.Fatalf("got %v, want the write error", err)
+	}
+
+	j := journalOf(t, bob.store, bob.name, m.ID)
+	if j.Status != JournalPending {
+		t.Fatalf("journal %s", j.Status)
+	}
+
+	// nobody else finishes bob's settlement, not even as bob
+	if err := resumeSettlements(alice.store, bob.name); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := balanceOf(t, alice.store, alice.name); got != 700 {
+		t.Fatalf("alice has %d resumed by herself", got)
+	}
+
+	if err := resumeSettlements(bob.store, bob.name); err != nil {
+		t.Fatal(err)
+	}
+
+	if j := journalOf(t, bob.store, bob.name, m.ID); j.Status != JournalCommitted {
+		t.Fatalf("journal %s once resumed", j.Status)
+	}
+
+	declined, err := getMatch(alice.store, m.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if declined.Status != engine.StatusDeclined || balanceOf(t, mallory.store, alice.name) != 1000 {
+		t.Fatalf("match %s, alice has %d", declined.Status, balanceOf(t, mallory.store, alice.name))
+	}
+
+	// a pending journal mallory wrote in alice's name is not applied
+	forged := Journal{
+		ID:      "77777777-7777-7777-7777-777777777777",
+		Owner:   alice.name,
+		Status:  JournalPending,
+		MatchID: m.ID,
+		Writes:  j.Writes,
+	}
+
+	if err := putJournal(mallory.store, forged); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range players {
+		if err := resumeSettlements(p.store, alice.name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	raw, err := getDoc(alice.store.(*signedStore).DocStore, dbRpsJournal, forged.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stored Journal
+
+	if err := json.Unmarshal(raw, &stored); err != nil || stored.Status != JournalPending {
+		t.Fatalf("forged journal %s: %v", stored.Status, err)
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const dbRpsLedger = "rps_ledger"
+
+// Accounts money moves between. A player's wallet and a match's escrow hold
+// money inside the game, the external account stands for the money players
+// deposit and withdraw, and the opening account for the balances wallets had
+// before the ledger was kept.
+const (
+	accountExternal = "external"
+	accountOpening  = "opening"
+)
+
+func walletAccount(username string) string {
+	return "wallet:" + username
+}
+
+func escrowAccount(matchID string) string {
+	return "escrow:" + matchID
+}
+
+// Posting is an entry of the ledger. It moves Amount from the Credit account
+// to the Debit account, so every cent that enters an account leaves another
+// one and the balances of all accounts always add up to zero. Postings are
+// never changed once written; a mistake is corrected with a new posting.
+type Posting struct {
+	ID        string          `mapstructure:"_id" json:"_id" validate:"uuid_rfc4122"`                     // ID
+	Debit     string          `mapstructure:"debit" json:"debit" validate:"uuid_rfc4122"`                 // Account the amount goes to
+	Credit    string          `mapstructure:"credit" json:"credit" validate:"uuid_rfc4122"`               // Account the amount comes from
+	Amount    int             `mapstructure:"amount" json:"amount" validate:"uuid_rfc4122"`               // Amount in cents
+	Kind      TransactionKind `mapstructure:"kind" json:"kind" validate:"uuid_rfc4122"`                   // Kind of the transaction it backs
+	MatchID   string          `mapstructure:"match_id" json:"match_id,omitempty" validate:"uuid_rfc4122"` // Match the posting settles
+	Timestamp time.Time       `mapstructure:"timestamp" json:"timestamp" validate:"uuid_rfc4122"`         // Timestamp
+}
+
+// newPosting returns a posting that moves amount from one account to
+// another, or the other way around when amount is negative.
+func newPosting(to, from string, amount int, kind TransactionKind, matchID string) Posting {
+	if amount < 0 {
+		to, from, amount = from, to, -amount
+	}
+
+	return Posting{
+		ID:        uuid.NewString(),
+		Debit:     to,
+		Credit:    from,
+		Amount:    amount,
+		Kind:      kind,
+		MatchID:   matchID,
+		Timestamp: time.Now(),
+	}
+}
+
+// openingID is the ID of the posting that brings the balance a wallet had
+// before the ledger onto it. There is at most one per wallet.
+func openingID(username string) string {
+	return "opening-" + username
+}
+
+// opens reports whether p moves money between the wallet of username and
+// the opening account, in either direction.
+func (p Posting) opens(username string) bool {
+	wallet := walletAccount(username)
+
+	return (p.Debit == wallet && p.Credit == accountOpening) || (p.Debit == accountOpening && p.Credit == wallet)
+}
+
+// getPostings returns every posting that moves money in or out of account.
+func getPostings(store DocStore, account string) ([]Posting, error) {
+	var postings []Posting
+
+	for _, field := range []string{"debit", "credit"} {
+		postingsJSON, err := store.Query(dbRpsLedger, field, account)
+		if err != nil {
+			return nil, err
+		}
+
+		if strings.TrimSpace(string(postingsJSON)) == "null" || len(postingsJSON) == 0 {
+			continue
+		}
+
+		var found []Posting
+
+		err = json.Unmarshal(postingsJSON, &found)
+		if err != nil {
+			return nil, err
+		}
+
+		postings = append(postings, found...)
+	}
+
+	return postings, nil
+}
+
+// ledgerBalance returns the balance of account computed from the ledger.
+func ledgerBalance(store DocStore, account string) (int, error) {
+	return ledgerBalanceAt(store, account, time.Time{})
+}
+
+// ledgerBalanceAt returns the balance of account computed from the postings
+// made until at, or from all of them when at is zero.
+func ledgerBalanceAt(store DocStore, account string, at time.Time) (int, error) {
+	postings, err := getPostings(store, account)
+	if err != nil {
+		return 0, err
+	}
+
+	var balance int
+
+	for _, p := range postings {
+		if !at.IsZero() && p.Timestamp.After(at) {
+			continue
+		}
+
+		if p.Debit == account {
+			balance += p.Amount
+		}
+
+		if p.Credit == account {
+			balance -= p.Amount
+		}
+	}
+
+	return balance, nil
+}
+
+// hasOpening reports whether the wallet of username is on the ledger.
+func hasOpening(store DocStore, username string) (bool, error) {
+	doc, err := getDoc(store, dbRpsLedger, openingID(username))
+	if err != nil {
+		return false, err
+	}
+
+	return doc != nil, nil
+}
+
+// getOpening returns the opening posting of the wallet of username, or the
+// zero Posting when the wallet is not on the ledger yet.
+func getOpening(store DocStore, username string) (Posting, error) {
+	doc, err := getDoc(store, dbRpsLedger, openingID(username))
+	if err != nil || doc == nil {
+		return Posting{}, err
+	}
+
+	var opening Posting
+
+	err = json.Unmarshal(doc, &opening)
+
+	return opening, err
+}
+
+// openLedger puts the wallet of username on the ledger by posting whatever
+// its cached balance holds beyond what the ledger already accounts for. It
+// does nothing for a wallet that is already on it. A wallet written before
+// signing was introduced is signed again first, keeping its balance.
+func openLedger(store DocStore, username string) error {
+	_, err := resignLegacy(store, dbRpsWallet, "_id", username)
+	if err != nil {
+		return err
+	}
+
+	opened, err := hasOpening(store, username)
+	if err != nil || opened {
+		return err
+	}
+
+	balance, err := getBalance(store, username)
+	if err != nil || balance.ID == "" {
+		return err
+	}
+
+	s := newSettlement(store, "", username)
+
+	err = s.open(balance)
+	if err != nil {
+		return err
+	}
+
+	return s.commit()
+}
+
+// LedgerCheck compares the cached balance of a wallet with the balance the
+// ledger gives it.
+type LedgerCheck struct {
+	Cached int
+	Ledger int
+	Opened bool // whether the wallet is on the ledger yet
+}
+
+func (c LedgerCheck) Balanced() bool {
+	return c.Opened && c.Cached == c.Ledger
+}
+
+// verifyLedger checks that the cached balance of username's wallet equals
+// the sum of its postings.
+func verifyLedger(store DocStore, username string) (LedgerCheck, error) {
+	balance, err := getBalance(store, username)
+	if err != nil {
+		return LedgerCheck{}, err
+	}
+
+	opened, err := hasOpening(store, username)
+	if err != nil {
+		return LedgerCheck{}, err
+	}
+
+	ledger, err := ledgerBalance(store, walletAccount(username))
+	if err != nil {
+		return LedgerCheck{}, err
+	}
+
+	return LedgerCheck{
+		Cached: balance.Amount,
+		Ledger: ledger,
+		Opened: opened,
+	}, nil
+}
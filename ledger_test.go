@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestPostingNeverChanged(t *testing.T) {
+	players := newTestPlayers(t, 1000, "alice")
+	alice := players[0]
+
+	postings, err := getPostings(alice.store, walletAccount(alice.name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range postings {
+		p.Amount *= 2
+		postingJSON, _ := json.Marshal(p)
+
+		if err := alice.store.Put(dbRpsLedger, postingJSON); !errors.Is(err, errPostingExists) {
+			t.Fatalf("posting %s overwritten: %v", p.ID, err)
+		}
+	}
+
+	check, err := verifyLedger(alice.store, alice.name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !check.Balanced() || check.Ledger != 1000 {
+		t.Fatalf("ledger %+v", check)
+	}
+}
+
+func TestPostingOwners(t *testing.T) {
+	players := newTestPlayers(t, 1000, "alice", "bob")
+	alice, bob := players[0], players[1]
+
+	// a match bob plays with somebody else
+	m := openedMatch(t, bob, testPlayer{"carol", bob.store}, "99999999-9999-9999-9999-999999999991", 100)
+
+	tests := []struct {
+		name    string
+		posting Posting
+		valid   bool
+	}{
+		{"out of her wallet", Posting{ID: "p1", Debit: walletAccount(bob.name), Credit: walletAccount(alice.name)}, true},
+		{"out of another wallet", Posting{ID: "p2", Debit: walletAccount(alice.name), Credit: walletAccount(bob.name)}, false},
+		{"a deposit", Posting{ID: "p3", Debit: walletAccount(alice.name), Credit: accountExternal}, true},
+		{"a deposit to another wallet", Posting{ID: "p4", Debit: walletAccount(bob.name), Credit: accountExternal}, false},
+		{"out of the escrow of a match of others", Posting{ID: "p5", Debit: walletAccount(alice.name), Credit: escrowAccount(m.ID)}, false},
+		{"out of an unknown account", Posting{ID: "p6", Debit: walletAccount(alice.name), Credit: "bank"}, false},
+		{"opening another wallet", Posting{ID: openingID("carol"), Debit: walletAccount("carol"), Credit: accountOpening}, false},
+		{"opening a wallet from outside", Posting{ID: openingID("dave"), Debit: walletAccount(alice.name), Credit: accountExternal}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.posting.Amount = 100
+			postingJSON, _ := json.Marshal(tt.posting)
+
+			if err := alice.store.Put(dbRpsLedger, postingJSON); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := bob.store.Get(dbRpsLedger, tt.posting.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := []string{tt.posting.ID}
+			if !tt.valid {
+				want = nil
+			}
+
+			assertIDs(t, got, want)
+		})
+	}
+}
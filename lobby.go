@@ -0,0 +1,261 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mar1n3r0/rps/engine"
+	"github.com/maxence-charriere/go-app/v10/pkg/app"
+)
+
+type lobby struct {
+	app.Compo
+	store      DocStore
+	myPeerID   string
+	playerName string
+	rating     int
+	ratings    map[string]int
+	challenges []engine.Match
+}
+
+func (l *lobby) OnMount(ctx app.Context) {
+	var loggedIn bool
+	ctx.GetState("loggedIn", &loggedIn)
+	if !loggedIn {
+		ctx.Navigate("/")
+		return
+	}
+
+	l.store = newDocStore()
+
+	myPeerID, err := l.store.PeerID()
+	if err != nil {
+		ctx.Navigate("/")
+		return
+	}
+
+	l.myPeerID = myPeerID
+
+	ctx.GetState("playerName", &l.playerName)
+
+	l.getChallenges(ctx)
+}
+
+func (l *lobby) OnNav(ctx app.Context) {
+	url := ctx.Page().URL().Path
+	path := strings.ReplaceAll(url, "/", "")
+	linkElName := "link-" + path
+
+	if !app.Window().GetElementByID(linkElName).IsNull() && !app.Window().GetElementByID(linkElName).IsNaN() && !app.Window().GetElementByID(linkElName).IsUndefined() {
+		app.Window().GetElementByID(linkElName).Get("classList").Call("toggle", "active")
+	}
+}
+
+func (l *lobby) getChallenges(ctx app.Context) {
+	ctx.Async(func() {
+		matches, err := getAllMatches(l.store)
+		if err != nil {
+			ctx.Notifications().New(app.Notification{
+				Title: "Error",
+				Body:  err.Error(),
+			})
+			return
+		}
+
+		ratings := engine.Ratings(matches)
+
+		var challenges []engine.Match
+
+		for _, m := range matches {
+			if m.Status != engine.StatusPending || m.Expired(time.Now()) || m.Plays(l.playerName) {
+				continue
+			}
+
+			// free-for-alls with room left are joined by throwing
+			if m.Unclaimed() || m.FreeForAll() && engine.CanBet(m, l.playerName) == nil {
+				challenges = append(challenges, m)
+			}
+		}
+
+		ctx.Dispatch(func(ctx app.Context) {
+			l.ratings = ratings
+			l.rating = ratingOf(ratings, l.playerName)
+			l.challenges = challenges
+		})
+	})
+}
+
+// getAllMatches returns every match, newest first.
+func getAllMatches(store DocStore) ([]engine.Match, error) {
+	matchesJSON, err := store.Query(dbRpsChallenge, "all", "")
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.TrimSpace(string(matchesJSON)) == "null" || len(matchesJSON) == 0 {
+		return nil, nil
+	}
+
+	var matches []engine.Match
+
+	err = json.Unmarshal(matchesJSON, &matches)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].CreatedAt.After(matches[j].CreatedAt)
+	})
+
+	return matches, nil
+}
+
+// ratingOf returns the rating of username, who may not have played yet.
+func ratingOf(ratings map[string]int, username string) int {
+	if r, ok := ratings[username]; ok {
+		return r
+	}
+
+	return engine.InitialRating
+}
+
+// claimChallenge makes username the opponent of the posted challenge with
+// id. When two players claim it at the same time the version of the match
+// lets only one of them through, the other one gets engine.ErrClaimed.
+func claimChallenge(store DocStore, id, username string) (engine.Match, error) {
+	matches, err := getAllMatches(store)
+	if err != nil {
+		return engine.Match{}, err
+	}
+
+	rating := ratingOf(engine.Ratings(matches), username)
+
+	claimed, err := modifyMatch(store, id, func(m engine.Match) (engine.Match, error) {
+		return engine.Claim(m, username, rating, time.Now())
+	})
+	if err != nil {
+		return engine.Match{}, err
+	}
+
+	// a claim written over ours between the write and its check
+	latest, err := getMatch(store, id)
+	if err != nil {
+		return engine.Match{}, err
+	}
+
+	if latest.Opponent.Username != username {
+		return engine.Match{}, engine.ErrClaimed
+	}
+
+	return claimed, nil
+}
+
+// The Render method is where the component appearance is defined.
+func (l *lobby) Render() app.UI {
+	return app.Div().
+		Class("container").
+		Body(
+			newNav(),
+			app.Div().ID("main").Body(
+				app.Table().Body(
+					app.TBody().Body(
+						app.Tr().Body(
+							app.Td().ID("table-header").Text("Open Challenges").ColSpan(6),
+						),
+						app.Tr().Body(
+							app.Td().ColSpan(6).Text("Your rating: "+strconv.Itoa(l.rating)),
+						),
+						app.Tr().Body(
+							app.Td().Text("Host"),
+							app.Td().Text("Game"),
+							app.Td().Text("Stake"),
+							app.Td().Text("Ratings"),
+							app.Td().Text("Expires"),
+							app.Td().Text(""),
+						),
+						app.Range(l.challenges).Slice(func(i int) app.UI {
+							cc := l.challenges[i]
+
+							return app.Tr().Body(
+								app.Td().Text(cc.Host.Username+" ("+strconv.Itoa(ratingOf(l.ratings, cc.Host.Username))+")"),
+								app.If(cc.FreeForAll(), func() app.UI {
+									return app.Td().Text(modeTitle(cc.Mode) + ", free-for-all " + strconv.Itoa(len(cc.Players)) + "/" + strconv.Itoa(cc.Size))
+								}).Else(func() app.UI {
+									return app.Td().Text(modeTitle(cc.Mode) + matchLength(cc.BestOf))
+								}),
+								app.Td().Text(formatStake(cc.Stake)),
+								app.Td().Text(ratingRange(cc)),
+								app.Td().Text(expiresIn(cc, time.Now())),
+								app.Td().Body(
+									app.If(cc.FreeForAll(), func() app.UI {
+										return app.Button().
+											Class("challenge-btn").
+											Text("Join").
+											Value(cc.ID).
+											OnClick(l.joinFreeForAll)
+									}).ElseIf(cc.InRange(l.rating), func() app.UI {
+										return app.Button().
+											Class("challenge-btn").
+											Text("Accept").
+											Value(cc.ID).
+											OnClick(l.claimChallenge)
+									}).Else(func() app.UI {
+										return app.Text("Out of range")
+									}),
+								),
+							)
+						}),
+					),
+				),
+			),
+		)
+}
+
+// ratingRange describes the ratings that can claim a posted challenge.
+func ratingRange(cc engine.Match) string {
+	switch {
+	case cc.MinRating > 0 && cc.MaxRating > 0:
+		return strconv.Itoa(cc.MinRating) + "-" + strconv.Itoa(cc.MaxRating)
+	case cc.MinRating > 0:
+		return strconv.Itoa(cc.MinRating) + " and above"
+	case cc.MaxRating > 0:
+		return "Up to " + strconv.Itoa(cc.MaxRating)
+	}
+
+	return "Any"
+}
+
+// joinFreeForAll opens the match page of a free-for-all, the player joins
+// it with their throw.
+func (l *lobby) joinFreeForAll(ctx app.Context, e app.Event) {
+	ctx.Navigate("/match/" + ctx.JSSrc().Get("value").String())
+}
+
+func (l *lobby) claimChallenge(ctx app.Context, e app.Event) {
+	challengeID := ctx.JSSrc().Get("value").String()
+
+	ctx.Async(func() {
+		claimed, err := claimChallenge(l.store, challengeID, l.playerName)
+		if err != nil {
+			ctx.Notifications().New(app.Notification{
+				Title: "Error",
+				Body:  err.Error(),
+			})
+
+			// whoever got it first, the challenge is no longer open
+			l.getChallenges(ctx)
+			return
+		}
+
+		ctx.Dispatch(func(ctx app.Context) {
+			ctx.Notifications().New(app.Notification{
+				Title: "Success",
+				Body:  "You accepted the challenge of " + claimed.Host.Username + ". You can play once they place their bet.",
+			})
+			ctx.Navigate("/challenges")
+		})
+	})
+}
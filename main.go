@@ -8,22 +8,19 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
-	"regexp"
-	"strconv"
 	"strings"
 
+	"github.com/mar1n3r0/rps/engine"
 	"github.com/maxence-charriere/go-app/v10/pkg/app"
-	shell "github.com/stateless-minds/go-ipfs-api"
-	// shell "github.com/stateless-minds/go-ipfs-api"
 )
 
 // The main function is the entry point where the app is configured and started.
 // It is executed in 2 different environments: A client (the web browser) and a
 // server.
 func main() {
-	// sh := shell.NewShell("localhost:5001")
+	// store := newDocStore()
 
-	// populateItems(sh)
+	// populateItems(store)
 
 	// The first thing to do is to associate the hello component with a path.
 	//
@@ -37,6 +34,9 @@ func main() {
 	app.Route("/challenges", func() app.Composer { return &challenge{} })
 	app.Route("/transactions", func() app.Composer { return &transaction{} })
 	app.Route("/stats", func() app.Composer { return &stats{} })
+	app.Route("/history", func() app.Composer { return &history{} })
+	app.Route("/tournaments", func() app.Composer { return &tournaments{} })
+	app.Route("/lobby", func() app.Composer { return &lobby{} })
 	// Once the routes set up, the next thing to do is to either launch the app
 	// or the server that serves the app.
 	//
@@ -69,14 +69,34 @@ func main() {
 	}
 }
 
-func populateItems(sh *shell.Shell) {
-	err := sh.OrbitDocsDelete(dbRpsItem, "all")
+// populateItems replaces the items in the store with the ones defined in
+// web/items.json and the items of the cyclic game modes. Each item gets the
+// image from web/assets named after it.
+func populateItems(store DocStore) {
+	itemsJSON, err := os.ReadFile("./web/items.json")
 	if err != nil {
 		fmt.Println("Error:", err)
 		return
 	}
 
-	fmt.Println("completed deletion of existing items")
+	var items []engine.Item
+
+	err = json.Unmarshal(itemsJSON, &items)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+
+	items = append(items, engine.CyclicItems()...)
+
+	// refuse to seed a game that cannot be resolved
+	for _, mode := range engine.Modes() {
+		_, err = engine.NewRules(engine.ModeItems(items, mode))
+		if err != nil {
+			fmt.Println("Error:", mode, err)
+			return
+		}
+	}
 
 	folder := "./web/assets"
 	imagesMap, err := scanAndEncodeImages(folder)
@@ -85,25 +105,23 @@ func populateItems(sh *shell.Shell) {
 		return
 	}
 
-	var i int
-
+	images := make(map[string]string, len(imagesMap))
 	for filename, image := range imagesMap {
-		re := regexp.MustCompile(`^(rock|paper|scissors)\.jpeg$`)
-		matches := re.FindStringSubmatch(filename)
-
-		switch matches[1] {
-		case "rock":
-			i = 1
-		case "paper":
-			i = 2
-		case "scissors":
-			i = 3
-		}
+		images[strings.TrimSuffix(filename, filepath.Ext(filename))] = image
+	}
+
+	err = store.Delete(dbRpsItem, "all")
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+
+	fmt.Println("completed deletion of existing items")
 
-		item := Item{
-			ID:    strconv.Itoa(i),
-			Name:  matches[1],
-			Image: image,
+	for _, item := range items {
+		item.Image = images[item.Name]
+		if item.Image == "" {
+			fmt.Printf("Warning: no image for item %s in %s\n", item.Name, folder)
 		}
 
 		itemJSON, err := json.Marshal(item)
@@ -112,16 +130,14 @@ func populateItems(sh *shell.Shell) {
 			return
 		}
 
-		fmt.Printf("Filename: %s\n", filename) // Print a snippet for brevity
-
-		err = sh.OrbitDocsPut(dbRpsItem, itemJSON)
+		err = store.Put(dbRpsItem, itemJSON)
 		if err != nil {
 			fmt.Println("Error:", err)
 			return
 		}
-
-		fmt.Println("completed inserting items")
 	}
+
+	fmt.Println("completed inserting items")
 }
 
 // scanAndEncodeImages scans the given folder for image files and returns a map
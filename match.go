@@ -1,84 +1,32 @@
 package main
 
 import (
-	"encoding/json"
-	"reflect"
-	"sort"
+	"errors"
 	"strconv"
 	"strings"
 	"time"
 
-	"github.com/google/uuid"
+	"github.com/mar1n3r0/rps/engine"
 	"github.com/maxence-charriere/go-app/v10/pkg/app"
-	shell "github.com/stateless-minds/go-ipfs-api"
 )
 
 const dbRpsChallenge = "rps_challenge"
 const dbRpsItem = "rps_item"
 
-type Status string
-
-const (
-	StatusPending   Status = "pending"
-	StatusDeclined  Status = "declined"
-	StatusDraw      Status = "draw"
-	StatusCompleted Status = "completed"
-)
-
-type Outcome string
-
-const (
-	OutcomeWin  Outcome = "win"
-	OutcomeDraw Outcome = "draw"
-	OutcomeLoss Outcome = "loss"
-)
-
-type ItemType string
-
-const (
-	ItemRock     ItemType = "rock"
-	ItemPaper    ItemType = "paper"
-	ItemScissors ItemType = "scissors"
-)
-
 type match struct {
 	app.Compo
-	sh           *shell.Shell
+	store        DocStore
 	myPeerID     string
 	playerName   string
 	balance      int
 	matchID      string
-	match        Match
-	items        []Item
+	match        engine.Match
+	items        []engine.Item
+	rules        *engine.Rules
 	betAmount    float32
-	selectedItem ItemType
+	selectedItem engine.ItemType
 	itemSelected bool
-	outcome      Outcome
-	winner       string
-	loser        string
-}
-
-type Item struct {
-	ID    string `mapstructure:"_id" json:"_id" validate:"uuid_rfc4122"`     // ID
-	Name  string `mapstructure:"name" json:"name" validate:"uuid_rfc4122"`   // Name
-	Image string `mapstructure:"image" json:"image" validate:"uuid_rfc4122"` // Image base64
-}
-
-type Selection struct {
-	Username string
-	ItemName string
-	Bet      int
-}
-
-type Match struct {
-	ID           string    `mapstructure:"_id" json:"_id" validate:"uuid_rfc4122"`                     // ID
-	Status       Status    `mapstructure:"status" json:"status" validate:"uuid_rfc4122"`               // Status - pending, completed
-	BetAmount    int       `mapstructure:"bet_amount" json:"bet_amount" validate:"uuid_rfc4122"`       // Amount in cents
-	Host         Selection `mapstructure:"host" json:"host" validate:"uuid_rfc4122"`                   // Host selection
-	Opponent     Selection `mapstructure:"opponent" json:"opponent" validate:"uuid_rfc4122"`           // Opponent selection
-	Winner       string    `mapstructure:"winner" json:"winner" validate:"uuid_rfc4122"`               // Winner username
-	Loser        string    `mapstructure:"loser" json:"loser" validate:"uuid_rfc4122"`                 // Loser username
-	HostNotified bool      `mapstructure:"host_notified" json:"host_notified" validate:"uuid_rfc4122"` // Host Notified
+	chain        []engine.Match // rematch chain of a resolved match
 }
 
 func (m *match) OnMount(ctx app.Context) {
@@ -89,16 +37,15 @@ func (m *match) OnMount(ctx app.Context) {
 		return
 	}
 
-	sh := shell.NewShell("localhost:5001")
-	m.sh = sh
+	m.store = newDocStore()
 
-	myPeer, err := m.sh.ID()
+	myPeerID, err := m.store.PeerID()
 	if err != nil {
 		ctx.Navigate("/")
 		return
 	}
 
-	m.myPeerID = myPeer.ID
+	m.myPeerID = myPeerID
 
 	path := ctx.Page().URL().Path
 
@@ -106,7 +53,7 @@ func (m *match) OnMount(ctx app.Context) {
 
 	m.matchID = id
 
-	match, err := m.matchExists()
+	match, err := getMatch(m.store, m.matchID)
 	if err != nil {
 		ctx.Notifications().New(app.Notification{
 			Title: "Error",
@@ -115,7 +62,7 @@ func (m *match) OnMount(ctx app.Context) {
 		return
 	}
 
-	if !reflect.DeepEqual(match, Match{}) {
+	if match.ID != "" {
 		m.match = match
 	} else {
 		ctx.Navigate("404")
@@ -124,7 +71,48 @@ func (m *match) OnMount(ctx app.Context) {
 
 	ctx.GetState("playerName", &m.playerName)
 
-	balance, err := m.getBalance(ctx, m.playerName)
+	// a match that is over is shown, not played again
+	if match.Resolved() {
+		m.getChain(ctx)
+		return
+	}
+
+	if match.Expired(time.Now()) {
+		ctx.Notifications().New(app.Notification{
+			Title: "Error",
+			Body:  "This challenge has expired.",
+		})
+		ctx.Navigate("/challenges")
+		return
+	}
+
+	if match.Overdue(time.Now()) {
+		ctx.Notifications().New(app.Notification{
+			Title: "Error",
+			Body:  "The deadline of this match has passed, it is settled on the challenges page.",
+		})
+		ctx.Navigate("/challenges")
+		return
+	}
+
+	err = engine.CanBet(match, m.playerName)
+	if errors.Is(err, engine.ErrStakeNotAgreed) {
+		ctx.Notifications().New(app.Notification{
+			Title: "Error",
+			Body:  "Agree on the stake on the challenges page first.",
+		})
+		ctx.Navigate("/challenges")
+		return
+	} else if err != nil {
+		ctx.Notifications().New(app.Notification{
+			Title: "Error",
+			Body:  "You cannot bet on this match: " + err.Error() + ".",
+		})
+		ctx.Navigate("/challenges")
+		return
+	}
+
+	balance, err := getBalance(m.store, m.playerName)
 	if err != nil {
 		ctx.Notifications().New(app.Notification{
 			Title: "Error",
@@ -133,8 +121,9 @@ func (m *match) OnMount(ctx app.Context) {
 		return
 	}
 
-	if !reflect.DeepEqual(balance, Balance{}) {
-		if balance.Amount == 0 {
+	if balance.ID != "" {
+		// the later rounds of a series and tournament matches take no bet
+		if balance.Amount == 0 && match.NeedsBet() {
 			ctx.Notifications().New(app.Notification{
 				Title: "Error",
 				Body:  "Your balance is zero. Top up and come back.",
@@ -152,29 +141,28 @@ func (m *match) OnMount(ctx app.Context) {
 	m.getItems(ctx)
 }
 
-func (m *match) matchExists() (Match, error) {
-	matchJSON, err := m.sh.OrbitDocsGet(dbRpsChallenge, m.matchID)
-	if err != nil {
-		return Match{}, err
-	}
-
-	var matches []Match
-
-	if strings.TrimSpace(string(matchJSON)) != "null" && len(matchJSON) > 0 {
-		err = json.Unmarshal(matchJSON, &matches)
+func (m *match) getChain(ctx app.Context) {
+	ctx.Async(func() {
+		matches, err := getAllMatches(m.store)
 		if err != nil {
-			return Match{}, err
+			ctx.Notifications().New(app.Notification{
+				Title: "Error",
+				Body:  err.Error(),
+			})
+			return
 		}
-	} else {
-		return Match{}, nil
-	}
 
-	return matches[0], nil
+		chain := engine.Chain(matches, m.match)
+
+		ctx.Dispatch(func(ctx app.Context) {
+			m.chain = chain
+		})
+	})
 }
 
 func (m *match) getItems(ctx app.Context) {
 	ctx.Async(func() {
-		itemsJSON, err := m.sh.OrbitDocsQuery(dbRpsItem, "all", "")
+		mode, err := engine.ParseMode(m.match.Mode)
 		if err != nil {
 			ctx.Notifications().New(app.Notification{
 				Title: "Error",
@@ -183,61 +171,27 @@ func (m *match) getItems(ctx app.Context) {
 			return
 		}
 
-		if strings.TrimSpace(string(itemsJSON)) != "null" && len(itemsJSON) > 0 {
-			var items []Item
-
-			err = json.Unmarshal(itemsJSON, &items)
-			if err != nil {
-				ctx.Notifications().New(app.Notification{
-					Title: "Error",
-					Body:  err.Error(),
-				})
-				return
-			}
-
-			ctx.Dispatch(func(ctx app.Context) {
-				m.items = items
-
-				// Sort by ID
-				sort.Slice(items, func(i, j int) bool {
-					vi, _ := strconv.Atoi(m.items[i].ID) // Convert string to int
-					vj, _ := strconv.Atoi(m.items[j].ID)
-					return vi < vj
-				})
-			})
-		}
-	})
-}
-
-func (m *match) getBalance(ctx app.Context, playerName string) (Balance, error) {
-	accountJSON, err := m.sh.OrbitDocsGet(dbRpsWallet, playerName)
-	if err != nil {
-		ctx.Notifications().New(app.Notification{
-			Title: "Error",
-			Body:  err.Error(),
-		})
-		return Balance{}, err
-	}
-
-	if strings.TrimSpace(string(accountJSON)) != "null" && len(accountJSON) > 0 {
-		var balances []Balance
-
-		err = json.Unmarshal(accountJSON, &balances)
+		items, rules, err := getRules(m.store, mode)
 		if err != nil {
 			ctx.Notifications().New(app.Notification{
 				Title: "Error",
 				Body:  err.Error(),
 			})
-			return Balance{}, err
+			return
 		}
 
-		return balances[0], nil
-	} else {
-		return Balance{}, nil
-	}
+		ctx.Dispatch(func(ctx app.Context) {
+			m.items = items
+			m.rules = rules
+		})
+	})
 }
 
 func (m *match) Render() app.UI {
+	if m.match.Resolved() {
+		return m.renderResult()
+	}
+
 	return app.Div().
 		Class("container").
 		Body(
@@ -252,24 +206,47 @@ func (m *match) Render() app.UI {
 							app.H2().Text("Match"),
 							app.Div().Class("span-container").Body(
 								app.Span().Text("Balance: €"+strconv.FormatFloat(float64(float32(m.balance)/100), 'f', 2, 32)),
-								app.Span().Text("Opponent: "+m.match.Opponent.Username),
+								app.If(m.match.FreeForAll(), func() app.UI {
+									return app.Span().Text("Players: " + playersText(m.match))
+								}).Else(func() app.UI {
+									return app.Span().Text("Opponent: " + m.match.Opponent.Username)
+								}),
+								app.Span().Text("Game: "+m.modeTitle()),
+								app.If(m.match.IsSeries(), func() app.UI {
+									return app.Span().Text("Round " + strconv.Itoa(m.match.Round()) + ": " + seriesText(m.match, m.playerName))
+								}),
 							),
 							app.Div().Body(
-								app.Label().For("bet-amount").Text("Bet Amount"),
-								app.Input().
-									ID("bet-amount").
-									Name("bet-amount").
-									Type("number").
-									Min(0.1).
-									Step(0.1).
-									Required(true).
-									Placeholder("0.1").
-									OnChange(m.ValueTo(&m.betAmount)),
+								app.If(m.match.NeedsBet(), func() app.UI {
+									return app.Label().For("bet-amount").Text("Bet Amount")
+								}),
+								app.If(m.match.NeedsBet() && m.match.StakeAgreed, func() app.UI {
+									return app.Input().
+										ID("bet-amount").
+										Name("bet-amount").
+										Type("number").
+										ReadOnly(true).
+										Value(strconv.FormatFloat(float64(m.match.Stake)/100, 'f', 2, 64))
+								}).ElseIf(m.match.NeedsBet(), func() app.UI {
+									return app.Input().
+										ID("bet-amount").
+										Name("bet-amount").
+										Type("number").
+										Min(0.1).
+										Step(0.1).
+										Required(true).
+										Placeholder("0.1").
+										OnChange(m.ValueTo(&m.betAmount))
+								}),
 								app.Span().Class("label").Text("Select Option"),
 								app.Div().ID("inventory").Body(
 									app.Range(m.items).Slice(func(i int) app.UI {
 										return app.Div().ID("card-" + m.items[i].Name).Class("card").Body(
-											app.Img().Class("selectable").DataSet("value", m.items[i].Name).Src("data:image/jpeg;base64," + m.items[i].Image).OnClick(m.selectItem),
+											app.If(m.items[i].Image != "", func() app.UI {
+												return app.Img().Class("selectable").DataSet("value", m.items[i].Name).Src("data:image/jpeg;base64," + m.items[i].Image).OnClick(m.selectItem)
+											}).Else(func() app.UI {
+												return app.Span().Class("selectable").DataSet("value", m.items[i].Name).Text(m.items[i].Name).OnClick(m.selectItem)
+											}),
 										)
 									}),
 								),
@@ -283,88 +260,278 @@ func (m *match) Render() app.UI {
 		)
 }
 
-func (m *match) selectItem(ctx app.Context, e app.Event) {
-	e.PreventDefault()
+// renderResult renders a match that is over: both picks, the stakes and
+// how it ended.
+func (m *match) renderResult() app.UI {
+	mine, theirs := picks(m.match, m.playerName)
 
-	v := ctx.JSSrc().Call("getAttribute", "data-value").String()
+	return app.Div().
+		Class("container").
+		Body(
+			newNav(),
+			app.Div().ID("main").Body(
+				app.Table().Body(
+					app.TBody().Body(
+						app.Tr().Body(
+							app.Td().ID("table-header").Text("Match Result").ColSpan(2),
+						),
+						app.Tr().Body(
+							app.Td().Text("Outcome"),
+							app.Td().Text(outcomeText(m.match, m.playerName)),
+						),
+						app.Tr().Body(
+							app.Td().Text("Opponent"),
+							app.Td().Text(strings.Join(m.match.Others(m.playerName), ", ")),
+						),
+						app.Tr().Body(
+							app.Td().Text("Game"),
+							app.Td().Text(m.modeTitle()),
+						),
+						app.Tr().Body(
+							app.Td().Text("Your Pick"),
+							app.Td().Text(mine),
+						),
+						app.If(!m.match.FreeForAll(), func() app.UI {
+							return app.Tr().Body(
+								app.Td().Text("Their Pick"),
+								app.Td().Text(theirs),
+							)
+						}),
+						app.Tr().Body(
+							app.Td().Text("Your Stake"),
+							app.Td().Text(formatStake(m.stakeOf(m.playerName))),
+						),
+						app.If(!m.match.FreeForAll(), func() app.UI {
+							return app.Tr().Body(
+								app.Td().Text("Their Stake"),
+								app.Td().Text(formatStake(m.stakeOf(m.match.OpponentOf(m.playerName)))),
+							)
+						}),
+						app.Range(m.match.Players).Slice(func(i int) app.UI {
+							p := m.match.Players[i]
+
+							return app.Tr().Body(
+								app.Td().Text(p.Username),
+								app.Td().Text(pickName(p, p.Commitment != "")+" - "+throwText(m.match, p.Username)),
+							)
+						}),
+						app.Tr().Body(
+							app.Td().Text("Date"),
+							app.Td().Text(matchDate(m.match)),
+						),
+						app.If(len(m.chain) > 1, func() app.UI {
+							return app.Tr().Body(
+								app.Td().Text("Rematches"),
+								app.Td().Body(
+									app.Text(chainText(m.chain, m.match)+" "),
+									app.A().Href("/history").Text("See history"),
+								),
+							)
+						}),
+						app.If(m.canRematch(), func() app.UI {
+							return app.Tr().Body(
+								app.Td().Text("Play Again"),
+								app.Td().Body(
+									app.Button().
+										Class("challenge-btn").
+										Text("Rematch").
+										OnClick(m.rematch),
+									app.Button().
+										Class("challenge-btn").
+										Text("Double or Nothing").
+										OnClick(m.doubleOrNothing),
+								),
+							)
+						}),
+						app.Range(m.match.Rounds).Slice(func(i int) app.UI {
+							mine, theirs := roundPicks(m.match, m.match.Rounds[i], m.playerName)
+
+							return app.Tr().Body(
+								app.Td().Text("Round "+strconv.Itoa(i+1)),
+								app.Td().Text(mine+" vs "+theirs+" - "+roundText(m.match.Rounds[i], m.playerName)),
+							)
+						}),
+						app.If(len(m.match.Transitions) > 0, func() app.UI {
+							return app.Tr().Body(
+								app.Td().ID("table-header").Text("Log").ColSpan(2),
+							)
+						}),
+						app.Range(m.match.Transitions).Slice(func(i int) app.UI {
+							t := m.match.Transitions[i]
+
+							return app.Tr().Body(
+								app.Td().Text(t.At.Local().Format("2006-01-02 15:04:05")),
+								app.Td().Text(transitionText(t)),
+							)
+						}),
+						app.Tr().Body(
+							app.Td().ColSpan(2).Body(
+								app.A().Href("/history").Text("Back to history"),
+							),
+						),
+					),
+				),
+			),
+		)
+}
 
-	m.selectedItem = ItemType(v)
+// canRematch reports whether the player can challenge their opponent again
+// from this match: it was played out for a stake and nobody rematched it yet.
+func (m *match) canRematch() bool {
+	if m.match.Status != engine.StatusCompleted && m.match.Status != engine.StatusDraw {
+		return false
+	}
 
-	items := app.Window().Get("document").Call("querySelectorAll", ".selectable")
+	if m.match.TournamentID != "" || m.match.FreeForAll() || m.match.Stake <= 0 || m.match.RematchID != "" {
+		return false
+	}
 
-	for i := 0; i < items.Length(); i++ {
-		items.Index(i).Get("classList").Call("remove", "active")
+	if m.playerName != m.match.Host.Username && m.playerName != m.match.Opponent.Username {
+		return false
 	}
 
-	ctx.JSSrc().Get("classList").Call("add", "active")
+	return len(m.chain) > 0 && m.chain[len(m.chain)-1].ID == m.match.ID
+}
 
-	m.itemSelected = true
+// chainText tells where m stands in its chain of rematches.
+func chainText(chain []engine.Match, m engine.Match) string {
+	for i, c := range chain {
+		if c.ID == m.ID {
+			return "Match " + strconv.Itoa(i+1) + " of " + strconv.Itoa(len(chain))
+		}
+	}
+
+	return ""
 }
 
-func (m *match) updateMatch(ctx app.Context, e app.Event) {
-	e.PreventDefault()
+func (m *match) rematch(ctx app.Context, e app.Event) {
+	m.createRematch(ctx, false)
+}
 
-	if !m.itemSelected {
-		ctx.Notifications().New(app.Notification{
-			Title: "Error",
-			Body:  "Please select option",
+func (m *match) doubleOrNothing(ctx app.Context, e app.Event) {
+	m.createRematch(ctx, true)
+}
+
+func (m *match) createRematch(ctx app.Context, double bool) {
+	ctx.Async(func() {
+		rematch, err := createRematch(m.store, m.match.ID, m.playerName, double)
+		if err != nil {
+			ctx.Notifications().New(app.Notification{
+				Title: "Error",
+				Body:  err.Error(),
+			})
+			return
+		}
+
+		ctx.Dispatch(func(ctx app.Context) {
+			ctx.Notifications().New(app.Notification{
+				Title: "Success",
+				Body:  "Rematch sent for " + formatStake(rematch.Stake) + ". You can place your bet once " + rematch.Opponent.Username + " agrees to the stake.",
+			})
+			ctx.Navigate("/challenges")
 		})
-		return
+	})
+}
+
+// roundPicks returns the items username and their opponent played in a
+// round of m.
+func roundPicks(m engine.Match, r engine.Round, username string) (mine, theirs string) {
+	if username == m.Host.Username {
+		return r.Host, r.Opponent
 	}
 
-	betAmount := int(m.betAmount * 100)
+	return r.Opponent, r.Host
+}
 
-	if m.balance-betAmount < 0 {
-		ctx.Notifications().New(app.Notification{
-			Title: "Error",
-			Body:  "Not enough funds",
-		})
-		return
+func roundText(r engine.Round, username string) string {
+	switch r.Winner {
+	case "":
+		return "Tie"
+	case username:
+		return "Won"
 	}
 
-	// update balance
-	newBalance := m.balance - betAmount
+	return "Lost"
+}
 
-	m.updateBalance(ctx, m.playerName, newBalance)
+// transitionText describes an entry of the transition log of a match.
+func transitionText(t engine.Transition) string {
+	by := t.By
+	if by == "" {
+		by = "Time limit"
+	}
 
-	m.storeTransaction(ctx, m.playerName, TypeCredit, betAmount)
+	return by + ": " + strings.ReplaceAll(string(t.Event), "_", " ") + " (" + strings.ReplaceAll(t.From.String(), "_", " ") + " → " + strings.ReplaceAll(t.To.String(), "_", " ") + ")"
+}
 
-	if m.match.Opponent.Username == m.playerName {
-		m.settleOutcome()
+// throwText tells how the throw of username fared in a free-for-all.
+func throwText(m engine.Match, username string) string {
+	switch {
+	case m.Won(username):
+		return "Survived"
+	case m.Status == engine.StatusCompleted:
+		return "Beaten"
+	case m.Status == engine.StatusDraw:
+		return "Refunded"
 	}
 
-	m.saveMatch(ctx, betAmount)
+	return statusText(m, username)
+}
 
-	if m.match.Opponent.Username == m.playerName {
-		switch m.outcome {
-		case OutcomeWin, OutcomeLoss:
-			m.payWinner(ctx)
-		case OutcomeDraw:
-			m.doRefunds(ctx)
+func (m *match) stakeOf(username string) int {
+	for _, p := range m.match.Players {
+		if p.Username == username {
+			return p.Bet
 		}
 	}
 
-	m.notifyPlayer(ctx)
+	if username == m.match.Host.Username {
+		return m.match.Host.Bet
+	}
 
-	ctx.Navigate("/challenges")
+	return m.match.Opponent.Bet
 }
 
-func (m *match) updateBalance(ctx app.Context, playerName string, newBalance int) {
-	balance := Balance{
-		ID:     playerName,
-		Amount: newBalance,
+func (m *match) modeTitle() string {
+	mode, err := engine.ParseMode(m.match.Mode)
+	if err != nil {
+		return m.match.Mode
 	}
 
-	ballanceJSON, err := json.Marshal(balance)
-	if err != nil {
+	return mode.Title()
+}
+
+func (m *match) selectItem(ctx app.Context, e app.Event) {
+	e.PreventDefault()
+
+	v := ctx.JSSrc().Call("getAttribute", "data-value").String()
+
+	m.selectedItem = engine.ItemType(v)
+
+	items := app.Window().Get("document").Call("querySelectorAll", ".selectable")
+
+	for i := 0; i < items.Length(); i++ {
+		items.Index(i).Get("classList").Call("remove", "active")
+	}
+
+	ctx.JSSrc().Get("classList").Call("add", "active")
+
+	m.itemSelected = true
+}
+
+func (m *match) updateMatch(ctx app.Context, e app.Event) {
+	e.PreventDefault()
+
+	if !m.itemSelected {
 		ctx.Notifications().New(app.Notification{
 			Title: "Error",
-			Body:  err.Error(),
+			Body:  "Please select option",
 		})
 		return
 	}
 
-	err = m.sh.OrbitDocsPut(dbRpsWallet, ballanceJSON)
+	// the match may have moved on since the page was opened
+	latest, err := getMatch(m.store, m.matchID)
 	if err != nil {
 		ctx.Notifications().New(app.Notification{
 			Title: "Error",
@@ -373,152 +540,101 @@ func (m *match) updateBalance(ctx app.Context, playerName string, newBalance int
 		return
 	}
 
-	m.balance = newBalance
-}
-
-func (m *match) storeTransaction(ctx app.Context, playerName string, transactionType TransactionType, amount int) {
-	transaction := Transaction{
-		ID:        uuid.NewString(),
-		Username:  playerName,
-		Type:      transactionType,
-		Amount:    amount,
-		Timestamp: time.Now(),
-	}
-
-	transactionJSON, err := json.Marshal(transaction)
-	if err != nil {
+	if latest.Resolved() {
+		m.match = latest
 		ctx.Notifications().New(app.Notification{
 			Title: "Error",
-			Body:  err.Error(),
+			Body:  "This match is already over.",
 		})
 		return
 	}
 
-	err = m.sh.OrbitDocsPut(dbRpsTransaction, transactionJSON)
+	err = engine.CanBet(latest, m.playerName)
 	if err != nil {
 		ctx.Notifications().New(app.Notification{
 			Title: "Error",
-			Body:  err.Error(),
+			Body:  "You cannot bet on this match: " + err.Error() + ".",
 		})
 		return
 	}
-}
 
-func (m *match) settleOutcome() {
-	switch m.match.Host.ItemName {
-	case string(ItemRock):
-		switch m.selectedItem {
-		case ItemRock:
-			m.outcome = OutcomeDraw
-		case ItemPaper:
-			m.outcome = OutcomeWin
-		case ItemScissors:
-			m.outcome = OutcomeLoss
-		}
-	case string(ItemPaper):
-		switch m.selectedItem {
-		case ItemRock:
-			m.outcome = OutcomeLoss
-		case ItemPaper:
-			m.outcome = OutcomeDraw
-		case ItemScissors:
-			m.outcome = OutcomeWin
-		}
-	case string(ItemScissors):
-		switch m.selectedItem {
-		case ItemRock:
-			m.outcome = OutcomeWin
-		case ItemPaper:
-			m.outcome = OutcomeLoss
-		case ItemScissors:
-			m.outcome = OutcomeDraw
-		}
+	m.match = latest
+
+	betAmount := int(m.betAmount * 100)
+	if !m.match.NeedsBet() {
+		// the bets of a series are staked in its first round, tournament
+		// matches are played for the prize pool
+		betAmount = 0
+	} else if m.match.StakeAgreed {
+		// the amount both players agreed to on the challenges page
+		betAmount = m.match.Stake
 	}
 
-	switch m.outcome {
-	case OutcomeWin:
-		m.winner = m.match.Opponent.Username
-		m.loser = m.match.Host.Username
-	case OutcomeLoss:
-		m.winner = m.match.Host.Username
-		m.loser = m.match.Opponent.Username
+	if m.balance-betAmount < 0 {
+		ctx.Notifications().New(app.Notification{
+			Title: "Error",
+			Body:  "Not enough funds",
+		})
+		return
 	}
-}
 
-func (m *match) saveMatch(ctx app.Context, betAmount int) {
-	if m.match.Host.Username == m.playerName {
-		m.match.BetAmount = betAmount
-		m.match.Host.ItemName = string(m.selectedItem)
-		m.match.Host.Bet = betAmount
-	} else {
-		m.match.BetAmount += betAmount
-		m.match.Opponent.ItemName = string(m.selectedItem)
-		m.match.Opponent.Bet = betAmount
-
-		if m.outcome != OutcomeDraw {
-			m.match.Status = StatusCompleted
-			m.match.Winner = m.winner
-			m.match.Loser = m.loser
-		} else {
-			m.match.Status = StatusDraw
-		}
+	if m.match.Expired(time.Now()) {
+		ctx.Notifications().New(app.Notification{
+			Title: "Error",
+			Body:  "This challenge has expired.",
+		})
+		return
 	}
 
-	matchJSON, err := json.Marshal(m.match)
-	if err != nil {
+	if m.match.Overdue(time.Now()) {
 		ctx.Notifications().New(app.Notification{
 			Title: "Error",
-			Body:  err.Error(),
+			Body:  "The deadline of this match has passed, it is settled on the challenges page.",
 		})
 		return
 	}
 
-	err = m.sh.OrbitDocsPut(dbRpsChallenge, matchJSON)
-	if err != nil {
+	if m.rules == nil {
 		ctx.Notifications().New(app.Notification{
 			Title: "Error",
-			Body:  err.Error(),
+			Body:  "Game items are not loaded yet",
 		})
 		return
 	}
-}
 
-func (m *match) payWinner(ctx app.Context) {
-	switch m.outcome {
-	case OutcomeWin:
-		newBalance := m.balance + m.match.BetAmount
-		m.updateBalance(ctx, m.playerName, newBalance)
-		m.storeTransaction(ctx, m.playerName, TypeDebit, m.match.BetAmount)
-	case OutcomeLoss:
-		balanceHost, err := m.getBalance(ctx, m.match.Host.Username)
-		if err != nil {
-			ctx.Notifications().New(app.Notification{
-				Title: "Error",
-				Body:  err.Error(),
-			})
-			return
+	selection := engine.Selection{
+		Username: m.playerName,
+		ItemName: string(m.selectedItem),
+		Bet:      betAmount,
+	}
+
+	var (
+		match  engine.Match
+		stakes []engine.Movement
+	)
+
+	if m.match.FreeForAll() || m.match.Host.Username == m.playerName {
+		var salt string
+
+		salt, err = engine.NewSalt()
+		if err == nil && m.match.FreeForAll() {
+			match, stakes, err = engine.Throw(m.rules, m.match, selection, salt, time.Now())
+		} else if err == nil {
+			match, stakes, err = engine.Open(m.rules, m.match, selection, salt, time.Now())
 		}
 
-		if !reflect.DeepEqual(balanceHost, Balance{}) {
-			newBalance := balanceHost.Amount + m.match.BetAmount
-			m.updateBalance(ctx, m.match.Host.Username, newBalance)
-			m.storeTransaction(ctx, m.match.Host.Username, TypeDebit, m.match.BetAmount)
-		} else {
-			ctx.Notifications().New(app.Notification{
-				Title: "Error",
-				Body:  "Could not transfer funds to winner. Wallet not found.",
-			})
-			return
+		if err == nil {
+			// the item stays in this browser until the opponent has played,
+			// or every player of a free-for-all has thrown
+			ctx.SetState(commitSecretKey(m.match.ID), commitSecret{
+				Item: selection.ItemName,
+				Salt: salt,
+			}).Persist()
 		}
+	} else {
+		match, stakes, err = engine.Play(m.rules, m.match, selection, time.Now())
 	}
-}
-
-func (m *match) doRefunds(ctx app.Context) {
-	balanceOpponent := m.balance + m.match.Opponent.Bet
-	m.updateBalance(ctx, m.playerName, balanceOpponent)
-	m.storeTransaction(ctx, m.playerName, TypeDebit, m.match.Opponent.Bet)
 
-	balanceHost, err := m.getBalance(ctx, m.match.Host.Username)
 	if err != nil {
 		ctx.Notifications().New(app.Notification{
 			Title: "Error",
@@ -527,40 +643,58 @@ func (m *match) doRefunds(ctx app.Context) {
 		return
 	}
 
-	if !reflect.DeepEqual(balanceHost, Balance{}) {
-		newBalance := balanceHost.Amount + m.match.Host.Bet
-		m.updateBalance(ctx, m.match.Host.Username, newBalance)
-		m.storeTransaction(ctx, m.match.Host.Username, TypeDebit, m.match.Host.Bet)
-	} else {
+	s, err := settleMatch(m.store, m.playerName, match, stakes)
+	if err != nil {
 		ctx.Notifications().New(app.Notification{
 			Title: "Error",
-			Body:  "Could not transfer funds to winner. Wallet not found.",
+			Body:  err.Error(),
 		})
 		return
 	}
+
+	if balance, ok := s.balance(m.playerName); ok {
+		m.balance = balance
+	}
+
+	m.match = match
+
+	m.notifyPlayer(ctx)
+
+	ctx.Navigate("/challenges")
 }
 
 func (m *match) notifyPlayer(ctx app.Context) {
-	switch m.outcome {
-	case OutcomeWin:
-		ctx.Notifications().New(app.Notification{
-			Title: "Congrats",
-			Body:  "You won the match",
-		})
-	case OutcomeLoss:
+	if m.match.FreeForAll() {
+		body := "Your throw is in. Every player reveals once " + strconv.Itoa(m.match.Size-m.match.Thrown()) + " more have thrown."
+		if m.match.Status == engine.StatusAwaitingReveal {
+			body = "Your throw is in. The free-for-all is settled once every player has revealed on their challenges page."
+		}
+
 		ctx.Notifications().New(app.Notification{
-			Title: "Try again",
-			Body:  "You lost the match",
+			Title: "Success",
+			Body:  body,
 		})
-	case OutcomeDraw:
+		return
+	}
+
+	switch m.match.Status {
+	case engine.StatusPending:
+		if !m.match.NeedsBet() {
+			ctx.Notifications().New(app.Notification{
+				Title: "Success",
+				Body:  "Your move for round " + strconv.Itoa(m.match.Round()) + " is in. " + m.match.Opponent.Username + " plays next.",
+			})
+			return
+		}
+
 		ctx.Notifications().New(app.Notification{
-			Title: "A tie",
-			Body:  "It was a draw. Bets refunded.",
+			Title: "Success",
+			Body:  "Challenge created.",
 		})
-	case "":
+	case engine.StatusAwaitingReveal:
 		ctx.Notifications().New(app.Notification{
 			Title: "Success",
-			Body:  "Challenge created.",
+			Body:  "Your move is in. The match is settled once " + m.match.Host.Username + " reveals.",
 		})
 	}
 }
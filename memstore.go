@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"sync"
+)
+
+// memStore is a DocStore that keeps every collection in memory. It mirrors
+// the behaviour of the OrbitDB docstores the components are written
+// against, so game flows can run without an IPFS daemon.
+type memStore struct {
+	data   *memData
+	peerID string
+}
+
+type memData struct {
+	mu          sync.Mutex
+	collections map[string]*memCollection
+	keys        map[string]ed25519.PrivateKey
+}
+
+// memCollection keeps documents in insertion order so that results are
+// stable between calls.
+type memCollection struct {
+	ids  []string
+	docs map[string]json.RawMessage
+}
+
+func newMemStore(peerID string) *memStore {
+	return &memStore{
+		data: &memData{
+			collections: make(map[string]*memCollection),
+			keys:        make(map[string]ed25519.PrivateKey),
+		},
+		peerID: peerID,
+	}
+}
+
+// withPeer returns a store that shares the documents of s but reports
+// peerID as its own, so several players can be simulated against one
+// database.
+func (s *memStore) withPeer(peerID string) *memStore {
+	return &memStore{
+		data:   s.data,
+		peerID: peerID,
+	}
+}
+
+func (s *memStore) Get(db, id string) ([]byte, error) {
+	s.data.mu.Lock()
+	defer s.data.mu.Unlock()
+
+	c, ok := s.data.collections[db]
+	if !ok {
+		return docsJSON(nil)
+	}
+
+	doc, ok := c.docs[id]
+	if !ok {
+		return docsJSON(nil)
+	}
+
+	return docsJSON([]json.RawMessage{doc})
+}
+
+func (s *memStore) Query(db, field, value string) ([]byte, error) {
+	s.data.mu.Lock()
+	defer s.data.mu.Unlock()
+
+	c, ok := s.data.collections[db]
+	if !ok {
+		return docsJSON(nil)
+	}
+
+	var docs []json.RawMessage
+
+	for _, id := range c.ids {
+		doc := c.docs[id]
+
+		if field == "all" {
+			docs = append(docs, doc)
+			continue
+		}
+
+		match, err := fieldEquals(doc, field, value)
+		if err != nil {
+			return nil, err
+		}
+
+		if match {
+			docs = append(docs, doc)
+		}
+	}
+
+	return docsJSON(docs)
+}
+
+func (s *memStore) Put(db string, doc []byte) error {
+	var key struct {
+		ID *string `json:"_id"`
+	}
+
+	err := json.Unmarshal(doc, &key)
+	if err != nil {
+		return err
+	}
+
+	if key.ID == nil || *key.ID == "" {
+		return errors.New("document has no _id")
+	}
+
+	s.data.mu.Lock()
+	defer s.data.mu.Unlock()
+
+	c, ok := s.data.collections[db]
+	if !ok {
+		c = &memCollection{
+			docs: make(map[string]json.RawMessage),
+		}
+		s.data.collections[db] = c
+	}
+
+	if _, ok := c.docs[*key.ID]; !ok {
+		c.ids = append(c.ids, *key.ID)
+	}
+
+	c.docs[*key.ID] = append(json.RawMessage(nil), doc...)
+
+	return nil
+}
+
+func (s *memStore) Delete(db, id string) error {
+	s.data.mu.Lock()
+	defer s.data.mu.Unlock()
+
+	c, ok := s.data.collections[db]
+	if !ok {
+		return nil
+	}
+
+	if id == "all" {
+		delete(s.data.collections, db)
+		return nil
+	}
+
+	if _, ok := c.docs[id]; !ok {
+		return nil
+	}
+
+	delete(c.docs, id)
+
+	for i, cid := range c.ids {
+		if cid == id {
+			c.ids = append(c.ids[:i], c.ids[i+1:]...)
+			break
+		}
+	}
+
+	return nil
+}
+
+func (s *memStore) PeerID() (string, error) {
+	return s.peerID, nil
+}
+
+// Sign signs data with a key generated for the peer on first use. The keys
+// of all peers sharing the store stand in for the public keys a real
+// network would look up.
+func (s *memStore) Sign(data []byte) (string, error) {
+	s.data.mu.Lock()
+	defer s.data.mu.Unlock()
+
+	key, ok := s.data.keys[s.peerID]
+	if !ok {
+		var err error
+
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return "", err
+		}
+
+		s.data.keys[s.peerID] = key
+	}
+
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(key, data)), nil
+}
+
+func (s *memStore) Verify(peerID string, data []byte, signature string) (bool, error) {
+	s.data.mu.Lock()
+	key, ok := s.data.keys[peerID]
+	s.data.mu.Unlock()
+
+	if !ok {
+		return false, nil
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return false, nil
+	}
+
+	return ed25519.Verify(key.Public().(ed25519.PublicKey), data, sig), nil
+}
+
+// docsJSON encodes a result set the way the daemon does: a JSON array, or
+// the literal null when it is empty.
+func docsJSON(docs []json.RawMessage) ([]byte, error) {
+	if len(docs) == 0 {
+		return []byte("null"), nil
+	}
+
+	return json.Marshal(docs)
+}
+
+// fieldEquals reports whether the top level field of doc equals value.
+// Strings are compared by content, any other JSON value by its encoding,
+// so that "true" matches a boolean and "42" a number.
+func fieldEquals(doc json.RawMessage, field, value string) (bool, error) {
+	var fields map[string]json.RawMessage
+
+	err := json.Unmarshal(doc, &fields)
+	if err != nil {
+		return false, err
+	}
+
+	raw, ok := fields[field]
+	if !ok {
+		return false, nil
+	}
+
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s == value, nil
+	}
+
+	return string(bytes.TrimSpace(raw)) == value, nil
+}
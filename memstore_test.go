@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMemStoreQuery(t *testing.T) {
+	s := newMemStore("p1")
+
+	for _, doc := range []string{
+		`{"_id":"a","status":"pending","bet":5,"open":true}`,
+		`{"_id":"b","status":"completed","bet":10,"open":false}`,
+		`{"_id":"c","status":"pending","bet":10}`,
+	} {
+		if err := s.Put("rps_test", []byte(doc)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// replaces a in place rather than adding a document
+	if err := s.Put("rps_test", []byte(`{"_id":"a","status":"draw","bet":5,"open":true}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		db    string
+		field string
+		value string
+		want  []string
+	}{
+		{"all in insertion order", "rps_test", "all", "", []string{"a", "b", "c"}},
+		{"string field", "rps_test", "status", "pending", []string{"c"}},
+		{"upserted field", "rps_test", "status", "draw", []string{"a"}},
+		{"number field", "rps_test", "bet", "10", []string{"b", "c"}},
+		{"boolean field", "rps_test", "open", "true", []string{"a"}},
+		{"no match", "rps_test", "status", "expired", nil},
+		{"missing field", "rps_test", "winner", "", nil},
+		{"unknown collection", "rps_none", "all", "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.Query(tt.db, tt.field, tt.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assertIDs(t, got, tt.want)
+		})
+	}
+}
+
+func TestMemStoreGetDelete(t *testing.T) {
+	s := newMemStore("p1")
+
+	if err := s.Put("rps_test", []byte(`{"status":"pending"}`)); err == nil {
+		t.Fatal("document without _id was stored")
+	}
+
+	for _, doc := range []string{`{"_id":"a"}`, `{"_id":"b"}`} {
+		if err := s.Put("rps_test", []byte(doc)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := s.Get("rps_test", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertIDs(t, got, []string{"b"})
+
+	if err := s.Delete("rps_test", "b"); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err = s.Get("rps_test", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertIDs(t, got, nil)
+
+	if err := s.Delete("rps_test", "all"); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err = s.Query("rps_test", "all", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertIDs(t, got, nil)
+}
+
+// assertIDs checks that result is the JSON array of the documents with
+// want as their IDs, or the literal null when want is empty.
+func assertIDs(t *testing.T, result []byte, want []string) {
+	t.Helper()
+
+	if len(want) == 0 {
+		if string(result) != "null" {
+			t.Fatalf("got %s, want null", result)
+		}
+		return
+	}
+
+	var docs []struct {
+		ID string `json:"_id"`
+	}
+
+	if err := json.Unmarshal(result, &docs); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(docs) != len(want) {
+		t.Fatalf("got %s, want %v", result, want)
+	}
+
+	for i, d := range docs {
+		if d.ID != want[i] {
+			t.Fatalf("got %s, want %v", result, want)
+		}
+	}
+}
+
+func TestMemStoreSharedByPeers(t *testing.T) {
+	mem := newMemStore("p1")
+	other := mem.withPeer("p2")
+
+	if err := mem.Put("rps_test", []byte(`{"_id":"a"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := other.Get("rps_test", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertIDs(t, got, []string{"a"})
+
+	for store, want := range map[*memStore]string{mem: "p1", other: "p2"} {
+		if peer, err := store.PeerID(); err != nil || peer != want {
+			t.Fatalf("peer %q, want %q: %v", peer, want, err)
+		}
+	}
+}
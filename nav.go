@@ -35,8 +35,11 @@ func (n *nav) Render() app.UI {
 				app.A().ID("link-home").Href("/home").Text("Home"),
 				app.A().ID("link-wallet").Href("/wallet").Text("Wallet"),
 				app.A().ID("link-players").Href("/players").Text("Challenge Players"),
+				app.A().ID("link-lobby").Href("/lobby").Text("Open Challenges"),
 				app.A().ID("link-challenges").Href("/challenges").Text("Pending Challenges"),
 				app.A().ID("link-transactions").Href("/transactions").Text("Transactions"),
+				app.A().ID("link-tournaments").Href("/tournaments").Text("Tournaments"),
+				app.A().ID("link-history").Href("/history").Text("History"),
 				app.A().ID("link-stats").Href("/stats").Text("Stats"),
 				app.A().Href("#").Text("Logout").OnClick(n.doLogout),
 			),
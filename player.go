@@ -2,21 +2,58 @@ package main
 
 import (
 	"encoding/json"
+	"math"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/mar1n3r0/rps/engine"
 	"github.com/maxence-charriere/go-app/v10/pkg/app"
-	shell "github.com/stateless-minds/go-ipfs-api"
 )
 
 type player struct {
 	app.Compo
-	sh         *shell.Shell
+	store      DocStore
 	myPeerID   string
 	playerName string
 	players    []Account
+	mode       engine.Mode
+	stake      float32
+	ttl        time.Duration
+	bestOf     int
+	minRating  int
+	maxRating  int
+	size       int // players of a free-for-all
 }
 
+// challengeTTLs are the time limits a host can give a challenge to be
+// answered and played.
+var challengeTTLs = []struct {
+	ttl   time.Duration
+	title string
+}{
+	{time.Hour, "1 hour"},
+	{24 * time.Hour, "1 day"},
+	{3 * 24 * time.Hour, "3 days"},
+	{7 * 24 * time.Hour, "1 week"},
+}
+
+// seriesLengths are the numbers of rounds a challenge can be played over.
+var seriesLengths = []struct {
+	bestOf int
+	title  string
+}{
+	{1, "Single throw"},
+	{3, "Best of 3"},
+	{5, "Best of 5"},
+	{7, "Best of 7"},
+}
+
+// defaultChallengeTTL is the time limit of a challenge unless the host picks
+// another one.
+const defaultChallengeTTL = 24 * time.Hour
+
 func (p *player) OnMount(ctx app.Context) {
 	var loggedIn bool
 	ctx.GetState("loggedIn", &loggedIn)
@@ -25,19 +62,23 @@ func (p *player) OnMount(ctx app.Context) {
 		return
 	}
 
-	sh := shell.NewShell("localhost:5001")
-	p.sh = sh
+	p.store = newDocStore()
 
-	myPeer, err := p.sh.ID()
+	myPeerID, err := p.store.PeerID()
 	if err != nil {
 		ctx.Navigate("/")
 		return
 	}
 
-	p.myPeerID = myPeer.ID
+	p.myPeerID = myPeerID
 
 	ctx.GetState("playerName", &p.playerName)
 
+	p.mode = engine.ModeClassic
+	p.ttl = defaultChallengeTTL
+	p.bestOf = 1
+	p.size = engine.MinPlayers
+
 	p.getPlayers(ctx)
 }
 
@@ -53,7 +94,7 @@ func (p *player) OnNav(ctx app.Context) {
 
 func (p *player) getPlayers(ctx app.Context) {
 	ctx.Async(func() {
-		accountJSON, err := p.sh.OrbitDocsQuery(dbRpsAccount, "all", "")
+		accountJSON, err := p.store.Query(dbRpsAccount, "all", "")
 		if err != nil {
 			ctx.Notifications().New(app.Notification{
 				Title: "Error",
@@ -93,6 +134,131 @@ func (p *player) Render() app.UI {
 						app.Tr().Body(
 							app.Td().ID("table-header").Text("Players").ColSpan(2),
 						),
+						app.Tr().Body(
+							app.Td().Body(
+								app.Label().For("game-mode").Text("Game Mode"),
+							),
+							app.Td().Body(
+								app.Select().
+									ID("game-mode").
+									OnChange(p.selectMode).
+									Body(
+										app.Range(engine.Modes()).Slice(func(i int) app.UI {
+											mode := engine.Modes()[i]
+											return app.Option().
+												Value(string(mode)).
+												Selected(mode == p.mode).
+												Text(mode.Title())
+										}),
+									),
+							),
+						),
+						app.Tr().Body(
+							app.Td().Body(
+								app.Label().For("stake-amount").Text("Stake"),
+							),
+							app.Td().Body(
+								app.Input().
+									ID("stake-amount").
+									Name("stake-amount").
+									Type("number").
+									Min(0.1).
+									Step(0.1).
+									Placeholder("0.1").
+									OnChange(p.ValueTo(&p.stake)),
+							),
+						),
+						app.Tr().Body(
+							app.Td().Body(
+								app.Label().For("challenge-ttl").Text("Expires After"),
+							),
+							app.Td().Body(
+								app.Select().
+									ID("challenge-ttl").
+									OnChange(p.selectTTL).
+									Body(
+										app.Range(challengeTTLs).Slice(func(i int) app.UI {
+											return app.Option().
+												Value(challengeTTLs[i].ttl.String()).
+												Selected(challengeTTLs[i].ttl == p.ttl).
+												Text(challengeTTLs[i].title)
+										}),
+									),
+							),
+						),
+						app.Tr().Body(
+							app.Td().Body(
+								app.Label().For("best-of").Text("Rounds"),
+							),
+							app.Td().Body(
+								app.Select().
+									ID("best-of").
+									OnChange(p.selectBestOf).
+									Body(
+										app.Range(seriesLengths).Slice(func(i int) app.UI {
+											return app.Option().
+												Value(strconv.Itoa(seriesLengths[i].bestOf)).
+												Selected(seriesLengths[i].bestOf == p.bestOf).
+												Text(seriesLengths[i].title)
+										}),
+									),
+							),
+						),
+						app.Tr().Body(
+							app.Td().Body(
+								app.Label().For("min-rating").Text("Ratings"),
+							),
+							app.Td().Body(
+								app.Input().
+									ID("min-rating").
+									Name("min-rating").
+									Type("number").
+									Min(0).
+									Step(1).
+									Placeholder("Lowest").
+									OnChange(p.ValueTo(&p.minRating)),
+								app.Input().
+									ID("max-rating").
+									Name("max-rating").
+									Type("number").
+									Min(0).
+									Step(1).
+									Placeholder("Highest").
+									OnChange(p.ValueTo(&p.maxRating)),
+							),
+						),
+						app.Tr().Body(
+							app.Td().Text("Anyone in range"),
+							app.Td().Body(
+								app.Button().
+									Class("challenge-btn").
+									Text("Post Open Challenge").
+									OnClick(p.postChallenge),
+							),
+						),
+						app.Tr().Body(
+							app.Td().Body(
+								app.Label().For("ffa-size").Text("Free-for-All"),
+							),
+							app.Td().Body(
+								app.Select().
+									ID("ffa-size").
+									OnChange(p.selectSize).
+									Body(
+										app.Range(freeForAllSizes()).Slice(func(i int) app.UI {
+											size := freeForAllSizes()[i]
+											return app.Option().
+												Value(strconv.Itoa(size)).
+												Selected(size == p.size).
+												Text(strconv.Itoa(size) + " players")
+										}),
+									),
+								app.Button().
+									Class("challenge-btn").
+									Text("Post Free-for-All").
+									OnClick(p.postFreeForAll),
+							),
+						),
 						app.Range(p.players).Slice(func(i int) app.UI {
 							return app.If(p.players[i].Username != p.playerName, func() app.UI {
 								return app.Tr().Body(
@@ -113,24 +279,148 @@ func (p *player) Render() app.UI {
 		)
 }
 
+func (p *player) selectMode(ctx app.Context, e app.Event) {
+	mode, err := engine.ParseMode(ctx.JSSrc().Get("value").String())
+	if err != nil {
+		ctx.Notifications().New(app.Notification{
+			Title: "Error",
+			Body:  err.Error(),
+		})
+		return
+	}
+
+	p.mode = mode
+}
+
+func (p *player) selectTTL(ctx app.Context, e app.Event) {
+	ttl, err := time.ParseDuration(ctx.JSSrc().Get("value").String())
+	if err != nil {
+		ctx.Notifications().New(app.Notification{
+			Title: "Error",
+			Body:  err.Error(),
+		})
+		return
+	}
+
+	p.ttl = ttl
+}
+
+func (p *player) selectBestOf(ctx app.Context, e app.Event) {
+	bestOf, err := strconv.Atoi(ctx.JSSrc().Get("value").String())
+	if err != nil {
+		ctx.Notifications().New(app.Notification{
+			Title: "Error",
+			Body:  err.Error(),
+		})
+		return
+	}
+
+	p.bestOf = bestOf
+}
+
 func (p *player) challengePlayer(ctx app.Context, e app.Event) {
 	opponentUsername := ctx.JSSrc().Get("value").String()
 
-	challenge := Match{
-		ID:     uuid.NewString(),
-		Status: StatusPending,
-		Host: Selection{
-			Username: p.playerName,
-		},
-		Opponent: Selection{
-			Username: opponentUsername,
-		},
+	if p.stake <= 0 {
+		ctx.Notifications().New(app.Notification{
+			Title: "Error",
+			Body:  "Enter the stake you propose",
+		})
+		return
+	}
+
+	challenge, err := engine.Create(uuid.NewString(), p.mode, p.playerName, opponentUsername, time.Now(), p.ttl, p.bestOf)
+	if err != nil {
+		ctx.Notifications().New(app.Notification{
+			Title: "Error",
+			Body:  err.Error(),
+		})
+		return
+	}
+
+	challenge, err = engine.Propose(challenge, p.playerName, int(math.Round(float64(p.stake)*100)), time.Now())
+	if err != nil {
+		ctx.Notifications().New(app.Notification{
+			Title: "Error",
+			Body:  err.Error(),
+		})
+		return
 	}
 
 	p.createChallenge(ctx, challenge)
 }
 
-func (p *player) createChallenge(ctx app.Context, challenge Match) {
+// freeForAllSizes returns the numbers of players a free-for-all can be
+// played by.
+func freeForAllSizes() []int {
+	var sizes []int
+	for size := engine.MinPlayers; size <= engine.MaxPlayers; size++ {
+		sizes = append(sizes, size)
+	}
+
+	return sizes
+}
+
+func (p *player) selectSize(ctx app.Context, e app.Event) {
+	size, err := strconv.Atoi(ctx.JSSrc().Get("value").String())
+	if err != nil {
+		ctx.Notifications().New(app.Notification{
+			Title: "Error",
+			Body:  err.Error(),
+		})
+		return
+	}
+
+	p.size = size
+}
+
+// postFreeForAll posts a free-for-all to the lobby. The host throws first,
+// the other players join by throwing until it is full.
+func (p *player) postFreeForAll(ctx app.Context, e app.Event) {
+	if p.stake <= 0 {
+		ctx.Notifications().New(app.Notification{
+			Title: "Error",
+			Body:  "Enter the stake you propose",
+		})
+		return
+	}
+
+	challenge, err := engine.CreateFreeForAll(uuid.NewString(), p.mode, p.playerName, time.Now(), p.ttl, p.size, int(math.Round(float64(p.stake)*100)))
+	if err != nil {
+		ctx.Notifications().New(app.Notification{
+			Title: "Error",
+			Body:  err.Error(),
+		})
+		return
+	}
+
+	p.createChallenge(ctx, challenge)
+}
+
+// postChallenge posts a challenge to the lobby, where the first player whose
+// rating is in range accepts it.
+func (p *player) postChallenge(ctx app.Context, e app.Event) {
+	if p.stake <= 0 {
+		ctx.Notifications().New(app.Notification{
+			Title: "Error",
+			Body:  "Enter the stake you propose",
+		})
+		return
+	}
+
+	challenge, err := engine.Post(uuid.NewString(), p.mode, p.playerName, time.Now(), p.ttl, p.bestOf, int(math.Round(float64(p.stake)*100)), p.minRating, p.maxRating)
+	if err != nil {
+		ctx.Notifications().New(app.Notification{
+			Title: "Error",
+			Body:  err.Error(),
+		})
+		return
+	}
+
+	p.createChallenge(ctx, challenge)
+}
+
+func (p *player) createChallenge(ctx app.Context, challenge engine.Match) {
 	challengeJSON, err := json.Marshal(challenge)
 	if err != nil {
 		ctx.Notifications().New(app.Notification{
@@ -141,7 +431,7 @@ func (p *player) createChallenge(ctx app.Context, challenge Match) {
 	}
 
 	ctx.Async(func() {
-		err = p.sh.OrbitDocsPut(dbRpsChallenge, challengeJSON)
+		err = p.store.Put(dbRpsChallenge, challengeJSON)
 		if err != nil {
 			ctx.Notifications().New(app.Notification{
 				Title: "Error",
@@ -150,8 +440,21 @@ func (p *player) createChallenge(ctx app.Context, challenge Match) {
 			return
 		}
 
+		message := "Challenge sent. You can place your bet once " + challenge.Opponent.Username + " agrees to the stake."
+		next := "/challenges"
+		if challenge.Unclaimed() {
+			message = "Challenge posted to the lobby. You can place your bet once a player accepts it."
+		} else if challenge.FreeForAll() {
+			message = "Free-for-all posted to the lobby. Make your throw, the others join by making theirs."
+			next = "/match/" + challenge.ID
+		}
+
 		ctx.Dispatch(func(ctx app.Context) {
-			ctx.Navigate("/match/" + challenge.ID)
+			ctx.Notifications().New(app.Notification{
+				Title: "Success",
+				Body:  message,
+			})
+			ctx.Navigate(next)
 		})
 	})
 }
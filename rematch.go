@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mar1n3r0/rps/engine"
+)
+
+// createRematch challenges the other player of the finished match with id
+// to a rematch, at twice its stake when double is set. A match is rematched
+// once, whichever of its players asks first.
+func createRematch(store DocStore, id, username string, double bool) (engine.Match, error) {
+	matches, err := getAllMatches(store)
+	if err != nil {
+		return engine.Match{}, err
+	}
+
+	// rematches made before the previous match recorded them
+	for _, m := range matches {
+		if m.PreviousID == id {
+			return engine.Match{}, engine.ErrRematched
+		}
+	}
+
+	var rematch engine.Match
+
+	// claim the rematch on the previous match first: of two players asking
+	// at once, the one whose claim is written second has to read it again
+	// and finds it rematched
+	_, err = modifyMatch(store, id, func(prev engine.Match) (engine.Match, error) {
+		ttl := time.Duration(prev.TTL) * time.Second
+		if ttl <= 0 {
+			ttl = defaultChallengeTTL
+		}
+
+		rematch, err = engine.Rematch(uuid.NewString(), prev, username, time.Now(), ttl, double)
+		if err != nil {
+			return engine.Match{}, err
+		}
+
+		prev.RematchID = rematch.ID
+
+		return prev, nil
+	})
+	if err != nil {
+		return engine.Match{}, err
+	}
+
+	rematchJSON, err := json.Marshal(rematch)
+	if err != nil {
+		return engine.Match{}, err
+	}
+
+	err = store.Put(dbRpsChallenge, rematchJSON)
+	if err != nil {
+		// give the claim up so that the match can be rematched again; should
+		// this fail too, the claim points at a rematch that does not exist
+		_, _ = modifyMatch(store, id, func(prev engine.Match) (engine.Match, error) {
+			if prev.RematchID != rematch.ID {
+				return engine.Match{}, engine.ErrRematched
+			}
+
+			prev.RematchID = ""
+
+			return prev, nil
+		})
+
+		return engine.Match{}, err
+	}
+
+	return rematch, nil
+}
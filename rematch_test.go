@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/mar1n3r0/rps/engine"
+)
+
+// completedMatch saves a match between host and opponent that the host won.
+func completedMatch(t *testing.T, host, opponent testPlayer, id string) engine.Match {
+	t.Helper()
+
+	m, err := engine.Create(id, engine.ModeClassic, host.name, opponent.name, testNow, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err = engine.Propose(m, host.name, 300, testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err = engine.AgreeStake(m, opponent.name, testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rules := classicRules(t)
+
+	m, _, err = engine.Open(rules, m, engine.Selection{Username: host.name, ItemName: "rock", Bet: 300}, "salt", testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, _, err = engine.Play(rules, m, engine.Selection{Username: opponent.name, ItemName: "scissors", Bet: 300}, testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := engine.Reveal(rules, m, "rock", "salt", testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m = result.Match
+
+	if _, err := saveMatch(host.store, m); err != nil {
+		t.Fatal(err)
+	}
+
+	return m
+}
+
+func TestCreateRematchOnce(t *testing.T) {
+	players := newTestPlayers(t, 1000, "alice", "bob")
+	alice, bob := players[0], players[1]
+
+	m := completedMatch(t, alice, bob, "11111111-1111-1111-1111-111111111111")
+
+	// both players ask at once, only one of them gets the rematch
+	var wg sync.WaitGroup
+
+	rematches := make([]engine.Match, len(players))
+	errs := make([]error, len(players))
+
+	for i, p := range players {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			rematches[i], errs[i] = createRematch(p.store, m.ID, p.name, false)
+		}()
+	}
+
+	wg.Wait()
+
+	var rematch engine.Match
+
+	for i, err := range errs {
+		switch {
+		case err == nil && rematch.ID == "":
+			rematch = rematches[i]
+		case !errors.Is(err, engine.ErrRematched):
+			t.Fatalf("%s: got %v", players[i].name, err)
+		}
+	}
+
+	if rematch.ID == "" {
+		t.Fatal("nobody got the rematch")
+	}
+
+	prev, err := getMatch(bob.store, m.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if prev.RematchID != rematch.ID || prev.Status != engine.StatusCompleted {
+		t.Fatalf("previous match %s rematched by %q, want %q", prev.Status, prev.RematchID, rematch.ID)
+	}
+
+	matches, err := getAllMatches(alice.store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if chain := engine.Chain(matches, prev); len(chain) != 2 || chain[1].ID != rematch.ID {
+		t.Fatalf("chain %+v", chain)
+	}
+
+	if _, err := createRematch(bob.store, m.ID, bob.name, true); !errors.Is(err, engine.ErrRematched) {
+		t.Fatalf("second rematch: got %v", err)
+	}
+}
+
+func TestCreateRematchFails(t *testing.T) {
+	players := newTestPlayers(t, 1000, "alice", "bob")
+	alice, bob := players[0], players[1]
+
+	m := completedMatch(t, alice, bob, "11111111-1111-1111-1111-111111111112")
+
+	// the claim is written, the rematch is not
+	if _, err := createRematch(failing(alice, &failingStore{db: dbRpsChallenge, ok: 1, once: true}), m.ID, alice.name, false); !errors.Is(err, errBroken) {
+		t.Fatalf("got %v", err)
+	}
+
+	prev, err := getMatch(bob.store, m.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if prev.RematchID != "" {
+		t.Fatalf("claimed by rematch %s that was never made", prev.RematchID)
+	}
+
+	rematch, err := createRematch(bob.store, m.ID, bob.name, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if prev, err = getMatch(alice.store, m.ID); err != nil || prev.RematchID != rematch.ID {
+		t.Fatalf("rematched by %q, want %q: %v", prev.RematchID, rematch.ID, err)
+	}
+}
@@ -0,0 +1,454 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mar1n3r0/rps/engine"
+)
+
+// getMatch returns the match with id, or the zero Match when there is none.
+func getMatch(store DocStore, id string) (engine.Match, error) {
+	matchJSON, err := store.Get(dbRpsChallenge, id)
+	if err != nil {
+		return engine.Match{}, err
+	}
+
+	if strings.TrimSpace(string(matchJSON)) == "null" || len(matchJSON) == 0 {
+		return engine.Match{}, nil
+	}
+
+	var matches []engine.Match
+
+	err = json.Unmarshal(matchJSON, &matches)
+	if err != nil {
+		return engine.Match{}, err
+	}
+
+	return matches[0], nil
+}
+
+// maxAttempts is how many times an update that lost a race with a
+// concurrent one is tried.
+const maxAttempts = 3
+
+// saveMatch writes m unless the match was changed since m was read, in which
+// case it fails with errConflict. It returns the match as written.
+func saveMatch(store DocStore, m engine.Match) (engine.Match, error) {
+	current, err := getMatch(store, m.ID)
+	if err != nil {
+		return engine.Match{}, err
+	}
+
+	err = checkMatchWrite(current, m)
+	if err != nil {
+		return engine.Match{}, err
+	}
+
+	m.Version++
+
+	matchJSON, err := json.Marshal(m)
+	if err != nil {
+		return engine.Match{}, err
+	}
+
+	err = store.Put(dbRpsChallenge, matchJSON)
+	if err != nil {
+		return engine.Match{}, err
+	}
+
+	written, err := getDoc(store, dbRpsChallenge, m.ID)
+	if err != nil {
+		return engine.Match{}, err
+	}
+
+	// another write of the same version got in first
+	if !sameDoc(written, matchJSON) {
+		return engine.Match{}, fmt.Errorf("%w: match %s", errConflict, m.ID)
+	}
+
+	return m, nil
+}
+
+// checkMatchWrite returns an error unless m can replace current, the match
+// as it is stored: m has to be based on the latest version, keep the outcome
+// of a match that is over and only append to its transition log.
+func checkMatchWrite(current, m engine.Match) error {
+	if current.Version != m.Version {
+		return fmt.Errorf("%w: match %s", errConflict, m.ID)
+	}
+
+	if current.Resolved() && current.Status != m.Status {
+		return fmt.Errorf("%w: match %s", engine.ErrResolved, m.ID)
+	}
+
+	err := m.CheckLog(current)
+	if err != nil {
+		return fmt.Errorf("%w: match %s", err, m.ID)
+	}
+
+	return nil
+}
+
+// modifyMatch applies update to the latest version of the match with id and
+// saves it, starting over with a fresh copy when a concurrent write got in
+// between. An error from update is returned as is.
+func modifyMatch(store DocStore, id string, update func(m engine.Match) (engine.Match, error)) (engine.Match, error) {
+	var err error
+
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		var m engine.Match
+
+		m, err = getMatch(store, id)
+		if err != nil {
+			return engine.Match{}, err
+		}
+
+		if m.ID == "" {
+			return engine.Match{}, fmt.Errorf("match %s not found", id)
+		}
+
+		m, err = update(m)
+		if err != nil {
+			return engine.Match{}, err
+		}
+
+		m, err = saveMatch(store, m)
+		if !errors.Is(err, errConflict) {
+			return m, err
+		}
+	}
+
+	return engine.Match{}, err
+}
+
+// getBalance returns the wallet of playerName, or the zero Balance when the
+// player has none yet.
+func getBalance(store DocStore, playerName string) (Balance, error) {
+	balanceJSON, err := store.Get(dbRpsWallet, playerName)
+	if err != nil {
+		return Balance{}, err
+	}
+
+	if strings.TrimSpace(string(balanceJSON)) == "null" || len(balanceJSON) == 0 {
+		return Balance{}, nil
+	}
+
+	var balances []Balance
+
+	err = json.Unmarshal(balanceJSON, &balances)
+	if err != nil {
+		return Balance{}, err
+	}
+
+	return balances[0], nil
+}
+
+// moveFunds deposits amount into the wallet of username, or withdraws it
+// when amount is negative, and returns the new balance.
+func moveFunds(store DocStore, username string, amount int) (int, error) {
+	kind := KindDeposit
+	if amount < 0 {
+		kind = KindWithdrawal
+	}
+
+	var err error
+
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		s := newSettlement(store, "", username)
+
+		err = s.post(username, amount, accountExternal, kind, "")
+		if err != nil {
+			return 0, err
+		}
+
+		// a conflicting settlement is rolled back and can be built again
+		// from the current balance
+		err = s.commit()
+		if errors.Is(err, errConflict) {
+			continue
+		}
+
+		if err != nil {
+			return 0, err
+		}
+
+		balance, _ := s.balance(username)
+
+		return balance, nil
+	}
+
+	return 0, err
+}
+
+// settleMatch saves m and applies movements to the wallets and the escrow
+// of the match as one settlement written by owner.
+func settleMatch(store DocStore, owner string, m engine.Match, movements []engine.Movement) (*settlement, error) {
+	s := newSettlement(store, m.ID, owner)
+
+	err := s.putMatch(m)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, mv := range movements {
+		err = s.move(mv, strings.Join(m.Others(mv.Username), ", "))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = s.commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// revealMatch discloses the host's committed item on a match the opponent
+// has played, settles it and moves the pot. The item and salt are the ones
+// the host kept when placing the bet.
+func revealMatch(store DocStore, rules *engine.Rules, m engine.Match, secret commitSecret) (engine.Result, error) {
+	result, err := engine.Reveal(rules, m, engine.ItemType(secret.Item), secret.Salt, time.Now())
+	if err != nil {
+		return engine.Result{}, err
+	}
+
+	_, err = settleMatch(store, m.Host.Username, result.Match, result.Movements)
+	if err != nil {
+		return engine.Result{}, err
+	}
+
+	return result, nil
+}
+
+// revealThrow discloses the item username threw in a free-for-all. The last
+// player to reveal settles it and moves the pot.
+func revealThrow(store DocStore, rules *engine.Rules, m engine.Match, username string, secret commitSecret) (engine.Result, error) {
+	result, err := engine.RevealThrow(rules, m, username, engine.ItemType(secret.Item), secret.Salt, time.Now())
+	if err != nil {
+		return engine.Result{}, err
+	}
+
+	_, err = settleMatch(store, username, result.Match, result.Movements)
+	if err != nil {
+		return engine.Result{}, err
+	}
+
+	return result, nil
+}
+
+// declineMatch turns down a pending match on behalf of username and refunds
+// the host's stake.
+func declineMatch(store DocStore, m engine.Match, username string) (engine.Match, error) {
+	declined, refunds, err := engine.Decline(m, username, time.Now())
+	if err != nil {
+		return engine.Match{}, err
+	}
+
+	_, err = settleMatch(store, username, declined, refunds)
+	if err != nil {
+		return engine.Match{}, err
+	}
+
+	return declined, nil
+}
+
+// cancelMatch withdraws a pending match on behalf of its host and refunds
+// the host's stake.
+func cancelMatch(store DocStore, m engine.Match, username string) (engine.Match, error) {
+	cancelled, refunds, err := engine.Cancel(m, username, time.Now())
+	if err != nil {
+		return engine.Match{}, err
+	}
+
+	_, err = settleMatch(store, username, cancelled, refunds)
+	if err != nil {
+		return engine.Match{}, err
+	}
+
+	return cancelled, nil
+}
+
+// expireMatch ends a pending match whose time limit passed by now on
+// behalf of username, one of its players, and refunds the host's stake.
+func expireMatch(store DocStore, m engine.Match, username string, now time.Time) (engine.Match, error) {
+	expired, refunds, err := engine.Expire(m, now)
+	if err != nil {
+		return engine.Match{}, err
+	}
+
+	_, err = settleMatch(store, username, expired, refunds)
+	if err != nil {
+		return engine.Match{}, err
+	}
+
+	return expired, nil
+}
+
+// forfeitMatch ends a match whose deadline passed by now on behalf of
+// username, one of its players, and pays the pot to the player who was not
+// holding it up, or to the players of a free-for-all who revealed.
+func forfeitMatch(store DocStore, m engine.Match, username string, now time.Time) (engine.Match, error) {
+	var rules *engine.Rules
+
+	// only a free-for-all is settled by the throws revealed in time
+	if m.FreeForAll() {
+		mode, err := engine.ParseMode(m.Mode)
+		if err != nil {
+			return engine.Match{}, err
+		}
+
+		_, rules, err = getRules(store, mode)
+		if err != nil {
+			return engine.Match{}, err
+		}
+	}
+
+	result, err := engine.Forfeit(rules, m, now)
+	if err != nil {
+		return engine.Match{}, err
+	}
+
+	_, err = settleMatch(store, username, result.Match, result.Movements)
+	if err != nil {
+		return engine.Match{}, err
+	}
+
+	return result.Match, nil
+}
+
+// matchEscrow returns the escrow of m as stored. A match staked before
+// escrows were kept has none; it holds the bet the host placed on it.
+func matchEscrow(store DocStore, m engine.Match) (Escrow, error) {
+	escrow, err := getEscrow(store, m.ID)
+	if err != nil {
+		return Escrow{}, err
+	}
+
+	if escrow.Status == "" && m.Host.Bet > 0 {
+		escrow.add(m.Host.Username, m.Host.Bet)
+	}
+
+	return escrow, nil
+}
+
+// reconcileDeclined refunds the stakes still held by the declined matches
+// of host and returns how many it settled. Matches declined before declining
+// refunded anything have no escrow, their stake is taken from the bet
+// recorded on the match, and the ones written before signing are signed
+// again first so that they can be read.
+func reconcileDeclined(store DocStore, host string) (int, error) {
+	// matches declined before signing existed are signed again by one of
+	// their players
+	_, err := resignLegacy(store, dbRpsChallenge, "status", string(engine.StatusDeclined))
+	if err != nil {
+		return 0, err
+	}
+
+	matchesJSON, err := store.Query(dbRpsChallenge, "status", string(engine.StatusDeclined))
+	if err != nil {
+		return 0, err
+	}
+
+	if strings.TrimSpace(string(matchesJSON)) == "null" || len(matchesJSON) == 0 {
+		return 0, nil
+	}
+
+	var matches []engine.Match
+
+	err = json.Unmarshal(matchesJSON, &matches)
+	if err != nil {
+		return 0, err
+	}
+
+	var settled int
+
+	for _, m := range matches {
+		if m.Host.Username != host {
+			continue
+		}
+
+		escrow, err := matchEscrow(store, m)
+		if err != nil {
+			return settled, err
+		}
+
+		refunds := escrow.refunds()
+		if len(refunds) == 0 {
+			continue
+		}
+
+		s := newSettlement(store, m.ID, host)
+		s.escrow = &escrow
+
+		for _, mv := range refunds {
+			err = s.move(mv, m.OpponentOf(mv.Username))
+			if err != nil {
+				return settled, err
+			}
+		}
+
+		err = s.commit()
+		if err != nil {
+			return settled, err
+		}
+
+		settled++
+	}
+
+	return settled, nil
+}
+
+// commitSecret is what the host keeps in the browser between committing to
+// an item and revealing it.
+type commitSecret struct {
+	Item string
+	Salt string
+}
+
+func commitSecretKey(matchID string) string {
+	return "commit-" + matchID
+}
+
+// getRules loads the items of mode and builds its rules.
+func getRules(store DocStore, mode engine.Mode) ([]engine.Item, *engine.Rules, error) {
+	itemsJSON, err := store.Query(dbRpsItem, "all", "")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var items []engine.Item
+
+	if strings.TrimSpace(string(itemsJSON)) != "null" && len(itemsJSON) > 0 {
+		err = json.Unmarshal(itemsJSON, &items)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// items seeded before modes and beats tables existed are classic ones
+	// known by name only
+	items = engine.WithBuiltin(engine.ModeItems(items, mode), mode)
+
+	if len(items) == 0 {
+		return nil, nil, errors.New("no game items found")
+	}
+
+	// Sort by position in the mode
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Order < items[j].Order
+	})
+
+	rules, err := engine.NewRules(items)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid game items: %w", err)
+	}
+
+	return items, rules, nil
+}
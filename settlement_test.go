@@ -0,0 +1,566 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mar1n3r0/rps/engine"
+)
+
+// documents of every other player.
+type testPlayer struct {
+	name  string
+	store DocStore
+}
+
+// newTestPlayers registers a player with a funded wallet for every name, each
+// writing as a peer of its own through a signed store.
+func newTestPlayers(t *testing.T, deposit int, names ...string) []testPlayer {
+	t.Helper()
+
+	mem := newMemStore("")
+
+	var players []testPlayer
+
+	for i, name := range names {
+		peer := "peer-" + string(rune('a'+i))
+		p := testPlayer{name, newSignedStore(mem.withPeer(peer))}
+
+		account, _ := json.Marshal(Account{ID: peer, Username: name})
+		if err := p.store.Put(dbRpsAccount, account); err != nil {
+			t.Fatal(err)
+		}
+
+		wallet, _ := json.Marshal(Balance{ID: name})
+		if err := p.store.Put(dbRpsWallet, wallet); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := moveFunds(p.store, name, deposit); err != nil {
+			t.Fatal(err)
+		}
+
+		players = append(players, p)
+	}
+
+	return players
+}
+
+// testNow is the clock of the test matches.
+var testNow = time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC)
+
+func classicRules(t *testing.T) *engine.Rules {
+	t.Helper()
+
+	rules, err := engine.NewRules(engine.Cyclic(engine.ModeClassic, []string{"rock", "scissors", "paper"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rules
+}
+
+func balanceOf(t *testing.T, store DocStore, username string) int {
+	t.Helper()
+
+	b, err := getBalance(store, username)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b.Amount
+}
+
+// TestSettleFlow plays the whole loop between two peers: register, deposit,
+// challenge, agree on the stake, bet, play, reveal and settle.
+func TestSettleFlow(t *testing.T) {
+	players := newTestPlayers(t, 1000, "alice", "bob")
+	alice, bob := players[0], players[1]
+	rules := classicRules(t)
+
+	m, err := engine.Create("11111111-1111-1111-1111-111111111111", engine.ModeClassic, alice.name, bob.name, testNow, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err = engine.Propose(m, alice.name, 300, testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err = engine.AgreeStake(m, bob.name, testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err = saveMatch(alice.store, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	salt, err := engine.NewSalt()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opened, stakes, err := engine.Open(rules, m, engine.Selection{Username: alice.name, ItemName: "rock", Bet: 300}, salt, testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := settleMatch(alice.store, alice.name, opened, stakes); err != nil {
+		t.Fatal(err)
+	}
+
+	// bob reads the match alice wrote from his own peer
+	opened, err = getMatch(bob.store, m.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	played, stakes, err := engine.Play(rules, opened, engine.Selection{Username: bob.name, ItemName: "scissors", Bet: 300}, testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := settleMatch(bob.store, bob.name, played, stakes); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := balanceOf(t, alice.store, bob.name); got != 700 {
+		t.Fatalf("bob has %d once staked, want 700", got)
+	}
+
+	played, err = getMatch(alice.store, m.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := revealMatch(alice.store, rules, played, commitSecret{Item: "rock", Salt: salt})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Winner != alice.name {
+		t.Fatalf("winner %q, want alice", result.Winner)
+	}
+
+	for _, want := range []struct {
+		name   string
+		amount int
+	}{{alice.name, 1300}, {bob.name, 700}} {
+		if got := balanceOf(t, bob.store, want.name); got != want.amount {
+			t.Fatalf("%s has %d, want %d", want.name, got, want.amount)
+		}
+
+		check, err := verifyLedger(bob.store, want.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !check.Balanced() {
+			t.Fatalf("ledger of %s does not balance: %+v", want.name, check)
+		}
+	}
+
+	escrow, err := getEscrow(alice.store, m.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if escrow.Total() != 0 || escrow.Status != EscrowReleased {
+		t.Fatalf("escrow still holds %d", escrow.Total())
+	}
+
+	// the pot cannot be paid out a second time
+	settled, err := getMatch(alice.store, m.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := revealMatch(alice.store, rules, settled, commitSecret{Item: "rock", Salt: salt}); err == nil {
+		t.Fatal("settled match was revealed again")
+	}
+}
+
+func TestReconcileLegacyDeclined(t *testing.T) {
+	players := newTestPlayers(t, 700, "alice", "bob")
+	alice, bob := players[0], players[1]
+
+	// a match declined before signing and refunds existed, still holding
+	// the stake alice bet on it
+	legacy, _ := json.Marshal(engine.Match{
+		ID:       "44444444-4444-4444-4444-444444444444",
+		Status:   engine.StatusDeclined,
+		Host:     engine.Selection{Username: alice.name, Bet: 300},
+		Opponent: engine.Selection{Username: bob.name},
+	})
+
+	if err := alice.store.(*signedStore).DocStore.Put(dbRpsChallenge, legacy); err != nil {
+		t.Fatal(err)
+	}
+
+	// bob is not the host, the stake is not his to reclaim
+	settled, err := reconcileDeclined(bob.store, bob.name)
+	if err != nil || settled != 0 {
+		t.Fatalf("bob settled %d: %v", settled, err)
+	}
+
+	settled, err = reconcileDeclined(alice.store, alice.name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if settled != 1 || balanceOf(t, bob.store, alice.name) != 1000 {
+		t.Fatalf("settled %d, alice has %d", settled, balanceOf(t, bob.store, alice.name))
+	}
+
+	// the refund is made once
+	settled, err = reconcileDeclined(alice.store, alice.name)
+	if err != nil || settled != 0 {
+		t.Fatalf("settled %d again: %v", settled, err)
+	}
+}
+
+func TestLegacyPendingMatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		settle func(alice, bob testPlayer, m engine.Match) (engine.Match, error)
+		status engine.Status
+	}{
+		{"declined", func(alice, bob testPlayer, m engine.Match) (engine.Match, error) {
+			return declineMatch(bob.store, m, bob.name)
+		}, engine.StatusDeclined},
+		{"cancelled", func(alice, bob testPlayer, m engine.Match) (engine.Match, error) {
+			return cancelMatch(alice.store, m, alice.name)
+		}, engine.StatusCancelled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			players := newTestPlayers(t, 700, "alice", "bob")
+			alice, bob := players[0], players[1]
+
+			// a match alice bet on before signing and escrows existed
+			legacy, _ := json.Marshal(engine.Match{
+				ID:       "45454545-4545-4545-4545-454545454545",
+				Mode:     string(engine.ModeClassic),
+				Status:   engine.StatusPending,
+				Host:     engine.Selection{Username: alice.name, Bet: 300},
+				Opponent: engine.Selection{Username: bob.name},
+			})
+
+			if err := alice.store.(*signedStore).DocStore.Put(dbRpsChallenge, legacy); err != nil {
+				t.Fatal(err)
+			}
+
+			if n, err := resignLegacy(bob.store, dbRpsChallenge, "status", string(engine.StatusPending)); err != nil || n != 1 {
+				t.Fatalf("signed %d: %v", n, err)
+			}
+
+			m, err := getMatch(alice.store, "45454545-4545-4545-4545-454545454545")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			settled, err := tt.settle(alice, bob, m)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			escrow, err := getEscrow(bob.store, m.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if settled.Status != tt.status || escrow.Status != EscrowReleased {
+				t.Fatalf("match %s, escrow %s", settled.Status, escrow.Status)
+			}
+
+			for _, p := range players {
+				check, err := verifyLedger(p.store, alice.name)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if !check.Balanced() || check.Cached != 1000 {
+					t.Fatalf("%s reads alice's wallet as %+v", p.name, check)
+				}
+			}
+		})
+	}
+}
+
+func TestOpenLegacyWallet(t *testing.T) {
+	mem := newMemStore("")
+	raw := mem.withPeer("p1")
+	store := newSignedStore(raw)
+
+	// an account and a wallet written before signing was introduced
+	account, _ := json.Marshal(Account{ID: "p1", Username: "alice"})
+	wallet, _ := json.Marshal(Balance{ID: "alice", Amount: 500})
+
+	for db, doc := range map[string][]byte{dbRpsAccount: account, dbRpsWallet: wallet} {
+		if err := raw.Put(db, doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := balanceOf(t, store, "alice"); got != 0 {
+		t.Fatalf("unsigned wallet read with %d", got)
+	}
+
+	// another peer cannot take the account or the wallet over
+	other := newSignedStore(mem.withPeer("p2"))
+	putAccount(t, other, "bob", testNow)
+
+	for db, id := range map[string]string{dbRpsAccount: "p1", dbRpsWallet: "alice"} {
+		if n, err := resignLegacy(other, db, "_id", id); err != nil || n != 0 {
+			t.Fatalf("p2 signed %d of %s: %v", n, db, err)
+		}
+	}
+
+	if n, err := resignLegacy(store, dbRpsAccount, "_id", "p1"); err != nil || n != 1 {
+		t.Fatalf("signed %d accounts: %v", n, err)
+	}
+
+	if err := openLedger(store, "alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := balanceOf(t, other, "alice"); got != 500 {
+		t.Fatalf("alice has %d, want 500", got)
+	}
+
+	check, err := verifyLedger(store, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !check.Balanced() {
+		t.Fatalf("ledger does not balance: %+v", check)
+	}
+}
+
+func TestGetRulesLegacyItems(t *testing.T) {
+	store := newSignedStore(newMemStore("p1"))
+
+	// items as seeded before modes and beats tables existed
+	for i, name := range []string{"rock", "paper", "scissors"} {
+		item, _ := json.Marshal(map[string]string{"_id": string(rune('1' + i)), "name": name})
+		if err := store.Put(dbRpsItem, item); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	items, rules, err := getRules(store, engine.ModeClassic)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(items) != 3 || !rules.Beats("paper", "rock") {
+		t.Fatalf("items %+v", items)
+	}
+}
+
+// racingStore runs race right after the first write to db made through it,
+// as if another player wrote at the same time.
+type racingStore struct {
+	DocStore
+	db   string
+	race func()
+}
+
+func (s *racingStore) Put(db string, doc []byte) error {
+	err := s.DocStore.Put(db, doc)
+
+	if db == s.db && s.race != nil {
+		race := s.race
+		s.race = nil
+		race()
+	}
+
+	return err
+}
+
+// racing returns a store writing as the peer of p that runs race after its
+// first write to db.
+func racing(p testPlayer, db string, race func()) DocStore {
+	return newSignedStore(&racingStore{DocStore: p.store.(*signedStore).DocStore, db: db, race: race})
+}
+
+func TestSaveMatchStale(t *testing.T) {
+	players := newTestPlayers(t, 1000, "alice", "bob")
+	alice, bob := players[0], players[1]
+
+	m, err := engine.Create("aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaa1", engine.ModeClassic, alice.name, bob.name, testNow, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := saveMatch(alice.store, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a copy read before the match was saved
+	if _, err := saveMatch(bob.store, m); !errors.Is(err, errConflict) {
+		t.Fatalf("stale copy: got %v", err)
+	}
+
+	declined, _, err := engine.Decline(saved, bob.name, testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	declined, err = saveMatch(bob.store, declined)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the outcome of a match that is over stays
+	reopened := declined
+	reopened.Status = engine.StatusPending
+
+	if _, err := saveMatch(alice.store, reopened); !errors.Is(err, engine.ErrResolved) {
+		t.Fatalf("reopened: got %v", err)
+	}
+
+	// and so does its history
+	rewritten := declined
+	rewritten.Transitions = rewritten.Transitions[:1]
+
+	if _, err := saveMatch(alice.store, rewritten); !errors.Is(err, engine.ErrLogRewritten) {
+		t.Fatalf("rewritten: got %v", err)
+	}
+}
+
+func TestCheckMatchWrite(t *testing.T) {
+	created, err := engine.Create("aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaa3", engine.ModeClassic, "alice", "bob", testNow, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	created.Version = 1
+
+	proposed, err := engine.Propose(created, "alice", 300, testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cancelled, _, err := engine.Cancel(created, "alice", testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	notified := cancelled
+	notified.HostNotified = true
+
+	stale := created
+	stale.Version = 0
+
+	tests := []struct {
+		name    string
+		current engine.Match
+		m       engine.Match
+		want    error
+	}{
+		{"a move on the latest version", created, proposed, nil},
+		{"a move on a stale version", created, stale, errConflict},
+		{"a match that is over", created, cancelled, nil},
+		{"a match over noted", cancelled, notified, nil},
+		{"a stale copy reopening a match that is over", cancelled, proposed, engine.ErrResolved},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkMatchWrite(tt.current, tt.m); !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestModifyMatchRetries(t *testing.T) {
+	players := newTestPlayers(t, 1000, "alice", "bob")
+	alice, bob := players[0], players[1]
+
+	m, err := engine.Create("aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaa2", engine.ModeClassic, alice.name, bob.name, testNow, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := saveMatch(alice.store, m); err != nil {
+		t.Fatal(err)
+	}
+
+	// bob counters while alice proposes
+	store := racing(alice, dbRpsChallenge, func() {
+		_, err := modifyMatch(bob.store, m.ID, func(m engine.Match) (engine.Match, error) {
+			return engine.Propose(m, bob.name, 400, testNow)
+		})
+		if err != nil {
+			t.Error(err)
+		}
+	})
+
+	var updates int
+
+	proposed, err := modifyMatch(store, m.ID, func(m engine.Match) (engine.Match, error) {
+		updates++
+		return engine.Propose(m, alice.name, 300, testNow)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// alice's proposal is made again on top of bob's
+	if updates != 2 || proposed.Stake != 300 || proposed.StakeBy != alice.name || proposed.Version != 4 || len(proposed.Transitions) != 4 {
+		t.Fatalf("after %d updates: %+v", updates, proposed)
+	}
+
+	// an update that keeps losing the race gives up
+	updates = 0
+
+	_, err = modifyMatch(bob.store, m.ID, func(m engine.Match) (engine.Match, error) {
+		updates++
+		m.Version--
+		return engine.Propose(m, bob.name, 500, testNow)
+	})
+
+	if !errors.Is(err, errConflict) || updates != maxAttempts {
+		t.Fatalf("after %d updates: got %v", updates, err)
+	}
+}
+
+func TestMoveFundsRetries(t *testing.T) {
+	players := newTestPlayers(t, 1000, "alice")
+	alice := players[0]
+
+	// a deposit from another tab lands once this one is journaled
+	store := racing(alice, dbRpsJournal, func() {
+		if _, err := moveFunds(alice.store, alice.name, 50); err != nil {
+			t.Error(err)
+		}
+	})
+
+	balance, err := moveFunds(store, alice.name, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if balance != 1150 {
+		t.Fatalf("balance %d, want 1150", balance)
+	}
+
+	check, err := verifyLedger(alice.store, alice.name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !check.Balanced() || check.Cached != 1150 {
+		t.Fatalf("ledger %+v", check)
+	}
+}
@@ -0,0 +1,935 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mar1n3r0/rps/engine"
+)
+
+var (
+	errUnsigned      = errors.New("document is not signed")
+	errBadSignature  = errors.New("signature does not match the document")
+	errUnknownPeer   = errors.New("document is signed by an unknown peer")
+	errPostingExists = errors.New("ledger posting already exists, postings are never changed")
+)
+
+// signedStore is a DocStore that signs every document it writes with the
+// key of its peer and drops every document it reads whose signature is
+// missing, invalid or made by a peer that does not own the document.
+//
+// A document is signed by adding a "signer" field holding the peer ID and
+// a "signature" field over the canonical encoding of the rest of the
+// document, so the records stay readable by anything that ignores them.
+//
+// Ownership depends on the collection: an account is owned by its peer, a
+// match and its escrow by its players, a journal by the player applying it,
+// a tournament by its organizer and its players, and a ledger posting by
+// the owner of the account the money leaves. A username belongs to the peer
+// that registered it first, later accounts claiming it are dropped. Wallets
+// and transactions are also written by another player when a match or a
+// tournament is settled, so they are accepted from another peer when the
+// settlement journal that peer signed pays the owner exactly what the rules
+// give them, see checkSettled. Readers flag the ones not signed by the
+// owner. Any other collection is refused. A prize pool only pays out the
+// refunds of a cancelled tournament and the prizes of a finished one whose
+// results the signed matches of its pairings bear out, see checkResults. A
+// match is also dropped when its transition log is not a valid history or
+// does not extend the log of a version of it read before.
+type signedStore struct {
+	DocStore
+
+	mu     sync.Mutex
+	peerID string
+	peers  *accountPeers // Accounts verified so far, loaded again for an unknown signer
+
+	matchMu sync.Mutex
+	matches map[string]engine.Match // Latest version of every match read, whose log later versions extend
+}
+
+func newSignedStore(store DocStore) *signedStore {
+	return &signedStore{
+		DocStore: store,
+	}
+}
+
+func (s *signedStore) PeerID() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.peerID != "" {
+		return s.peerID, nil
+	}
+
+	peerID, err := s.DocStore.PeerID()
+	if err != nil {
+		return "", err
+	}
+
+	s.peerID = peerID
+
+	return peerID, nil
+}
+
+func (s *signedStore) Put(db string, doc []byte) error {
+	peerID, err := s.PeerID()
+	if err != nil {
+		return err
+	}
+
+	fields, err := decodeFields(doc)
+	if err != nil {
+		return err
+	}
+
+	if db == dbRpsLedger {
+		id, _ := fields["_id"].(string)
+
+		existing, err := getDoc(s.DocStore, db, id)
+		if err != nil {
+			return err
+		}
+
+		if existing != nil {
+			return fmt.Errorf("%w: %s", errPostingExists, id)
+		}
+	}
+
+	fields["signer"] = peerID
+	delete(fields, "signature")
+
+	payload, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+
+	signature, err := s.Sign(payload)
+	if err != nil {
+		return err
+	}
+
+	fields["signature"] = signature
+
+	sealed, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+
+	return s.DocStore.Put(db, sealed)
+}
+
+func (s *signedStore) Get(db, id string) ([]byte, error) {
+	docs, err := s.DocStore.Get(db, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.verified(db, docs)
+}
+
+func (s *signedStore) Query(db, field, value string) ([]byte, error) {
+	docs, err := s.DocStore.Query(db, field, value)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.verified(db, docs)
+}
+
+// verified filters a result set down to the documents that pass checkDoc.
+func (s *signedStore) verified(db string, docsJSON []byte) ([]byte, error) {
+	if strings.TrimSpace(string(docsJSON)) == "null" || len(docsJSON) == 0 {
+		return docsJSON, nil
+	}
+
+	var docs []json.RawMessage
+
+	err := json.Unmarshal(docsJSON, &docs)
+	if err != nil {
+		return nil, err
+	}
+
+	var peers *accountPeers
+
+	if db != dbRpsAccount && db != dbRpsItem {
+		peers, err = s.accountPeers(false)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var (
+		valid    []json.RawMessage
+		reloaded bool
+	)
+
+	for _, doc := range docs {
+		err = s.checkDoc(db, doc, peers)
+
+		// the signer may have registered since the accounts were cached
+		if errors.Is(err, errUnknownPeer) && !reloaded {
+			reloaded = true
+
+			peers, err = s.accountPeers(true)
+			if err != nil {
+				return nil, err
+			}
+
+			err = s.checkDoc(db, doc, peers)
+		}
+
+		if err == nil {
+			valid = append(valid, doc)
+		}
+	}
+
+	if db == dbRpsAccount {
+		valid, err = firstClaims(valid)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(valid) == 0 {
+		return []byte("null"), nil
+	}
+
+	return json.Marshal(valid)
+}
+
+// checkDoc verifies the signature of doc and that its signer may write it.
+// A match also has to keep the history of the versions read before it.
+func (s *signedStore) checkDoc(db string, doc []byte, peers *accountPeers) error {
+	signer, err := s.verifySignature(doc)
+	if err != nil {
+		return err
+	}
+
+	err = s.checkSigner(db, doc, signer, peers)
+	if err != nil || db != dbRpsChallenge {
+		return err
+	}
+
+	return s.checkHistory(doc)
+}
+
+// checkHistory returns an error unless the match doc has a valid transition
+// log that extends the log of the latest version of the match read so far.
+// An older version, replayed or forged, is refused; a concurrent write of
+// the same version replaces the one remembered.
+func (s *signedStore) checkHistory(doc []byte) error {
+	var m engine.Match
+
+	err := json.Unmarshal(doc, &m)
+	if err != nil {
+		return err
+	}
+
+	err = m.CheckHistory()
+	if err != nil {
+		return fmt.Errorf("match %s: %w", m.ID, err)
+	}
+
+	s.matchMu.Lock()
+	defer s.matchMu.Unlock()
+
+	prev, ok := s.matches[m.ID]
+
+	switch {
+	case !ok || m.Version == prev.Version:
+	case m.Version < prev.Version:
+		return fmt.Errorf("match %s: version %d read after version %d", m.ID, m.Version, prev.Version)
+	default:
+		err = m.CheckLog(prev)
+		if err != nil {
+			return fmt.Errorf("match %s: %w", m.ID, err)
+		}
+	}
+
+	if s.matches == nil {
+		s.matches = make(map[string]engine.Match)
+	}
+
+	s.matches[m.ID] = m
+
+	return nil
+}
+
+// checkSigner returns an error unless signer may write doc to db.
+func (s *signedStore) checkSigner(db string, doc []byte, signer string, peers *accountPeers) error {
+	var err error
+
+	if peers != nil && !peers.registered(signer) {
+		return fmt.Errorf("%w: %s", errUnknownPeer, signer)
+	}
+
+	switch db {
+	case dbRpsItem:
+		// items are game data seeded by whoever runs the server, getRules
+		// checks that the items of a mode make a game
+		return nil
+	case dbRpsAccount:
+		var account Account
+
+		err = json.Unmarshal(doc, &account)
+		if err != nil {
+			return err
+		}
+
+		if account.ID != signer {
+			return fmt.Errorf("account %s is signed by %s", account.ID, signer)
+		}
+
+		return nil
+	case dbRpsChallenge:
+		var m struct {
+			Host     struct{ Username string }
+			Opponent struct{ Username string }
+			Players  []struct{ Username string }
+		}
+
+		err = json.Unmarshal(doc, &m)
+		if err != nil {
+			return err
+		}
+
+		if peers.owns(m.Host.Username, signer) || peers.owns(m.Opponent.Username, signer) {
+			return nil
+		}
+
+		for _, p := range m.Players {
+			if peers.owns(p.Username, signer) {
+				return nil
+			}
+		}
+
+		return fmt.Errorf("match is signed by %s who does not play in it", signer)
+	case dbRpsJournal:
+		var j struct {
+			Owner string `json:"owner"`
+		}
+
+		err = json.Unmarshal(doc, &j)
+		if err != nil {
+			return err
+		}
+
+		if peers.owns(j.Owner, signer) {
+			return nil
+		}
+
+		return fmt.Errorf("journal of %s is signed by %s", j.Owner, signer)
+	case dbRpsEscrow:
+		var e struct {
+			ID string `json:"_id"`
+		}
+
+		err = json.Unmarshal(doc, &e)
+		if err != nil {
+			return err
+		}
+
+		if s.ownsAccount(escrowAccount(e.ID), signer, peers) {
+			return nil
+		}
+
+		return fmt.Errorf("escrow of match %s is signed by %s who does not play in it", e.ID, signer)
+	case dbRpsLedger:
+		var p Posting
+
+		err = json.Unmarshal(doc, &p)
+		if err != nil {
+			return err
+		}
+
+		// the opening posting of a wallet only brings its balance from
+		// before the ledger onto it
+		if strings.HasPrefix(p.ID, openingID("")) && !p.opens(strings.TrimPrefix(p.ID, openingID(""))) {
+			return fmt.Errorf("opening posting %s moves %s to %s", p.ID, p.Credit, p.Debit)
+		}
+
+		// a prize pool only pays back the entry fees of a cancelled
+		// tournament and the prizes of a finished one
+		if strings.HasPrefix(p.Credit, poolAccount("")) && !s.paysOut(p, peers) {
+			return fmt.Errorf("posting %s pays %s out of %s", p.ID, p.Debit, p.Credit)
+		}
+
+		// money leaves an account only on behalf of its owner, money from
+		// outside the game or from before the ledger only enters a wallet
+		// of the signer
+		if s.ownsAccount(p.Credit, signer, peers) {
+			return nil
+		}
+
+		if (p.Credit == accountExternal || p.Credit == accountOpening) && s.ownsAccount(p.Debit, signer, peers) {
+			return nil
+		}
+
+		return fmt.Errorf("posting %s from %s is signed by %s", p.ID, p.Credit, signer)
+	case dbRpsTournament:
+		var t Tournament
+
+		err = json.Unmarshal(doc, &t)
+		if err != nil {
+			return err
+		}
+
+		if peers.owns(t.Organizer, signer) || t.Joined(peers.byPeer[signer]) {
+			return nil
+		}
+
+		return fmt.Errorf("tournament %s is signed by %s who neither organizes nor plays in it", t.ID, signer)
+	case dbRpsWallet, dbRpsTransaction:
+		var owned struct {
+			ID       string `json:"_id"`
+			Username string `json:"username"`
+		}
+
+		err = json.Unmarshal(doc, &owned)
+		if err != nil {
+			return err
+		}
+
+		username := owned.Username
+		if db == dbRpsWallet {
+			username = owned.ID
+		}
+
+		if peers.owns(username, signer) {
+			return nil
+		}
+
+		return s.checkSettled(db, doc, username, signer, peers)
+	}
+
+	return fmt.Errorf("no peer may write to %s", db)
+}
+
+// ownsAccount reports whether signer may move money out of the ledger
+// account: a wallet is owned by its player, the escrow of a match by its
+// players, and the prize pool of a tournament by its organizer and its
+// players.
+func (s *signedStore) ownsAccount(account, signer string, peers *accountPeers) bool {
+	kind, id, _ := strings.Cut(account, ":")
+
+	switch kind {
+	case "wallet":
+		return peers.owns(id, signer)
+	case "escrow":
+		m, err := s.verifiedMatch(id, peers)
+		return err == nil && m.Plays(peers.byPeer[signer])
+	case "tournament":
+		t, err := s.verifiedTournament(id, peers)
+		return err == nil && (t.Organizer == peers.byPeer[signer] || t.Joined(peers.byPeer[signer]))
+	}
+
+	return false
+}
+
+// checkSettled returns nil when doc, a wallet or a transaction of username
+// signed by another peer, is a write of a settlement journal that peer
+// signed and that pays username what the rules give them: the payout or
+// the refunds of a resolved match both play in and whose escrow the journal
+// releases, the entry fee of a cancelled tournament back or the prize of a
+// finished one. A wallet also has to hold what the ledger gave it up to the
+// posting of that settlement; later postings belong to settlements that
+// write the wallet again.
+func (s *signedStore) checkSettled(db string, doc []byte, username, signer string, peers *accountPeers) error {
+	settler := peers.byPeer[signer]
+
+	journalsJSON, err := s.DocStore.Query(dbRpsJournal, "owner", settler)
+	if err != nil {
+		return err
+	}
+
+	var journals []json.RawMessage
+
+	if strings.TrimSpace(string(journalsJSON)) != "null" && len(journalsJSON) > 0 {
+		err = json.Unmarshal(journalsJSON, &journals)
+		if err != nil {
+			return err
+		}
+	}
+
+	var settlement *Journal
+
+	for _, raw := range journals {
+		journalSigner, err := s.verifySignature(raw)
+		if err != nil || journalSigner != signer {
+			continue
+		}
+
+		var j Journal
+
+		err = json.Unmarshal(raw, &j)
+		if err != nil {
+			return err
+		}
+
+		if j.Owner == settler && s.credits(db, doc, j, username, peers) {
+			settlement = &j
+			break
+		}
+	}
+
+	if settlement == nil {
+		return fmt.Errorf("%s of %s is signed by %s outside a settlement that pays them", db, username, signer)
+	}
+
+	if db != dbRpsWallet {
+		return nil
+	}
+
+	var wallet Balance
+
+	err = json.Unmarshal(doc, &wallet)
+	if err != nil {
+		return err
+	}
+
+	ledger, err := ledgerBalanceAt(s, walletAccount(username), postedAt(*settlement, walletAccount(username)))
+	if err != nil {
+		return err
+	}
+
+	if wallet.Amount != ledger {
+		return fmt.Errorf("wallet of %s signed by %s holds %d, its ledger %d", username, signer, wallet.Amount, ledger)
+	}
+
+	return nil
+}
+
+// postedAt returns when the latest posting journal j makes on account was
+// made, or the zero time when it makes none.
+func postedAt(j Journal, account string) time.Time {
+	var at time.Time
+
+	for _, w := range j.Writes {
+		var p Posting
+
+		if w.DB != dbRpsLedger || json.Unmarshal(w.After, &p) != nil {
+			continue
+		}
+
+		if (p.Debit == account || p.Credit == account) && p.Timestamp.After(at) {
+			at = p.Timestamp
+		}
+	}
+
+	return at
+}
+
+// credits reports whether journal j writes doc, a wallet or a transaction
+// of username, as the credit its settlement pays them, or puts the wallet
+// back as it was when undoing it.
+func (s *signedStore) credits(db string, doc []byte, j Journal, username string, peers *accountPeers) bool {
+	for _, w := range j.Writes {
+		if w.DB != db {
+			continue
+		}
+
+		if db == dbRpsWallet && sameDoc(w.Before, doc) {
+			return true
+		}
+
+		if !sameDoc(w.After, doc) {
+			continue
+		}
+
+		amounts, ok := s.settles(j, username, peers)
+		if !ok {
+			return false
+		}
+
+		if db == dbRpsWallet {
+			var before, after Balance
+
+			if isNull(w.Before) || json.Unmarshal(w.Before, &before) != nil || json.Unmarshal(w.After, &after) != nil {
+				return false
+			}
+
+			var total int
+			for _, amount := range amounts {
+				total += amount
+			}
+
+			return after.ID == username && before.ID == username && after.Amount-before.Amount == total
+		}
+
+		var t Transaction
+
+		if json.Unmarshal(w.After, &t) != nil || t.Type != TypeDebit || t.MatchID != j.MatchID || t.TournamentID != j.TournamentID {
+			return false
+		}
+
+		for _, amount := range amounts {
+			if t.Amount == amount {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	return false
+}
+
+// paysOut reports whether p, a posting out of the prize pool of a
+// tournament, pays a player their entry fee back once the tournament is
+// cancelled or the prize they won once it is finished.
+func (s *signedStore) paysOut(p Posting, peers *accountPeers) bool {
+	t, err := s.verifiedTournament(strings.TrimPrefix(p.Credit, poolAccount("")), peers)
+	if err != nil {
+		return false
+	}
+
+	kind, username, _ := strings.Cut(p.Debit, ":")
+	if kind != "wallet" || !t.Joined(username) {
+		return false
+	}
+
+	switch {
+	case p.Kind == KindRefund && t.Status == TournamentCancelled:
+		return p.Amount == t.EntryFee
+	case p.Kind == KindPrize && t.Status == TournamentFinished:
+		return p.Amount == s.prize(t, username, peers)
+	}
+
+	return false
+}
+
+// settles returns the amounts the settlement of journal j pays username, and
+// whether j settles a match or a tournament username and the owner of j
+// both take part in.
+func (s *signedStore) settles(j Journal, username string, peers *accountPeers) ([]int, bool) {
+	var amounts []int
+
+	switch {
+	case j.MatchID != "":
+		m, err := s.verifiedMatch(j.MatchID, peers)
+		if err != nil || !m.Resolved() || !m.Plays(username) || !m.Plays(j.Owner) || !j.releases(j.MatchID) {
+			return nil, false
+		}
+
+		for _, mv := range m.Payouts() {
+			if mv.Username == username {
+				amounts = append(amounts, mv.Amount)
+			}
+		}
+	case j.TournamentID != "":
+		t, err := s.verifiedTournament(j.TournamentID, peers)
+		if err != nil || !t.Joined(username) {
+			return nil, false
+		}
+
+		switch {
+		case t.Status == TournamentCancelled && t.Organizer == j.Owner && t.EntryFee > 0:
+			amounts = append(amounts, t.EntryFee)
+		case t.Status == TournamentFinished && t.Joined(j.Owner):
+			if prize := s.prize(t, username, peers); prize > 0 {
+				amounts = append(amounts, prize)
+			}
+		}
+	}
+
+	return amounts, len(amounts) > 0
+}
+
+// prize returns the prize username won in the finished tournament t, none
+// when the pairings of t do not hold up against the matches played in it.
+func (s *signedStore) prize(t Tournament, username string, peers *accountPeers) int {
+	err := checkResults(t, func(id string) (engine.Match, error) {
+		return s.verifiedMatch(id, peers)
+	})
+	if err != nil {
+		return 0
+	}
+
+	placings := engine.Placings(t.Format, t.Players, t.Pairings)
+
+	return engine.Prizes(t.Pool(), len(t.Players), placings)[username]
+}
+
+// verifiedMatch returns the match with id when it passes checkDoc.
+func (s *signedStore) verifiedMatch(id string, peers *accountPeers) (engine.Match, error) {
+	var m engine.Match
+
+	doc, err := s.verifiedDoc(dbRpsChallenge, id, peers)
+	if err != nil || doc == nil {
+		return m, fmt.Errorf("match %s not found: %v", id, err)
+	}
+
+	return m, json.Unmarshal(doc, &m)
+}
+
+// verifiedTournament returns the tournament with id when it passes checkDoc.
+func (s *signedStore) verifiedTournament(id string, peers *accountPeers) (Tournament, error) {
+	var t Tournament
+
+	doc, err := s.verifiedDoc(dbRpsTournament, id, peers)
+	if err != nil || doc == nil {
+		return t, fmt.Errorf("tournament %s not found: %v", id, err)
+	}
+
+	return t, json.Unmarshal(doc, &t)
+}
+
+// verifiedDoc returns the document with id when it passes checkDoc, or nil.
+func (s *signedStore) verifiedDoc(db, id string, peers *accountPeers) (json.RawMessage, error) {
+	doc, err := getDoc(s.DocStore, db, id)
+	if err != nil || doc == nil {
+		return nil, err
+	}
+
+	if s.checkDoc(db, doc, peers) != nil {
+		return nil, nil
+	}
+
+	return doc, nil
+}
+
+// verifySignature checks the seal of doc and returns its signer.
+func (s *signedStore) verifySignature(doc []byte) (string, error) {
+	fields, err := decodeFields(doc)
+	if err != nil {
+		return "", err
+	}
+
+	signer, _ := fields["signer"].(string)
+	signature, _ := fields["signature"].(string)
+
+	if signer == "" || signature == "" {
+		return "", errUnsigned
+	}
+
+	delete(fields, "signature")
+
+	payload, err := json.Marshal(fields)
+	if err != nil {
+		return "", err
+	}
+
+	ok, err := s.Verify(signer, payload, signature)
+	if err != nil {
+		return "", err
+	}
+
+	if !ok {
+		return "", errBadSignature
+	}
+
+	return signer, nil
+}
+
+// accountPeers maps usernames to the peers that registered them.
+type accountPeers struct {
+	byUsername map[string]string
+	byPeer     map[string]string
+}
+
+// accountPeers returns the accounts verified so far, verifying them only
+// the first time or when reload is set. A username keeps the peer it was
+// cached with even if another account claiming it shows up later.
+func (s *signedStore) accountPeers(reload bool) (*accountPeers, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.peers != nil && !reload {
+		return s.peers, nil
+	}
+
+	accountsJSON, err := s.DocStore.Query(dbRpsAccount, "all", "")
+	if err != nil {
+		return nil, err
+	}
+
+	accountsJSON, err = s.verified(dbRpsAccount, accountsJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	peers := &accountPeers{
+		byUsername: make(map[string]string),
+		byPeer:     make(map[string]string),
+	}
+
+	if strings.TrimSpace(string(accountsJSON)) != "null" {
+		var accounts []Account
+
+		err = json.Unmarshal(accountsJSON, &accounts)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, acc := range accounts {
+			peers.byUsername[acc.Username] = acc.ID
+			peers.byPeer[acc.ID] = acc.Username
+		}
+	}
+
+	if s.peers != nil {
+		for username, peerID := range s.peers.byUsername {
+			if claimant, ok := peers.byUsername[username]; ok && claimant != peerID {
+				delete(peers.byPeer, claimant)
+			}
+
+			peers.byUsername[username] = peerID
+			peers.byPeer[peerID] = username
+		}
+	}
+
+	s.peers = peers
+
+	return peers, nil
+}
+
+// owns reports whether username belongs to peerID.
+func (p *accountPeers) owns(username, peerID string) bool {
+	id, ok := p.byUsername[username]
+	return ok && id == peerID
+}
+
+func (p *accountPeers) registered(peerID string) bool {
+	_, ok := p.byPeer[peerID]
+	return ok
+}
+
+// firstClaims drops the accounts that claim a username another peer
+// registered before them, so that a username belongs to the peer that
+// registered it first. Accounts registered before CreatedAt was recorded
+// count as the earliest, in the order the store returned them.
+func firstClaims(docs []json.RawMessage) ([]json.RawMessage, error) {
+	accounts := make([]Account, len(docs))
+	order := make([]int, len(docs))
+
+	for i, doc := range docs {
+		err := json.Unmarshal(doc, &accounts[i])
+		if err != nil {
+			return nil, err
+		}
+
+		order[i] = i
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		return accounts[order[i]].CreatedAt.Before(accounts[order[j]].CreatedAt)
+	})
+
+	claimed := make(map[string]bool, len(accounts))
+	keep := make([]bool, len(accounts))
+
+	for _, i := range order {
+		if !claimed[accounts[i].Username] {
+			claimed[accounts[i].Username] = true
+			keep[i] = true
+		}
+	}
+
+	var first []json.RawMessage
+
+	for i, doc := range docs {
+		if keep[i] {
+			first = append(first, doc)
+		}
+	}
+
+	return first, nil
+}
+
+// resignLegacy signs again, as the peer of store, the documents of db whose
+// field has value that were written before signing was introduced and that
+// the peer may write, so that they can be read through the signed store
+// again. It returns how many it signed. A store that does not sign has
+// nothing to migrate.
+func resignLegacy(store DocStore, db, field, value string) (int, error) {
+	signed, ok := store.(*signedStore)
+	if !ok {
+		return 0, nil
+	}
+
+	peerID, err := signed.PeerID()
+	if err != nil {
+		return 0, err
+	}
+
+	docsJSON, err := signed.DocStore.Query(db, field, value)
+	if err != nil {
+		return 0, err
+	}
+
+	if strings.TrimSpace(string(docsJSON)) == "null" || len(docsJSON) == 0 {
+		return 0, nil
+	}
+
+	var docs []json.RawMessage
+
+	err = json.Unmarshal(docsJSON, &docs)
+	if err != nil {
+		return 0, err
+	}
+
+	var legacy []json.RawMessage
+
+	for _, doc := range docs {
+		if _, err := signed.verifySignature(doc); errors.Is(err, errUnsigned) {
+			legacy = append(legacy, doc)
+		}
+	}
+
+	if len(legacy) == 0 {
+		return 0, nil
+	}
+
+	var peers *accountPeers
+
+	// the account of the peer may just have been signed again
+	if db != dbRpsAccount && db != dbRpsItem {
+		peers, err = signed.accountPeers(true)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	var resigned int
+
+	for _, doc := range legacy {
+		if signed.checkSigner(db, doc, peerID, peers) != nil {
+			continue
+		}
+
+		err = signed.Put(db, doc)
+		if err != nil {
+			return resigned, err
+		}
+
+		resigned++
+	}
+
+	return resigned, nil
+}
+
+// decodeFields decodes a JSON object keeping numbers as they were written,
+// so that re-encoding it yields the bytes that were signed.
+func decodeFields(doc []byte) (map[string]any, error) {
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.UseNumber()
+
+	var fields map[string]any
+
+	err := dec.Decode(&fields)
+	if err != nil {
+		return nil, err
+	}
+
+	if fields == nil {
+		return nil, errors.New("document is not an object")
+	}
+
+	return fields, nil
+}
@@ -0,0 +1,441 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mar1n3r0/rps/engine"
+)
+
+// putAccount registers username for the peer of store at createdAt.
+func putAccount(t *testing.T, store DocStore, username string, createdAt time.Time) {
+	t.Helper()
+
+	peerID, err := store.PeerID()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	account, _ := json.Marshal(Account{ID: peerID, Username: username, CreatedAt: createdAt})
+	if err := store.Put(dbRpsAccount, account); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFirstClaimOwnsUsername(t *testing.T) {
+	mem := newMemStore("")
+	first := newSignedStore(mem.withPeer("p1"))
+	second := newSignedStore(mem.withPeer("p2"))
+	late := newSignedStore(mem.withPeer("p3"))
+
+	// p2 writes its claim first but registered later than p1
+	putAccount(t, second, "alice", testNow.Add(time.Hour))
+	putAccount(t, first, "alice", testNow)
+	putAccount(t, late, "bob", testNow)
+
+	accountsJSON, err := late.Query(dbRpsAccount, "all", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertIDs(t, accountsJSON, []string{"p1", "p3"})
+
+	m, err := engine.Create("22222222-2222-2222-2222-222222222222", engine.ModeClassic, "alice", "bob", testNow, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the later claim cannot write as alice, the write does not read back
+	if _, err := saveMatch(second, m); err == nil {
+		t.Fatal("later claim wrote a match of alice")
+	}
+
+	got, err := late.Get(dbRpsChallenge, m.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertIDs(t, got, nil)
+
+	if _, err := saveMatch(first, m); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err = late.Get(dbRpsChallenge, m.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertIDs(t, got, []string{m.ID})
+}
+
+func TestWalletWrittenBySettlement(t *testing.T) {
+	players := newTestPlayers(t, 1000, "alice", "bob", "carol")
+	alice, bob, carol := players[0], players[1], players[2]
+	rules := classicRules(t)
+
+	m, err := engine.Create("33333333-3333-3333-3333-333333333333", engine.ModeClassic, alice.name, bob.name, testNow, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err = engine.Propose(m, alice.name, 300, testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err = engine.AgreeStake(m, bob.name, testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err = saveMatch(alice.store, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opened, stakes, err := engine.Open(rules, m, engine.Selection{Username: alice.name, ItemName: "rock", Bet: 300}, "salt", testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := settleMatch(alice.store, alice.name, opened, stakes); err != nil {
+		t.Fatal(err)
+	}
+
+	opened, err = getMatch(bob.store, m.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// bob refunds alice's stake by declining
+	if _, err := declineMatch(bob.store, opened, bob.name); err != nil {
+		t.Fatal(err)
+	}
+
+	wallet, err := getBalance(carol.store, alice.name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if wallet.Amount != 1000 || wallet.Signer != "peer-b" {
+		t.Fatalf("alice's wallet holds %d signed by %s", wallet.Amount, wallet.Signer)
+	}
+
+	// carol plays no match with alice, so she cannot credit her
+	wallet.Amount += 500
+	walletJSON, _ := json.Marshal(wallet)
+
+	if err := carol.store.Put(dbRpsWallet, walletJSON); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range players {
+		got, err := getBalance(p.store, alice.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got.ID != "" {
+			t.Fatalf("%s reads the wallet carol wrote: %+v", p.name, got)
+		}
+	}
+
+	// neither can bob outside a settlement of their match
+	wallet.Amount = 1500
+	walletJSON, _ = json.Marshal(wallet)
+
+	if err := bob.store.Put(dbRpsWallet, walletJSON); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := getBalance(alice.store, alice.name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.ID != "" {
+		t.Fatalf("alice reads the wallet bob wrote: %+v", got)
+	}
+}
+
+func TestWalletSettledAgain(t *testing.T) {
+	players := newTestPlayers(t, 1000, "alice", "bob", "carol")
+	alice, bob, carol := players[0], players[1], players[2]
+
+	// bob refunds alice's stake, leaving her wallet signed by him
+	declined := openedMatch(t, alice, bob, "33333333-3333-3333-3333-333333333334", 300)
+
+	if _, err := declineMatch(bob.store, declined, bob.name); err != nil {
+		t.Fatal(err)
+	}
+
+	// the wallet stays valid while alice stakes from it and carol refunds
+	// her again
+	staked := openedMatch(t, alice, carol, "33333333-3333-3333-3333-333333333335", 200)
+
+	if _, err := declineMatch(carol.store, staked, carol.name); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range players {
+		check, err := verifyLedger(p.store, alice.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !check.Balanced() || check.Cached != 1000 {
+			t.Fatalf("%s reads alice's wallet as %+v", p.name, check)
+		}
+	}
+}
+
+func TestMatchHistoryOnRead(t *testing.T) {
+	players := newTestPlayers(t, 1000, "alice", "bob")
+	alice, bob := players[0], players[1]
+	raw := alice.store.(*signedStore).DocStore
+
+	m, err := engine.Create("56565656-5656-5656-5656-565656565656", engine.ModeClassic, alice.name, bob.name, testNow, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := saveMatch(alice.store, m); err != nil {
+		t.Fatal(err)
+	}
+
+	created, err := getDoc(raw, dbRpsChallenge, m.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// bob reads the match as created, then with alice's proposal
+	if m, err = getMatch(bob.store, m.ID); err != nil || m.ID == "" {
+		t.Fatalf("created match not read: %v", err)
+	}
+
+	proposed, err := modifyMatch(alice.store, m.ID, func(m engine.Match) (engine.Match, error) {
+		return engine.Propose(m, alice.name, 300, testNow)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m, err = getMatch(bob.store, m.ID); err != nil || m.Version != proposed.Version {
+		t.Fatalf("read version %d: %v", m.Version, err)
+	}
+
+	backdated := proposed
+	backdated.Transitions = append([]engine.Transition(nil), proposed.Transitions...)
+	backdated.Transitions[0].At = testNow.Add(-engine.MoveWindow)
+	backdated.Version++
+
+	won := proposed
+	won.Status = engine.StatusCompleted
+	won.Winner, won.Loser = alice.name, bob.name
+	won.Version++
+
+	tests := []struct {
+		name  string
+		put   func() error
+		fresh bool // whether a peer reading the match for the first time drops it too
+	}{
+		{"an earlier version replayed", func() error {
+			return raw.Put(dbRpsChallenge, created)
+		}, false},
+		{"a backdated history", func() error {
+			matchJSON, _ := json.Marshal(backdated)
+			return alice.store.Put(dbRpsChallenge, matchJSON)
+		}, false},
+		{"an outcome the history does not lead to", func() error {
+			matchJSON, _ := json.Marshal(won)
+			return alice.store.Put(dbRpsChallenge, matchJSON)
+		}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.put(); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := getMatch(bob.store, m.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got.ID != "" {
+				t.Fatalf("bob reads version %d", got.Version)
+			}
+
+			got, err = getMatch(newSignedStore(raw), m.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if (got.ID == "") != tt.fresh {
+				t.Fatalf("a fresh reader reads version %d", got.Version)
+			}
+		})
+	}
+
+	// the match carries on from the version bob read last
+	proposedJSON, _ := json.Marshal(proposed)
+	if err := alice.store.Put(dbRpsChallenge, proposedJSON); err != nil {
+		t.Fatal(err)
+	}
+
+	agreed, err := modifyMatch(bob.store, m.ID, func(m engine.Match) (engine.Match, error) {
+		return engine.AgreeStake(m, bob.name, testNow)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m, err = getMatch(alice.store, m.ID); err != nil || m.Version != agreed.Version || !m.StakeAgreed {
+		t.Fatalf("agreed match read as %+v: %v", m, err)
+	}
+}
+
+func TestForgedSettlement(t *testing.T) {
+	players := newTestPlayers(t, 1000, "alice", "mallory")
+	alice, mallory := players[0], players[1]
+
+	tests := []struct {
+		name   string
+		winner string
+		amount int
+	}{
+		// alice is paid nothing by a match mallory won
+		{"wallet emptied", mallory.name, 0},
+		// alice is paid by the match, but the ledger does not back it
+		{"payout off the ledger", alice.name, 1500},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id := fmt.Sprintf("55555555-5555-5555-5555-55555555555%d", i)
+
+			// a match of the two that mallory alone made up and signed
+			m := engine.Match{
+				ID:        id,
+				Status:    engine.StatusCompleted,
+				Host:      engine.Selection{Username: mallory.name, Bet: 250},
+				Opponent:  engine.Selection{Username: alice.name, Bet: 250},
+				BetAmount: 500,
+				Winner:    tt.winner,
+			}
+
+			before, err := getBalance(mallory.store, alice.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			after := before
+			after.Amount = tt.amount
+			after.Version++
+
+			s := newSettlement(mallory.store, id, mallory.name)
+			for db, doc := range map[string]any{dbRpsChallenge: m, dbRpsEscrow: Escrow{ID: id, Status: EscrowReleased}} {
+				if err := s.put(db, id, doc); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := s.put(dbRpsWallet, alice.name, after); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := s.commit(); err == nil {
+				t.Fatal("forged settlement applied")
+			}
+
+			// even written without the journal applying it
+			walletJSON, _ := json.Marshal(after)
+			if err := mallory.store.Put(dbRpsWallet, walletJSON); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := getBalance(alice.store, alice.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got.ID != "" {
+				t.Fatalf("alice reads the wallet mallory wrote: %+v", got)
+			}
+
+			// put back, as alice would find it on her own wallet page
+			walletJSON, _ = json.Marshal(before)
+			if err := alice.store.Put(dbRpsWallet, walletJSON); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// countingStore counts the signatures verified through it.
+type countingStore struct {
+	DocStore
+	verified int
+}
+
+func (s *countingStore) Verify(peerID string, data []byte, signature string) (bool, error) {
+	s.verified++
+	return s.DocStore.Verify(peerID, data, signature)
+}
+
+func TestAccountPeersCached(t *testing.T) {
+	mem := newMemStore("")
+	alice := newSignedStore(mem.withPeer("p1"))
+	putAccount(t, alice, "alice", testNow)
+
+	wallet, _ := json.Marshal(Balance{ID: "alice"})
+	if err := alice.Put(dbRpsWallet, wallet); err != nil {
+		t.Fatal(err)
+	}
+
+	counting := &countingStore{DocStore: mem.withPeer("p2")}
+	bob := newSignedStore(counting)
+
+	for i := 0; i < 3; i++ {
+		if _, err := bob.Query(dbRpsWallet, "all", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the account of alice is verified on the first read only, the wallet
+	// on every read
+	if counting.verified != 4 {
+		t.Fatalf("verified %d signatures, want 4", counting.verified)
+	}
+
+	// a peer registering afterwards is picked up on its first document
+	putAccount(t, bob, "bob", testNow)
+
+	wallet, _ = json.Marshal(Balance{ID: "bob"})
+	if err := bob.Put(dbRpsWallet, wallet); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := bob.Get(dbRpsWallet, "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertIDs(t, got, []string{"bob"})
+
+	// a later claim on a cached username does not take it over
+	mallory := newSignedStore(mem.withPeer("p3"))
+	putAccount(t, mallory, "alice", testNow.Add(-time.Hour))
+
+	if _, err := bob.accountPeers(true); err != nil {
+		t.Fatal(err)
+	}
+
+	if peers := bob.peers; !peers.owns("alice", "p1") || peers.registered("p3") {
+		t.Fatalf("alice owned by %s", peers.byUsername["alice"])
+	}
+}
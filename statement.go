@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// StatementRow is a transaction along with the balance it left the wallet
+// with.
+type StatementRow struct {
+	Transaction
+	Balance int `json:"balance"` // Running balance in cents
+}
+
+// newStatement returns the transactions newest first, each with the running
+// balance of the wallet after it. The balance starts from opening, the
+// posting that put the wallet on the ledger, whose amount already holds the
+// transactions made before it.
+func newStatement(opening Posting, transactions []Transaction) []StatementRow {
+	rows := make([]StatementRow, len(transactions))
+
+	for i, t := range transactions {
+		rows[i] = StatementRow{Transaction: t}
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		return rows[i].Timestamp.Before(rows[j].Timestamp)
+	})
+
+	balance := opening.Amount
+	if opening.Debit == accountOpening {
+		balance = -balance
+	}
+
+	for _, r := range rows {
+		if r.Timestamp.Before(opening.Timestamp) {
+			balance -= r.SignedAmount()
+		}
+	}
+
+	for i := range rows {
+		balance += rows[i].SignedAmount()
+		rows[i].Balance = balance
+	}
+
+	// Newest first
+	for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+		rows[i], rows[j] = rows[j], rows[i]
+	}
+
+	return rows
+}
+
+// TransactionFilter selects the rows of a statement. Zero fields select
+// everything.
+type TransactionFilter struct {
+	From time.Time // First day included
+	To   time.Time // Last day included
+	Kind string    // Kind, or type of transactions without one
+}
+
+func (f TransactionFilter) Match(r StatementRow) bool {
+	if !f.From.IsZero() && r.Timestamp.Before(f.From) {
+		return false
+	}
+
+	if !f.To.IsZero() && !r.Timestamp.Before(f.To.AddDate(0, 0, 1)) {
+		return false
+	}
+
+	if f.Kind != "" && r.Label() != f.Kind {
+		return false
+	}
+
+	return true
+}
+
+func filterStatement(rows []StatementRow, f TransactionFilter) []StatementRow {
+	var filtered []StatementRow
+
+	for _, r := range rows {
+		if f.Match(r) {
+			filtered = append(filtered, r)
+		}
+	}
+
+	return filtered
+}
+
+// parseDay parses a date as the browser's date inputs give it, returning
+// the zero time for an empty one.
+func parseDay(day string) (time.Time, error) {
+	if day == "" {
+		return time.Time{}, nil
+	}
+
+	return time.ParseInLocation("2006-01-02", day, time.Local)
+}
+
+// statementCSV encodes rows as CSV with the amounts in euros.
+func statementCSV(rows []StatementRow) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	w := csv.NewWriter(buf)
+
+	err := w.Write([]string{"id", "timestamp", "kind", "type", "amount", "balance", "match_id", "counterparty", "tournament_id"})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range rows {
+		err = w.Write([]string{
+			r.ID,
+			r.Timestamp.Format(time.RFC3339),
+			r.Label(),
+			string(r.Type),
+			euros(r.SignedAmount()),
+			euros(r.Balance),
+			r.MatchID,
+			r.Counterparty,
+			r.TournamentID,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	w.Flush()
+
+	return buf.Bytes(), w.Error()
+}
+
+func statementJSON(rows []StatementRow) ([]byte, error) {
+	if rows == nil {
+		rows = []StatementRow{}
+	}
+
+	return json.MarshalIndent(rows, "", "  ")
+}
+
+func euros(cents int) string {
+	return strconv.FormatFloat(float64(cents)/100, 'f', 2, 64)
+}
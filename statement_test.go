@@ -0,0 +1,293 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// day returns noon of the nth day of January 2026, local time.
+func day(n int) time.Time {
+	return time.Date(2026, 1, n, 12, 0, 0, 0, time.Local)
+}
+
+// balances returns the running balances of rows.
+func balances(rows []StatementRow) []int {
+	var got []int
+
+	for _, r := range rows {
+		got = append(got, r.Balance)
+	}
+
+	return got
+}
+
+// ids returns the IDs of rows.
+func ids(rows []StatementRow) []string {
+	var got []string
+
+	for _, r := range rows {
+		got = append(got, r.ID)
+	}
+
+	return got
+}
+
+func TestNewStatement(t *testing.T) {
+	deposit := Transaction{ID: "t1", Type: TypeDebit, Kind: KindDeposit, Amount: 500, Timestamp: day(3)}
+	stake := Transaction{ID: "t2", Type: TypeCredit, Kind: KindStake, Amount: 200, Timestamp: day(4)}
+	legacy := Transaction{ID: "t0", Type: TypeDebit, Amount: 300, Timestamp: day(1)}
+
+	tests := []struct {
+		name         string
+		opening      Posting
+		transactions []Transaction
+		ids          []string
+		balances     []int
+	}{
+		{"no transactions", Posting{}, nil, nil, nil},
+		{"a wallet without an opening", Posting{}, []Transaction{stake, deposit}, []string{"t2", "t1"}, []int{300, 500}},
+		{"an opening balance", Posting{Debit: walletAccount("alice"), Credit: accountOpening, Amount: 1000, Timestamp: day(2)}, []Transaction{stake, deposit}, []string{"t2", "t1"}, []int{1300, 1500}},
+		{"an opening debt", Posting{Debit: accountOpening, Credit: walletAccount("alice"), Amount: 100, Timestamp: day(2)}, []Transaction{deposit}, []string{"t1"}, []int{400}},
+		{"transactions before the ledger", Posting{Debit: walletAccount("alice"), Credit: accountOpening, Amount: 1000, Timestamp: day(2)}, []Transaction{deposit, legacy, stake}, []string{"t2", "t1", "t0"}, []int{1300, 1500, 1000}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows := newStatement(tt.opening, tt.transactions)
+
+			if got := ids(rows); !reflect.DeepEqual(got, tt.ids) {
+				t.Fatalf("rows %v, want %v", got, tt.ids)
+			}
+
+			if got := balances(rows); !reflect.DeepEqual(got, tt.balances) {
+				t.Fatalf("balances %v, want %v", got, tt.balances)
+			}
+		})
+	}
+}
+
+func TestStatementMatchesWallet(t *testing.T) {
+	players := newTestPlayers(t, 1000, "bob")
+	bob := players[0]
+
+	// carol's wallet was funded before the ledger was kept
+	carol := testPlayer{"carol", newSignedStore(bob.store.(*signedStore).DocStore.(*memStore).withPeer("peer-c"))}
+
+	for _, w := range []struct {
+		db  string
+		doc any
+	}{
+		{dbRpsAccount, Account{ID: "peer-c", Username: carol.name}},
+		{dbRpsWallet, Balance{ID: carol.name, Amount: 1250}},
+		{dbRpsTransaction, Transaction{ID: "legacy", Username: carol.name, Type: TypeDebit, Amount: 1250, Timestamp: testNow}},
+	} {
+		docJSON, _ := json.Marshal(w.doc)
+		if err := carol.store.Put(w.db, docJSON); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := moveFunds(carol.store, carol.name, 100); err != nil {
+		t.Fatal(err)
+	}
+
+	openedMatch(t, carol, bob, "cccccccc-cccc-cccc-cccc-ccccccccccc1", 300)
+
+	opening, err := getOpening(carol.store, carol.name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transactionsJSON, err := carol.store.Query(dbRpsTransaction, "username", carol.name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var transactions []Transaction
+
+	if err := json.Unmarshal(transactionsJSON, &transactions); err != nil {
+		t.Fatal(err)
+	}
+
+	got := balances(newStatement(opening, transactions))
+
+	if want := []int{1050, 1350, 1250}; !reflect.DeepEqual(got, want) || balanceOf(t, carol.store, carol.name) != want[0] {
+		t.Fatalf("balances %v, want %v", got, want)
+	}
+}
+
+func TestFilterStatement(t *testing.T) {
+	rows := newStatement(Posting{}, []Transaction{
+		{ID: "t1", Type: TypeDebit, Kind: KindDeposit, Amount: 500, Timestamp: day(1)},
+		{ID: "t2", Type: TypeCredit, Kind: KindStake, Amount: 200, Timestamp: day(2)},
+		{ID: "t3", Type: TypeDebit, Kind: KindPayout, Amount: 400, Timestamp: day(3)},
+		{ID: "t4", Type: TypeDebit, Amount: 100, Timestamp: day(4)},
+	})
+
+	tests := []struct {
+		name   string
+		filter TransactionFilter
+		ids    []string
+	}{
+		{"everything", TransactionFilter{}, []string{"t4", "t3", "t2", "t1"}},
+		{"from a day on", TransactionFilter{From: time.Date(2026, 1, 3, 0, 0, 0, 0, time.Local)}, []string{"t4", "t3"}},
+		{"up to a whole day", TransactionFilter{To: time.Date(2026, 1, 2, 0, 0, 0, 0, time.Local)}, []string{"t2", "t1"}},
+		{"a single day", TransactionFilter{From: time.Date(2026, 1, 3, 0, 0, 0, 0, time.Local), To: time.Date(2026, 1, 3, 0, 0, 0, 0, time.Local)}, []string{"t3"}},
+		{"a kind", TransactionFilter{Kind: string(KindStake)}, []string{"t2"}},
+		{"the type of a legacy transaction", TransactionFilter{Kind: string(TypeDebit)}, []string{"t4"}},
+		{"nothing", TransactionFilter{Kind: string(KindPrize)}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filtered := filterStatement(rows, tt.filter)
+
+			if got := ids(filtered); !reflect.DeepEqual(got, tt.ids) {
+				t.Fatalf("rows %v, want %v", got, tt.ids)
+			}
+
+			// filtering keeps the balance of the whole statement
+			for _, r := range filtered {
+				for _, all := range rows {
+					if r.ID == all.ID && r.Balance != all.Balance {
+						t.Fatalf("%s has balance %d, %d in the statement", r.ID, r.Balance, all.Balance)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestPageRows(t *testing.T) {
+	var transactions []Transaction
+
+	for i := 0; i < 2*transactionsPerPage+5; i++ {
+		transactions = append(transactions, Transaction{ID: fmt.Sprint(i), Type: TypeDebit, Amount: 1, Timestamp: day(1).Add(time.Duration(i) * time.Minute)})
+	}
+
+	rows := newStatement(Posting{}, transactions)
+
+	tests := []struct {
+		page  int
+		len   int
+		first string
+	}{
+		{0, transactionsPerPage, fmt.Sprint(2*transactionsPerPage + 4)},
+		{1, transactionsPerPage, fmt.Sprint(transactionsPerPage + 4)},
+		{2, 5, "4"},
+		{3, 0, ""},
+	}
+
+	for _, tt := range tests {
+		page := (&transaction{page: tt.page}).pageRows(rows)
+
+		if len(page) != tt.len {
+			t.Fatalf("page %d has %d rows, want %d", tt.page, len(page), tt.len)
+		}
+
+		if len(page) > 0 && page[0].ID != tt.first {
+			t.Fatalf("page %d starts at %s, want %s", tt.page, page[0].ID, tt.first)
+		}
+	}
+}
+
+func TestParseDay(t *testing.T) {
+	tests := []struct {
+		day     string
+		want    time.Time
+		wantErr bool
+	}{
+		{"", time.Time{}, false},
+		{"2026-01-02", time.Date(2026, 1, 2, 0, 0, 0, 0, time.Local), false},
+		{"02/01/2026", time.Time{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseDay(tt.day)
+
+		if (err != nil) != tt.wantErr || !got.Equal(tt.want) {
+			t.Fatalf("parseDay(%q) = %v, %v", tt.day, got, err)
+		}
+	}
+}
+
+func TestStatementCSV(t *testing.T) {
+	rows := newStatement(Posting{Debit: walletAccount("alice"), Credit: accountOpening, Amount: 1000}, []Transaction{
+		{ID: "t1", Type: TypeCredit, Kind: KindStake, Amount: 250, Timestamp: time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC), MatchID: "m1", Counterparty: "bob"},
+		{ID: "t2", Type: TypeDebit, Amount: 5, Timestamp: time.Date(2026, 1, 3, 15, 4, 5, 0, time.UTC), TournamentID: "t,1"},
+	})
+
+	tests := []struct {
+		name string
+		rows []StatementRow
+		want string
+	}{
+		{"no rows", nil, "id,timestamp,kind,type,amount,balance,match_id,counterparty,tournament_id\n"},
+		{"rows", rows, "id,timestamp,kind,type,amount,balance,match_id,counterparty,tournament_id\n" +
+			"t2,2026-01-03T15:04:05Z,debit,debit,0.05,7.55,,,\"t,1\"\n" +
+			"t1,2026-01-02T15:04:05Z,stake,credit,-2.50,7.50,m1,bob,\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := statementCSV(tt.rows)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(got) != tt.want {
+				t.Fatalf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStatementJSON(t *testing.T) {
+	rows := newStatement(Posting{}, []Transaction{
+		{ID: "t1", Type: TypeDebit, Kind: KindDeposit, Amount: 500, Timestamp: day(1)},
+	})
+
+	tests := []struct {
+		name string
+		rows []StatementRow
+		want []map[string]any
+	}{
+		{"no rows", nil, []map[string]any{}},
+		{"rows", rows, []map[string]any{{"_id": "t1", "kind": "deposit", "type": "debit", "amount": 500.0, "balance": 500.0}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := statementJSON(tt.rows)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !strings.HasPrefix(string(got), "[") {
+				t.Fatalf("not an array: %s", got)
+			}
+
+			var decoded []map[string]any
+
+			if err := json.Unmarshal(got, &decoded); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(decoded) != len(tt.want) {
+				t.Fatalf("%d rows, want %d", len(decoded), len(tt.want))
+			}
+
+			for i, fields := range tt.want {
+				for k, v := range fields {
+					if decoded[i][k] != v {
+						t.Fatalf("row %d has %s %v, want %v", i, k, decoded[i][k], v)
+					}
+				}
+			}
+		})
+	}
+}
@@ -5,13 +5,13 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/mar1n3r0/rps/engine"
 	"github.com/maxence-charriere/go-app/v10/pkg/app"
-	shell "github.com/stateless-minds/go-ipfs-api"
 )
 
 type stats struct {
 	app.Compo
-	sh              *shell.Shell
+	store           DocStore
 	myPeerID        string
 	playerName      string
 	wins            int
@@ -29,16 +29,15 @@ func (s *stats) OnMount(ctx app.Context) {
 		return
 	}
 
-	sh := shell.NewShell("localhost:5001")
-	s.sh = sh
+	s.store = newDocStore()
 
-	myPeer, err := s.sh.ID()
+	myPeerID, err := s.store.PeerID()
 	if err != nil {
 		ctx.Navigate("/")
 		return
 	}
 
-	s.myPeerID = myPeer.ID
+	s.myPeerID = myPeerID
 
 	ctx.GetState("playerName", &s.playerName)
 
@@ -58,7 +57,7 @@ func (s *stats) OnNav(ctx app.Context) {
 }
 
 func (s *stats) getChallengesWins(ctx app.Context) {
-	challengesJSON, err := s.sh.OrbitDocsQuery(dbRpsChallenge, "winner", s.playerName)
+	challengesJSON, err := s.store.Query(dbRpsChallenge, "winner", s.playerName)
 	if err != nil {
 		ctx.Notifications().New(app.Notification{
 			Title: "Error",
@@ -68,7 +67,7 @@ func (s *stats) getChallengesWins(ctx app.Context) {
 	}
 
 	if strings.TrimSpace(string(challengesJSON)) != "null" && len(challengesJSON) > 0 {
-		var challenges []Match
+		var challenges []engine.Match
 
 		err = json.Unmarshal(challengesJSON, &challenges)
 		if err != nil {
@@ -92,7 +91,7 @@ func (s *stats) getChallengesWins(ctx app.Context) {
 }
 
 func (s *stats) getChallengesLosses(ctx app.Context) {
-	challengesJSON, err := s.sh.OrbitDocsQuery(dbRpsChallenge, "loser", s.playerName)
+	challengesJSON, err := s.store.Query(dbRpsChallenge, "loser", s.playerName)
 	if err != nil {
 		ctx.Notifications().New(app.Notification{
 			Title: "Error",
@@ -102,7 +101,7 @@ func (s *stats) getChallengesLosses(ctx app.Context) {
 	}
 
 	if strings.TrimSpace(string(challengesJSON)) != "null" && len(challengesJSON) > 0 {
-		var challenges []Match
+		var challenges []engine.Match
 
 		err = json.Unmarshal(challengesJSON, &challenges)
 		if err != nil {
@@ -126,7 +125,7 @@ func (s *stats) getChallengesLosses(ctx app.Context) {
 }
 
 func (s *stats) getChallengesDraws(ctx app.Context) {
-	challengesJSON, err := s.sh.OrbitDocsQuery(dbRpsChallenge, "status", string(StatusDraw))
+	challengesJSON, err := s.store.Query(dbRpsChallenge, "status", string(engine.StatusDraw))
 	if err != nil {
 		ctx.Notifications().New(app.Notification{
 			Title: "Error",
@@ -136,7 +135,7 @@ func (s *stats) getChallengesDraws(ctx app.Context) {
 	}
 
 	if strings.TrimSpace(string(challengesJSON)) != "null" && len(challengesJSON) > 0 {
-		var challenges []Match
+		var challenges []engine.Match
 
 		err = json.Unmarshal(challengesJSON, &challenges)
 		if err != nil {
@@ -148,7 +147,7 @@ func (s *stats) getChallengesDraws(ctx app.Context) {
 		}
 
 		for _, cc := range challenges {
-			if cc.Host.Username == s.playerName || cc.Opponent.Username == s.playerName {
+			if cc.Plays(s.playerName) {
 				s.draws++
 			}
 		}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"mime/multipart"
+	"sync"
+
+	"github.com/maxence-charriere/go-app/v10/pkg/app"
+	shell "github.com/stateless-minds/go-ipfs-api"
+)
+
+// defaultIPFSAPIAddr is the API address of the Kubo daemon the app talks to
+// unless told otherwise, see ipfsAPIAddr.
+const defaultIPFSAPIAddr = "localhost:5001"
+
+// ipfsAPIAddrKey is the local storage key the API address is kept under.
+const ipfsAPIAddrKey = "ipfs-api"
+
+// ipfsAPIAddr returns the API address of the Kubo daemon to use. Opening the
+// app with ?api=host:port points it at another daemon, so that several
+// players can test on one machine with a daemon each; the address is kept in
+// the local storage of the browser until another one is given.
+func ipfsAPIAddr() string {
+	if !app.IsClient {
+		return defaultIPFSAPIAddr
+	}
+
+	storage := app.Window().Get("localStorage")
+
+	if addr := app.Window().URL().Query().Get("api"); addr != "" {
+		storage.Call("setItem", ipfsAPIAddrKey, addr)
+		return addr
+	}
+
+	if addr := storage.Call("getItem", ipfsAPIAddrKey); addr.Truthy() {
+		return addr.String()
+	}
+
+	return defaultIPFSAPIAddr
+}
+
+// DocStore is the document database every component reads and writes game
+// state through. Collections are addressed by name (rps_account, rps_wallet,
+// rps_challenge, ...) and documents are keyed by their "_id" field.
+//
+// Get and Query return a JSON array of the matching documents or the literal
+// null when nothing matches. Query with the field "all" returns every
+// document of the collection. Put inserts or replaces the document with the
+// same "_id", and Delete with the id "all" empties the collection.
+type DocStore interface {
+	Get(db, id string) ([]byte, error)
+	Query(db, field, value string) ([]byte, error)
+	Put(db string, doc []byte) error
+	Delete(db, id string) error
+	// PeerID returns the ID of the peer the store writes as.
+	PeerID() (string, error)
+	// Sign signs data with the key of the peer and Verify checks that
+	// signature was made over data by the key of peerID.
+	Sign(data []byte) (string, error)
+	Verify(peerID string, data []byte, signature string) (bool, error)
+}
+
+// newDocStore returns the store components use. It is a variable so that a
+// different backend can be swapped in without touching the components. All
+// components share one store, so the accounts it verified are verified once.
+var newDocStore = func() DocStore {
+	docStoreOnce.Do(func() {
+		docStore = newSignedStore(newShellStore(ipfsAPIAddr()))
+	})
+
+	return docStore
+}
+
+var (
+	docStoreOnce sync.Once
+	docStore     DocStore
+)
+
+// shellStore is a DocStore backed by the OrbitDB docstores of a local Kubo
+// daemon, reached through its HTTP API.
+type shellStore struct {
+	sh *shell.Shell
+}
+
+func newShellStore(addr string) *shellStore {
+	return &shellStore{
+		sh: shell.NewShell(addr),
+	}
+}
+
+func (s *shellStore) Get(db, id string) ([]byte, error) {
+	return s.sh.OrbitDocsGet(db, id)
+}
+
+func (s *shellStore) Query(db, field, value string) ([]byte, error) {
+	return s.sh.OrbitDocsQuery(db, field, value)
+}
+
+func (s *shellStore) Put(db string, doc []byte) error {
+	return s.sh.OrbitDocsPut(db, doc)
+}
+
+func (s *shellStore) Delete(db, id string) error {
+	return s.sh.OrbitDocsDelete(db, id)
+}
+
+func (s *shellStore) PeerID() (string, error) {
+	myPeer, err := s.sh.ID()
+	if err != nil {
+		return "", err
+	}
+
+	return myPeer.ID, nil
+}
+
+// Sign signs data with the self key of the daemon, which is the key the
+// peer ID is derived from.
+func (s *shellStore) Sign(data []byte) (string, error) {
+	body, contentType, err := fileBody(data)
+	if err != nil {
+		return "", err
+	}
+
+	var out struct {
+		Signature string
+	}
+
+	err = s.sh.Request("key/sign").
+		Header("Content-Type", contentType).
+		Body(body).
+		Exec(context.Background(), &out)
+	if err != nil {
+		return "", err
+	}
+
+	return out.Signature, nil
+}
+
+func (s *shellStore) Verify(peerID string, data []byte, signature string) (bool, error) {
+	body, contentType, err := fileBody(data)
+	if err != nil {
+		return false, err
+	}
+
+	var out struct {
+		SignatureValid bool
+	}
+
+	err = s.sh.Request("key/verify").
+		Option("key", peerID).
+		Option("signature", signature).
+		Header("Content-Type", contentType).
+		Body(body).
+		Exec(context.Background(), &out)
+	if err != nil {
+		return false, err
+	}
+
+	return out.SignatureValid, nil
+}
+
+// fileBody wraps data in the multipart form the daemon expects for commands
+// that take a file argument.
+func fileBody(data []byte) (*bytes.Buffer, string, error) {
+	body := &bytes.Buffer{}
+	w := multipart.NewWriter(body)
+
+	part, err := w.CreateFormFile("file", "data")
+	if err != nil {
+		return nil, "", err
+	}
+
+	_, err = part.Write(data)
+	if err != nil {
+		return nil, "", err
+	}
+
+	err = w.Close()
+	if err != nil {
+		return nil, "", err
+	}
+
+	return body, w.FormDataContentType(), nil
+}
@@ -0,0 +1,578 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mar1n3r0/rps/engine"
+)
+
+const dbRpsTournament = "rps_tournament"
+
+type TournamentStatus string
+
+const (
+	TournamentOpen      TournamentStatus = "open"
+	TournamentRunning   TournamentStatus = "running"
+	TournamentFinished  TournamentStatus = "finished"
+	TournamentCancelled TournamentStatus = "cancelled"
+)
+
+// Tournament pairs the players who signed up for it in a bracket or a round
+// robin. Each player pays the entry fee into the prize pool when signing up,
+// and the pool is paid out to the best placed players once every match is
+// played. The matches are ordinary matches played for nothing.
+type Tournament struct {
+	ID        string            `mapstructure:"_id" json:"_id" validate:"uuid_rfc4122"`               // ID
+	Name      string            `mapstructure:"name" json:"name" validate:"uuid_rfc4122"`             // Name
+	Organizer string            `mapstructure:"organizer" json:"organizer" validate:"uuid_rfc4122"`   // Username of the player who created it
+	Format    engine.Format     `mapstructure:"format" json:"format" validate:"uuid_rfc4122"`         // Format - single_elimination, round_robin
+	Mode      string            `mapstructure:"mode" json:"mode" validate:"uuid_rfc4122"`             // Game mode of the matches
+	BestOf    int               `mapstructure:"best_of" json:"best_of" validate:"uuid_rfc4122"`       // Rounds of each match
+	EntryFee  int               `mapstructure:"entry_fee" json:"entry_fee" validate:"uuid_rfc4122"`   // Entry fee in cents
+	Status    TournamentStatus  `mapstructure:"status" json:"status" validate:"uuid_rfc4122"`         // Status - open, running, finished, cancelled
+	Players   []string          `mapstructure:"players" json:"players" validate:"uuid_rfc4122"`       // Usernames in the order they signed up
+	Pairings  []engine.Pairing  `mapstructure:"pairings" json:"pairings" validate:"uuid_rfc4122"`     // Pairings of every round generated so far
+	Prizes    []TournamentPrize `mapstructure:"prizes" json:"prizes" validate:"uuid_rfc4122"`         // Prizes paid once finished
+	Version   int               `mapstructure:"version" json:"version" validate:"uuid_rfc4122"`       // Incremented on every write
+	CreatedAt time.Time         `mapstructure:"created_at" json:"created_at" validate:"uuid_rfc4122"` // CreatedAt
+}
+
+type TournamentPrize struct {
+	Username string `mapstructure:"username" json:"username" validate:"uuid_rfc4122"` // Username
+	Amount   int    `mapstructure:"amount" json:"amount" validate:"uuid_rfc4122"`     // Amount in cents
+}
+
+// Pool returns the prize pool made of the entry fees.
+func (t Tournament) Pool() int {
+	return t.EntryFee * len(t.Players)
+}
+
+// Joined reports whether username signed up for the tournament.
+func (t Tournament) Joined(username string) bool {
+	for _, p := range t.Players {
+		if p == username {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Round returns the last round paired so far.
+func (t Tournament) Round() int {
+	var round int
+
+	for _, p := range t.Pairings {
+		if p.Round > round {
+			round = p.Round
+		}
+	}
+
+	return round
+}
+
+// poolAccount is the ledger account that holds the entry fees of a
+// tournament until they are paid out as prizes.
+func poolAccount(tournamentID string) string {
+	return "tournament:" + tournamentID
+}
+
+// getTournament returns the tournament with id, or the zero Tournament when
+// there is none.
+func getTournament(store DocStore, id string) (Tournament, error) {
+	tournamentJSON, err := store.Get(dbRpsTournament, id)
+	if err != nil {
+		return Tournament{}, err
+	}
+
+	if strings.TrimSpace(string(tournamentJSON)) == "null" || len(tournamentJSON) == 0 {
+		return Tournament{}, nil
+	}
+
+	var tournaments []Tournament
+
+	err = json.Unmarshal(tournamentJSON, &tournaments)
+	if err != nil {
+		return Tournament{}, err
+	}
+
+	return tournaments[0], nil
+}
+
+// getTournaments returns every tournament, newest first.
+func getTournaments(store DocStore) ([]Tournament, error) {
+	tournamentsJSON, err := store.Query(dbRpsTournament, "all", "")
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.TrimSpace(string(tournamentsJSON)) == "null" || len(tournamentsJSON) == 0 {
+		return nil, nil
+	}
+
+	var tournaments []Tournament
+
+	err = json.Unmarshal(tournamentsJSON, &tournaments)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(tournaments, func(i, j int) bool {
+		return tournaments[i].CreatedAt.After(tournaments[j].CreatedAt)
+	})
+
+	return tournaments, nil
+}
+
+func newTournamentSettlement(store DocStore, tournamentID, owner string) *settlement {
+	s := newSettlement(store, "", owner)
+	s.journal.TournamentID = tournamentID
+
+	return s
+}
+
+// putTournament adds the write that saves t. It fails with errConflict when
+// the tournament was changed since t was read.
+func (s *settlement) putTournament(t Tournament) error {
+	current, err := getTournament(s.store, t.ID)
+	if err != nil {
+		return err
+	}
+
+	if current.Version != t.Version {
+		return fmt.Errorf("%w: tournament %s", errConflict, t.ID)
+	}
+
+	t.Version++
+
+	err = s.put(dbRpsTournament, t.ID, t)
+	if err != nil {
+		return err
+	}
+
+	// written first, the fees and prizes paid to other players are checked
+	// against the tournament they settle
+	last := len(s.journal.Writes) - 1
+	s.journal.Writes = append([]JournalWrite{s.journal.Writes[last]}, s.journal.Writes[:last]...)
+
+	return nil
+}
+
+// createTournament saves a new tournament open for sign-ups.
+func createTournament(store DocStore, organizer, name string, format engine.Format, mode engine.Mode, bestOf, entryFee int) (Tournament, error) {
+	if strings.TrimSpace(name) == "" {
+		return Tournament{}, errors.New("give the tournament a name")
+	}
+
+	if entryFee < 0 {
+		return Tournament{}, errors.New("the entry fee cannot be negative")
+	}
+
+	t := Tournament{
+		ID:        uuid.NewString(),
+		Name:      strings.TrimSpace(name),
+		Organizer: organizer,
+		Format:    format,
+		Mode:      string(mode),
+		BestOf:    bestOf,
+		EntryFee:  entryFee,
+		Status:    TournamentOpen,
+		CreatedAt: time.Now(),
+	}
+
+	s := newTournamentSettlement(store, t.ID, organizer)
+
+	err := s.putTournament(t)
+	if err != nil {
+		return Tournament{}, err
+	}
+
+	err = s.commit()
+	if err != nil {
+		return Tournament{}, err
+	}
+
+	t.Version++
+
+	return t, nil
+}
+
+// updateTournament applies update to the latest version of the tournament
+// with id and saves it along with the money update moves, starting over when
+// a concurrent write got in between. An error from update is returned as is.
+func updateTournament(store DocStore, id, owner string, update func(s *settlement, t Tournament) (Tournament, error)) (Tournament, error) {
+	var err error
+
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		var t Tournament
+
+		t, err = getTournament(store, id)
+		if err != nil {
+			return Tournament{}, err
+		}
+
+		if t.ID == "" {
+			return Tournament{}, fmt.Errorf("tournament %s not found", id)
+		}
+
+		s := newTournamentSettlement(store, id, owner)
+
+		t, err = update(s, t)
+		if err != nil {
+			return Tournament{}, err
+		}
+
+		err = s.putTournament(t)
+		if errors.Is(err, errConflict) {
+			continue
+		}
+
+		if err != nil {
+			return Tournament{}, err
+		}
+
+		err = s.commit()
+		if errors.Is(err, errConflict) {
+			continue
+		}
+
+		if err != nil {
+			return Tournament{}, err
+		}
+
+		t.Version++
+
+		return t, nil
+	}
+
+	return Tournament{}, err
+}
+
+// joinTournament signs username up for an open tournament and moves the
+// entry fee from their wallet into the prize pool.
+func joinTournament(store DocStore, id, username string) (Tournament, error) {
+	return updateTournament(store, id, username, func(s *settlement, t Tournament) (Tournament, error) {
+		if t.Status != TournamentOpen {
+			return Tournament{}, errors.New("the tournament is not open for sign-ups")
+		}
+
+		if t.Joined(username) {
+			return Tournament{}, errors.New("you already signed up for this tournament")
+		}
+
+		if t.EntryFee > 0 {
+			err := s.post(username, -t.EntryFee, poolAccount(t.ID), KindFee, "")
+			if err != nil {
+				return Tournament{}, err
+			}
+		}
+
+		t.Players = append(t.Players, username)
+
+		return t, nil
+	})
+}
+
+// cancelTournament calls off an open tournament on behalf of its organizer
+// and refunds the entry fees.
+func cancelTournament(store DocStore, id, username string) (Tournament, error) {
+	return updateTournament(store, id, username, func(s *settlement, t Tournament) (Tournament, error) {
+		if t.Organizer != username {
+			return Tournament{}, errors.New("only the organizer can cancel the tournament")
+		}
+
+		if t.Status != TournamentOpen {
+			return Tournament{}, errors.New("only a tournament that has not started can be cancelled")
+		}
+
+		if t.EntryFee > 0 {
+			for _, p := range t.Players {
+				err := s.post(p, t.EntryFee, poolAccount(t.ID), KindRefund, "")
+				if err != nil {
+					return Tournament{}, err
+				}
+			}
+		}
+
+		t.Status = TournamentCancelled
+
+		return t, nil
+	})
+}
+
+// startTournament closes the sign-ups and pairs the players for the first
+// round, or for every round of a round robin. The matches of the pairings
+// are created by their players, see advanceTournament.
+func startTournament(store DocStore, id, username string) (Tournament, error) {
+	return updateTournament(store, id, username, func(s *settlement, t Tournament) (Tournament, error) {
+		if t.Organizer != username {
+			return Tournament{}, errors.New("only the organizer can start the tournament")
+		}
+
+		if t.Status != TournamentOpen {
+			return Tournament{}, errors.New("the tournament has already started")
+		}
+
+		pairings, err := t.firstPairings()
+		if err != nil {
+			return Tournament{}, err
+		}
+
+		t.Pairings = withMatchIDs(pairings)
+		t.Status = TournamentRunning
+
+		return t, nil
+	})
+}
+
+// firstPairings returns the pairings the players of t start with: the
+// first round of a bracket, or every round of a round robin.
+func (t Tournament) firstPairings() ([]engine.Pairing, error) {
+	if t.Format == engine.FormatRoundRobin {
+		return engine.RoundRobin(t.Players)
+	}
+
+	return engine.Bracket(t.Players)
+}
+
+// withMatchIDs gives every pairing that is not a bye the ID of the match it
+// is played in, so that whichever of its players creates the match creates
+// the same one.
+func withMatchIDs(pairings []engine.Pairing) []engine.Pairing {
+	for i := range pairings {
+		if !pairings[i].Bye() {
+			pairings[i].MatchID = uuid.NewString()
+		}
+	}
+
+	return pairings
+}
+
+// advanceTournaments moves on every running tournament username plays in,
+// as of now.
+func advanceTournaments(store DocStore, username string, now time.Time) error {
+	tournaments, err := getTournaments(store)
+	if err != nil {
+		return err
+	}
+
+	for _, t := range tournaments {
+		if t.Status != TournamentRunning || !t.Joined(username) {
+			continue
+		}
+
+		_, err = advanceTournament(store, t, username, now)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// advanceTournament moves a running tournament on as far as its matches
+// allow, on behalf of username, one of its players. It creates the matches
+// of username's pairings that do not exist yet - a match is only accepted
+// from one of its players - forfeits the ones a player let the deadline
+// pass on, records the winners of the resolved ones, pairs the next round
+// of a bracket once a round is decided, and pays out the prizes once the
+// tournament is over. Deadlines are checked and new matches made as of now.
+func advanceTournament(store DocStore, t Tournament, username string, now time.Time) (Tournament, error) {
+	mode, err := engine.ParseMode(t.Mode)
+	if err != nil {
+		return Tournament{}, err
+	}
+
+	for _, p := range t.Pairings {
+		if p.Bye() || p.Winner != "" || (p.Host != username && p.Opponent != username) {
+			continue
+		}
+
+		m, err := getMatch(store, p.MatchID)
+		if err != nil {
+			return Tournament{}, err
+		}
+
+		// the player who did not move in time hands the other a walkover
+		if m.Overdue(now) {
+			_, err = forfeitMatch(store, m, username, now)
+			if err != nil && !errors.Is(err, errConflict) {
+				return Tournament{}, err
+			}
+
+			continue
+		}
+
+		if m.ID != "" {
+			continue
+		}
+
+		m, err = engine.Pair(p.MatchID, t.ID, mode, p, now, t.BestOf)
+		if err != nil {
+			return Tournament{}, err
+		}
+
+		_, err = saveMatch(store, m)
+		if err != nil && !errors.Is(err, errConflict) {
+			return Tournament{}, err
+		}
+	}
+
+	// a copy, the winners are recorded on the latest version below
+	probe := t
+	probe.Pairings = append([]engine.Pairing(nil), t.Pairings...)
+
+	changed, err := recordWinners(store, &probe)
+	if err != nil || !changed {
+		return t, err
+	}
+
+	return updateTournament(store, t.ID, username, func(s *settlement, t Tournament) (Tournament, error) {
+		if t.Status != TournamentRunning {
+			return t, nil
+		}
+
+		_, err := recordWinners(store, &t)
+		if err != nil {
+			return Tournament{}, err
+		}
+
+		if !engine.Decided(t.Pairings) {
+			return t, nil
+		}
+
+		if t.Format == engine.FormatSingleElimination {
+			next := engine.NextRound(t.Pairings, t.Round())
+			if len(next) > 0 {
+				t.Pairings = append(t.Pairings, withMatchIDs(next)...)
+				return t, nil
+			}
+		}
+
+		return finishTournament(s, t)
+	})
+}
+
+// recordWinners records the winner of every pairing of t whose match is
+// resolved, and reports whether it found any, or whether t can move on to
+// its next round or its end.
+func recordWinners(store DocStore, t *Tournament) (bool, error) {
+	var changed bool
+
+	for i, p := range t.Pairings {
+		if p.Winner != "" {
+			continue
+		}
+
+		m, err := getMatch(store, p.MatchID)
+		if err != nil {
+			return false, err
+		}
+
+		if m.Status == engine.StatusCompleted && m.Winner != "" {
+			t.Pairings[i].Winner = m.Winner
+			changed = true
+		}
+	}
+
+	return changed || engine.Decided(t.Pairings), nil
+}
+
+// checkResults returns an error unless the pairings of t are the ones its
+// format gives its players and every pairing decided, other than a bye, was
+// won in a resolved match of t between its two players. match returns the
+// match with an ID as its reader verified it. A tournament is written by
+// each of its players, so its pairings are only taken for what the matches
+// played in it say.
+func checkResults(t Tournament, match func(id string) (engine.Match, error)) error {
+	want, err := t.firstPairings()
+	if err != nil {
+		return err
+	}
+
+	if t.Format == engine.FormatSingleElimination {
+		for round := 1; round < t.Round(); round++ {
+			want = append(want, engine.NextRound(t.Pairings, round)...)
+		}
+	}
+
+	if len(t.Pairings) > len(want) {
+		return fmt.Errorf("tournament %s has %d pairings, its players make %d", t.ID, len(t.Pairings), len(want))
+	}
+
+	for i, p := range t.Pairings {
+		if p.Round != want[i].Round || p.Host != want[i].Host || p.Opponent != want[i].Opponent {
+			return fmt.Errorf("tournament %s pairs %s against %s in round %d", t.ID, p.Host, p.Opponent, p.Round)
+		}
+
+		if p.Winner == "" {
+			continue
+		}
+
+		if p.Bye() {
+			if p.Winner != p.Host {
+				return fmt.Errorf("bye of %s in tournament %s is won by %s", p.Host, t.ID, p.Winner)
+			}
+
+			continue
+		}
+
+		m, err := match(p.MatchID)
+		if err != nil {
+			return err
+		}
+
+		if m.ID != p.MatchID || m.TournamentID != t.ID || m.Status != engine.StatusCompleted || m.Winner != p.Winner ||
+			m.Host.Username != p.Host || m.Opponent.Username != p.Opponent {
+			return fmt.Errorf("match %s of tournament %s was not won by %s", p.MatchID, t.ID, p.Winner)
+		}
+	}
+
+	return nil
+}
+
+// finishTournament pays out the prize pool of a decided tournament, once its
+// results hold up against the matches played in it.
+func finishTournament(s *settlement, t Tournament) (Tournament, error) {
+	err := checkResults(t, func(id string) (engine.Match, error) {
+		return getMatch(s.store, id)
+	})
+	if err != nil {
+		return Tournament{}, err
+	}
+
+	placings := engine.Placings(t.Format, t.Players, t.Pairings)
+	prizes := engine.Prizes(t.Pool(), len(t.Players), placings)
+
+	t.Prizes = nil
+
+	// pay in the order of the placings so that the prizes read best first
+	for _, group := range placings {
+		for _, username := range group {
+			amount := prizes[username]
+			if amount <= 0 {
+				continue
+			}
+
+			err := s.post(username, amount, poolAccount(t.ID), KindPrize, "")
+			if err != nil {
+				return Tournament{}, err
+			}
+
+			t.Prizes = append(t.Prizes, TournamentPrize{
+				Username: username,
+				Amount:   amount,
+			})
+		}
+	}
+
+	t.Status = TournamentFinished
+
+	return t, nil
+}
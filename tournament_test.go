@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/mar1n3r0/rps/engine"
+)
+
+func TestTournamentWalkover(t *testing.T) {
+	players := newTestPlayers(t, 1000, "alice", "bob")
+	alice, bob := players[0], players[1]
+
+	tour, err := createTournament(alice.store, alice.name, "Cup", engine.FormatSingleElimination, engine.ModeClassic, 1, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range players {
+		if _, err := joinTournament(p.store, tour.ID, p.name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tour, err = startTournament(alice.store, tour.ID, alice.name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// bob creates the match of the final, alice never commits to it
+	if err := advanceTournaments(bob.store, bob.name, testNow); err != nil {
+		t.Fatal(err)
+	}
+
+	matchID := tour.Pairings[0].MatchID
+
+	m, err := getMatch(bob.store, matchID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.ID == "" || m.Overdue(testNow) {
+		t.Fatalf("match %+v", m)
+	}
+
+	// before the deadline the match is left to alice
+	if err := advanceTournaments(bob.store, bob.name, testNow.Add(engine.MoveWindow-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	if m, err = getMatch(alice.store, matchID); err != nil || m.Resolved() {
+		t.Fatalf("match %s before the deadline: %v", m.Status, err)
+	}
+
+	if err := advanceTournaments(bob.store, bob.name, testNow.Add(engine.MoveWindow)); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err = getMatch(alice.store, matchID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Winner != bob.name || m.Forfeit != alice.name {
+		t.Fatalf("won by %q, forfeited by %q", m.Winner, m.Forfeit)
+	}
+
+	tour, err = getTournament(alice.store, tour.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tour.Status != TournamentFinished || balanceOf(t, alice.store, bob.name) != 1100 {
+		t.Fatalf("tournament %s, bob has %d", tour.Status, balanceOf(t, alice.store, bob.name))
+	}
+}
+
+func TestTournamentForgedWinner(t *testing.T) {
+	players := newTestPlayers(t, 1000, "alice", "bob")
+	alice, bob := players[0], players[1]
+
+	tour, err := createTournament(alice.store, alice.name, "Cup", engine.FormatSingleElimination, engine.ModeClassic, 1, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range players {
+		if _, err := joinTournament(p.store, tour.ID, p.name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tour, err = startTournament(alice.store, tour.ID, alice.name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := advanceTournaments(bob.store, bob.name, testNow); err != nil {
+		t.Fatal(err)
+	}
+
+	// bob records a win in the final nobody played
+	forged := tour
+	forged.Pairings = append([]engine.Pairing(nil), tour.Pairings...)
+	forged.Pairings[0].Winner = bob.name
+
+	forgedJSON, _ := json.Marshal(forged)
+	if err := bob.store.Put(dbRpsTournament, forgedJSON); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := advanceTournaments(bob.store, bob.name, testNow); err == nil {
+		t.Fatal("prizes paid for a final nobody played")
+	}
+
+	if got := balanceOf(t, alice.store, bob.name); got != 900 {
+		t.Fatalf("bob has %d", got)
+	}
+
+	// nor does the ledger take a prize bob pays out of the pool
+	forged.Status = TournamentFinished
+
+	forgedJSON, _ = json.Marshal(forged)
+	if err := bob.store.Put(dbRpsTournament, forgedJSON); err != nil {
+		t.Fatal(err)
+	}
+
+	prizeJSON, _ := json.Marshal(newPosting(walletAccount(bob.name), poolAccount(tour.ID), 200, KindPrize, ""))
+	if err := bob.store.Put(dbRpsLedger, prizeJSON); err != nil {
+		t.Fatal(err)
+	}
+
+	ledger, err := ledgerBalance(alice.store, walletAccount(bob.name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ledger != 900 {
+		t.Fatalf("bob has %d on the ledger", ledger)
+	}
+}
@@ -0,0 +1,421 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mar1n3r0/rps/engine"
+	"github.com/maxence-charriere/go-app/v10/pkg/app"
+)
+
+type tournaments struct {
+	app.Compo
+	store       DocStore
+	myPeerID    string
+	playerName  string
+	tournaments []Tournament
+	selected    string // ID of the tournament whose details are shown
+	name        string
+	format      engine.Format
+	mode        engine.Mode
+	bestOf      int
+	entryFee    float32
+}
+
+func (t *tournaments) OnMount(ctx app.Context) {
+	var loggedIn bool
+	ctx.GetState("loggedIn", &loggedIn)
+	if !loggedIn {
+		ctx.Navigate("/")
+		return
+	}
+
+	t.store = newDocStore()
+
+	myPeerID, err := t.store.PeerID()
+	if err != nil {
+		ctx.Navigate("/")
+		return
+	}
+
+	t.myPeerID = myPeerID
+
+	ctx.GetState("playerName", &t.playerName)
+
+	t.format = engine.FormatSingleElimination
+	t.mode = engine.ModeClassic
+	t.bestOf = 1
+
+	t.getTournaments(ctx)
+}
+
+func (t *tournaments) OnNav(ctx app.Context) {
+	url := ctx.Page().URL().Path
+	path := strings.ReplaceAll(url, "/", "")
+	linkElName := "link-" + path
+
+	if !app.Window().GetElementByID(linkElName).IsNull() && !app.Window().GetElementByID(linkElName).IsNaN() && !app.Window().GetElementByID(linkElName).IsUndefined() {
+		app.Window().GetElementByID(linkElName).Get("classList").Call("toggle", "active")
+	}
+}
+
+func (t *tournaments) getTournaments(ctx app.Context) {
+	ctx.Async(func() {
+		// pair the next rounds and pay out the tournaments that are over
+		err := advanceTournaments(t.store, t.playerName, time.Now())
+		if err != nil {
+			ctx.Notifications().New(app.Notification{
+				Title: "Error",
+				Body:  err.Error(),
+			})
+		}
+
+		tournaments, err := getTournaments(t.store)
+		if err != nil {
+			ctx.Notifications().New(app.Notification{
+				Title: "Error",
+				Body:  err.Error(),
+			})
+			return
+		}
+
+		ctx.Dispatch(func(ctx app.Context) {
+			t.tournaments = tournaments
+		})
+	})
+}
+
+// The Render method is where the component appearance is defined.
+func (t *tournaments) Render() app.UI {
+	return app.Div().
+		Class("container").
+		Body(
+			newNav(),
+			app.Div().ID("main").Body(
+				t.renderCreate(),
+				app.Table().Body(
+					app.TBody().Body(
+						app.Tr().Body(
+							app.Td().ID("table-header").Text("Tournaments").ColSpan(7),
+						),
+						app.Tr().Body(
+							app.Td().Text("Name"),
+							app.Td().Text("Format"),
+							app.Td().Text("Entry Fee"),
+							app.Td().Text("Players"),
+							app.Td().Text("Prize Pool"),
+							app.Td().Text("Status"),
+							app.Td().Text(""),
+						),
+						app.Range(t.tournaments).Slice(func(i int) app.UI {
+							tt := t.tournaments[i]
+
+							return app.Tr().Body(
+								app.Td().Text(tt.Name),
+								app.Td().Text(tt.Format.Title()+", "+modeTitle(tt.Mode)+matchLength(tt.BestOf)),
+								app.Td().Text(formatStake(tt.EntryFee)),
+								app.Td().Text(len(tt.Players)),
+								app.Td().Text(formatStake(tt.Pool())),
+								app.Td().Text(string(tt.Status)),
+								app.Td().Body(
+									app.If(tt.Status == TournamentOpen && !tt.Joined(t.playerName), func() app.UI {
+										return app.Button().
+											Class("challenge-btn").
+											Text("Join").
+											Value(tt.ID).
+											OnClick(t.joinTournament)
+									}),
+									app.If(tt.Status == TournamentOpen && tt.Organizer == t.playerName, func() app.UI {
+										return app.Div().Body(
+											app.Button().
+												Class("challenge-btn").
+												Text("Start").
+												Value(tt.ID).
+												OnClick(t.startTournament),
+											app.Button().
+												Class("challenge-btn").
+												Text("Cancel").
+												Value(tt.ID).
+												OnClick(t.cancelTournament),
+										)
+									}),
+									app.Button().
+										Class("challenge-btn").
+										Text("Details").
+										Value(tt.ID).
+										OnClick(t.selectTournament),
+								),
+							)
+						}),
+					),
+				),
+				app.Range(t.tournaments).Slice(func(i int) app.UI {
+					if t.tournaments[i].ID != t.selected {
+						return nil
+					}
+
+					return t.renderDetails(t.tournaments[i])
+				}),
+			),
+		)
+}
+
+// renderCreate renders the form a player creates a tournament with.
+func (t *tournaments) renderCreate() app.UI {
+	return app.Div().ID("tournament-create").Body(
+		app.Input().
+			ID("tournament-name").
+			Type("text").
+			Placeholder("Tournament name").
+			OnChange(t.ValueTo(&t.name)),
+		app.Select().
+			ID("tournament-format").
+			OnChange(t.selectFormat).
+			Body(
+				app.Range(engine.Formats()).Slice(func(i int) app.UI {
+					format := engine.Formats()[i]
+					return app.Option().
+						Value(string(format)).
+						Selected(format == t.format).
+						Text(format.Title())
+				}),
+			),
+		app.Select().
+			ID("tournament-mode").
+			OnChange(t.selectMode).
+			Body(
+				app.Range(engine.Modes()).Slice(func(i int) app.UI {
+					mode := engine.Modes()[i]
+					return app.Option().
+						Value(string(mode)).
+						Selected(mode == t.mode).
+						Text(mode.Title())
+				}),
+			),
+		app.Select().
+			ID("tournament-best-of").
+			OnChange(t.selectBestOf).
+			Body(
+				app.Range(seriesLengths).Slice(func(i int) app.UI {
+					return app.Option().
+						Value(strconv.Itoa(seriesLengths[i].bestOf)).
+						Selected(seriesLengths[i].bestOf == t.bestOf).
+						Text(seriesLengths[i].title)
+				}),
+			),
+		app.Input().
+			ID("tournament-fee").
+			Type("number").
+			Min(0).
+			Step(0.1).
+			Placeholder("Entry fee").
+			OnChange(t.ValueTo(&t.entryFee)),
+		app.Button().
+			ID("tournament-create-btn").
+			Text("Create Tournament").
+			OnClick(t.createTournament),
+	)
+}
+
+// renderDetails renders the players, the pairings of every round and the
+// prizes of a tournament.
+func (t *tournaments) renderDetails(tt Tournament) app.UI {
+	return app.Table().Body(
+		app.TBody().Body(
+			app.Tr().Body(
+				app.Td().ID("table-header").Text(tt.Name).ColSpan(4),
+			),
+			app.Tr().Body(
+				app.Td().Text("Players"),
+				app.Td().ColSpan(3).Text(strings.Join(tt.Players, ", ")),
+			),
+			app.Tr().Body(
+				app.Td().Text("Round"),
+				app.Td().Text("Host"),
+				app.Td().Text("Opponent"),
+				app.Td().Text("Winner"),
+			),
+			app.Range(tt.Pairings).Slice(func(i int) app.UI {
+				p := tt.Pairings[i]
+
+				return app.Tr().Body(
+					app.Td().Text(p.Round),
+					app.Td().Text(p.Host),
+					app.If(p.Bye(), func() app.UI {
+						return app.Td().Text("Bye")
+					}).Else(func() app.UI {
+						return app.Td().Text(p.Opponent)
+					}),
+					app.If(p.Winner == "" && !p.Bye(), func() app.UI {
+						return app.Td().Body(
+							app.A().Href("/match/" + p.MatchID).Text("Not played yet"),
+						)
+					}).ElseIf(!p.Bye(), func() app.UI {
+						return app.Td().Body(
+							app.A().Href("/match/" + p.MatchID).Text(p.Winner),
+						)
+					}).Else(func() app.UI {
+						return app.Td().Text(p.Winner)
+					}),
+				)
+			}),
+			app.Range(tt.Prizes).Slice(func(i int) app.UI {
+				return app.Tr().Body(
+					app.Td().Text("Prize"),
+					app.Td().ColSpan(2).Text(tt.Prizes[i].Username),
+					app.Td().Text(formatStake(tt.Prizes[i].Amount)),
+				)
+			}),
+		),
+	)
+}
+
+func modeTitle(m string) string {
+	mode, err := engine.ParseMode(m)
+	if err != nil {
+		return m
+	}
+
+	return mode.Title()
+}
+
+func matchLength(bestOf int) string {
+	if bestOf <= 1 {
+		return ""
+	}
+
+	return ", best of " + strconv.Itoa(bestOf)
+}
+
+func (t *tournaments) selectFormat(ctx app.Context, e app.Event) {
+	format, err := engine.ParseFormat(ctx.JSSrc().Get("value").String())
+	if err != nil {
+		ctx.Notifications().New(app.Notification{
+			Title: "Error",
+			Body:  err.Error(),
+		})
+		return
+	}
+
+	t.format = format
+}
+
+func (t *tournaments) selectMode(ctx app.Context, e app.Event) {
+	mode, err := engine.ParseMode(ctx.JSSrc().Get("value").String())
+	if err != nil {
+		ctx.Notifications().New(app.Notification{
+			Title: "Error",
+			Body:  err.Error(),
+		})
+		return
+	}
+
+	t.mode = mode
+}
+
+func (t *tournaments) selectBestOf(ctx app.Context, e app.Event) {
+	bestOf, err := strconv.Atoi(ctx.JSSrc().Get("value").String())
+	if err != nil {
+		ctx.Notifications().New(app.Notification{
+			Title: "Error",
+			Body:  err.Error(),
+		})
+		return
+	}
+
+	t.bestOf = bestOf
+}
+
+func (t *tournaments) selectTournament(ctx app.Context, e app.Event) {
+	id := ctx.JSSrc().Get("value").String()
+
+	if t.selected == id {
+		t.selected = ""
+		return
+	}
+
+	t.selected = id
+}
+
+func (t *tournaments) createTournament(ctx app.Context, e app.Event) {
+	entryFee := int(math.Round(float64(t.entryFee) * 100))
+
+	ctx.Async(func() {
+		created, err := createTournament(t.store, t.playerName, t.name, t.format, t.mode, t.bestOf, entryFee)
+		if err != nil {
+			ctx.Notifications().New(app.Notification{
+				Title: "Error",
+				Body:  err.Error(),
+			})
+			return
+		}
+
+		ctx.Dispatch(func(ctx app.Context) {
+			t.tournaments = append([]Tournament{created}, t.tournaments...)
+
+			ctx.Notifications().New(app.Notification{
+				Title: "Success",
+				Body:  "Tournament " + created.Name + " created. Players can join until you start it.",
+			})
+		})
+	})
+}
+
+func (t *tournaments) joinTournament(ctx app.Context, e app.Event) {
+	id := ctx.JSSrc().Get("value").String()
+
+	t.updateTournament(ctx, id, "You joined the tournament.", joinTournament)
+}
+
+func (t *tournaments) startTournament(ctx app.Context, e app.Event) {
+	id := ctx.JSSrc().Get("value").String()
+
+	t.updateTournament(ctx, id, "The tournament has started. The matches are on the challenges page of their players.", startTournament)
+}
+
+func (t *tournaments) cancelTournament(ctx app.Context, e app.Event) {
+	id := ctx.JSSrc().Get("value").String()
+
+	t.updateTournament(ctx, id, "The tournament is cancelled and the entry fees refunded.", cancelTournament)
+}
+
+// updateTournament runs one of the tournament operations on behalf of the
+// player and shows the tournament as it left it.
+func (t *tournaments) updateTournament(ctx app.Context, id, success string, op func(store DocStore, id, username string) (Tournament, error)) {
+	ctx.Async(func() {
+		updated, err := op(t.store, id, t.playerName)
+		if err != nil {
+			ctx.Notifications().New(app.Notification{
+				Title: "Error",
+				Body:  err.Error(),
+			})
+			return
+		}
+
+		if updated.Status == TournamentRunning && updated.Joined(t.playerName) {
+			updated, err = advanceTournament(t.store, updated, t.playerName, time.Now())
+			if err != nil {
+				ctx.Notifications().New(app.Notification{
+					Title: "Error",
+					Body:  err.Error(),
+				})
+				return
+			}
+		}
+
+		ctx.Dispatch(func(ctx app.Context) {
+			for i, tt := range t.tournaments {
+				if tt.ID == updated.ID {
+					t.tournaments[i] = updated
+				}
+			}
+
+			ctx.Notifications().New(app.Notification{
+				Title: "Success",
+				Body:  success,
+			})
+		})
+	})
+}
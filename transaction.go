@@ -2,13 +2,11 @@ package main
 
 import (
 	"encoding/json"
-	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/maxence-charriere/go-app/v10/pkg/app"
-	shell "github.com/stateless-minds/go-ipfs-api"
 )
 
 const dbRpsTransaction = "rps_transaction"
@@ -20,20 +18,77 @@ const (
 	TypeCredit TransactionType = "credit"
 )
 
+// TransactionKind tells what a transaction was for. The type only tells
+// whether money went in or out of the wallet.
+type TransactionKind string
+
+const (
+	KindDeposit    TransactionKind = "deposit"
+	KindWithdrawal TransactionKind = "withdrawal"
+	KindStake      TransactionKind = "stake"
+	KindPayout     TransactionKind = "payout"
+	KindRefund     TransactionKind = "refund"
+	KindFee        TransactionKind = "fee"
+	KindPrize      TransactionKind = "prize"
+	KindAdjustment TransactionKind = "adjustment"
+)
+
+// transactionsPerPage is how many transactions a page of the table shows.
+const transactionsPerPage = 20
+
+// transactionKinds lists the kinds the transactions page filters by.
+var transactionKinds = []TransactionKind{
+	KindDeposit,
+	KindWithdrawal,
+	KindStake,
+	KindPayout,
+	KindRefund,
+	KindFee,
+	KindPrize,
+	KindAdjustment,
+}
+
 type transaction struct {
 	app.Compo
-	sh           *shell.Shell
-	myPeerID     string
-	playerName   string
-	transactions []Transaction
+	store      DocStore
+	myPeerID   string
+	playerName string
+	rows       []StatementRow // all transactions, newest first
+	filter     TransactionFilter
+	page       int
 }
 
 type Transaction struct {
-	ID        string          `mapstructure:"_id" json:"_id" validate:"uuid_rfc4122"`             // ID
-	Username  string          `mapstructure:"username" json:"username" validate:"uuid_rfc4122"`   // Username
-	Type      TransactionType `mapstructure:"type" json:"type" validate:"uuid_rfc4122"`           // Type
-	Amount    int             `mapstructure:"amount" json:"amount" validate:"uuid_rfc4122"`       // Amount
-	Timestamp time.Time       `mapstructure:"timestamp" json:"timestamp" validate:"uuid_rfc4122"` // Timestamp
+	ID           string          `mapstructure:"_id" json:"_id" validate:"uuid_rfc4122"`                               // ID
+	Username     string          `mapstructure:"username" json:"username" validate:"uuid_rfc4122"`                     // Username
+	Type         TransactionType `mapstructure:"type" json:"type" validate:"uuid_rfc4122"`                             // Type
+	Amount       int             `mapstructure:"amount" json:"amount" validate:"uuid_rfc4122"`                         // Amount
+	Timestamp    time.Time       `mapstructure:"timestamp" json:"timestamp" validate:"uuid_rfc4122"`                   // Timestamp
+	Signer       string          `mapstructure:"signer" json:"signer,omitempty" validate:"uuid_rfc4122"`               // Peer that signed the transaction
+	Kind         TransactionKind `mapstructure:"kind" json:"kind,omitempty" validate:"uuid_rfc4122"`                   // Kind - deposit, withdrawal, stake, payout, refund, fee, prize, adjustment
+	MatchID      string          `mapstructure:"match_id" json:"match_id,omitempty" validate:"uuid_rfc4122"`           // Match the transaction belongs to
+	Counterparty string          `mapstructure:"counterparty" json:"counterparty,omitempty" validate:"uuid_rfc4122"`   // Other player of the match
+	TournamentID string          `mapstructure:"tournament_id" json:"tournament_id,omitempty" validate:"uuid_rfc4122"` // Tournament the entry fee or prize belongs to
+}
+
+// Label returns the kind of the transaction, or its type for transactions
+// written before kinds were recorded.
+func (t Transaction) Label() string {
+	if t.Kind != "" {
+		return string(t.Kind)
+	}
+
+	return string(t.Type)
+}
+
+// SignedAmount returns the amount as it changed the balance, negative when
+// money left the wallet.
+func (t Transaction) SignedAmount() int {
+	if t.Type == TypeCredit {
+		return -t.Amount
+	}
+
+	return t.Amount
 }
 
 func (t *transaction) OnMount(ctx app.Context) {
@@ -44,16 +99,15 @@ func (t *transaction) OnMount(ctx app.Context) {
 		return
 	}
 
-	sh := shell.NewShell("localhost:5001")
-	t.sh = sh
+	t.store = newDocStore()
 
-	myPeer, err := t.sh.ID()
+	myPeerID, err := t.store.PeerID()
 	if err != nil {
 		ctx.Navigate("/")
 		return
 	}
 
-	t.myPeerID = myPeer.ID
+	t.myPeerID = myPeerID
 
 	ctx.GetState("playerName", &t.playerName)
 
@@ -72,7 +126,16 @@ func (t *transaction) OnNav(ctx app.Context) {
 
 func (t *transaction) getTransactions(ctx app.Context) {
 	ctx.Async(func() {
-		transactionsJSON, err := t.sh.OrbitDocsQuery(dbRpsTransaction, "username", t.playerName)
+		transactionsJSON, err := t.store.Query(dbRpsTransaction, "username", t.playerName)
+		if err != nil {
+			ctx.Notifications().New(app.Notification{
+				Title: "Error",
+				Body:  err.Error(),
+			})
+			return
+		}
+
+		opening, err := getOpening(t.store, t.playerName)
 		if err != nil {
 			ctx.Notifications().New(app.Notification{
 				Title: "Error",
@@ -94,12 +157,7 @@ func (t *transaction) getTransactions(ctx app.Context) {
 			}
 
 			ctx.Dispatch(func(ctx app.Context) {
-				t.transactions = transactions
-
-				// Sorting slice by timestamp descending
-				sort.Slice(t.transactions, func(i, j int) bool {
-					return t.transactions[i].Timestamp.After(t.transactions[j].Timestamp)
-				})
+				t.rows = newStatement(opening, transactions)
 			})
 		}
 	})
@@ -107,33 +165,216 @@ func (t *transaction) getTransactions(ctx app.Context) {
 
 // The Render method is where the component appearance is defined.
 func (t *transaction) Render() app.UI {
+	rows := filterStatement(t.rows, t.filter)
+	pages := (len(rows) + transactionsPerPage - 1) / transactionsPerPage
+	page := t.pageRows(rows)
+
 	return app.Div().
 		Class("container").
 		Body(
 			newNav(),
 			app.Div().ID("main").Body(
+				app.Div().ID("transaction-filters").Body(
+					app.Label().For("filter-from").Text("From"),
+					app.Input().
+						ID("filter-from").
+						Type("date").
+						OnChange(t.setFrom),
+					app.Label().For("filter-to").Text("To"),
+					app.Input().
+						ID("filter-to").
+						Type("date").
+						OnChange(t.setTo),
+					app.Label().For("filter-kind").Text("Kind"),
+					app.Select().
+						ID("filter-kind").
+						OnChange(t.setKind).
+						Body(
+							app.Option().Value("").Selected(t.filter.Kind == "").Text("All"),
+							app.Range(transactionKinds).Slice(func(i int) app.UI {
+								kind := string(transactionKinds[i])
+								return app.Option().
+									Value(kind).
+									Selected(kind == t.filter.Kind).
+									Text(kind)
+							}),
+						),
+					app.Button().
+						ID("export-csv").
+						Text("Export CSV").
+						OnClick(t.exportCSV),
+					app.Button().
+						ID("export-json").
+						Text("Export JSON").
+						OnClick(t.exportJSON),
+				),
 				app.Table().Body(
 					app.TBody().Body(
 						app.Tr().Body(
-							app.Td().ID("table-header").Text("Transactions").ColSpan(3),
+							app.Td().ID("table-header").Text("Transactions").ColSpan(8),
 						),
 						app.Tr().Body(
 							app.Td().Text("ID"),
-							app.Td().Text("Type"),
+							app.Td().Text("Kind"),
 							app.Td().Text("Amount"),
+							app.Td().Text("Balance"),
+							app.Td().Text("Match"),
+							app.Td().Text("Counterparty"),
 							app.Td().Text("Timestamp"),
+							app.Td().Text("Signed By"),
 						),
-						app.Range(t.transactions).Slice(func(i int) app.UI {
+						app.Range(page).Slice(func(i int) app.UI {
 							return app.Tr().Body(
-								app.Td().Text(t.transactions[i].ID),
-								app.Td().Text(t.transactions[i].Type),
-								app.Td().Text("€"+strconv.FormatFloat(float64(float32(t.transactions[i].Amount)/100), 'f', 2, 32)),
-								app.Td().Text(t.transactions[i].Timestamp),
+								app.Td().Text(page[i].ID),
+								app.Td().Text(page[i].Label()),
+								app.Td().Text(formatAmount(page[i].SignedAmount())),
+								app.Td().Text("€"+strconv.FormatFloat(float64(float32(page[i].Balance)/100), 'f', 2, 32)),
+								app.If(page[i].MatchID != "", func() app.UI {
+									return app.Td().Body(
+										app.A().Href("/match/" + page[i].MatchID).Text(page[i].MatchID),
+									)
+								}).ElseIf(page[i].TournamentID != "", func() app.UI {
+									return app.Td().Body(
+										app.A().Href("/tournaments").Text("Tournament"),
+									)
+								}).Else(func() app.UI {
+									return app.Td().Text("-")
+								}),
+								app.Td().Text(page[i].Counterparty),
+								app.Td().Text(page[i].Timestamp),
+								app.If(page[i].Signer == t.myPeerID, func() app.UI {
+									return app.Td().Text("You")
+								}).Else(func() app.UI {
+									return app.Td().Class("signed-by-other").Text("Other player")
+								}),
 							)
 
 						}),
 					),
 				),
+				app.Div().ID("pagination").Body(
+					app.Button().
+						ID("page-prev").
+						Text("Previous").
+						Disabled(t.page == 0).
+						OnClick(t.prevPage),
+					app.Span().Text("Page "+strconv.Itoa(min(t.page+1, max(pages, 1)))+" of "+strconv.Itoa(max(pages, 1))),
+					app.Button().
+						ID("page-next").
+						Text("Next").
+						Disabled(t.page+1 >= pages).
+						OnClick(t.nextPage),
+				),
 			),
 		)
 }
+
+// pageRows returns the rows of the current page.
+func (t *transaction) pageRows(rows []StatementRow) []StatementRow {
+	start := t.page * transactionsPerPage
+	if start >= len(rows) {
+		return nil
+	}
+
+	end := min(start+transactionsPerPage, len(rows))
+
+	return rows[start:end]
+}
+
+func (t *transaction) setFrom(ctx app.Context, e app.Event) {
+	from, err := parseDay(ctx.JSSrc().Get("value").String())
+	if err != nil {
+		ctx.Notifications().New(app.Notification{
+			Title: "Error",
+			Body:  err.Error(),
+		})
+		return
+	}
+
+	t.filter.From = from
+	t.page = 0
+}
+
+func (t *transaction) setTo(ctx app.Context, e app.Event) {
+	to, err := parseDay(ctx.JSSrc().Get("value").String())
+	if err != nil {
+		ctx.Notifications().New(app.Notification{
+			Title: "Error",
+			Body:  err.Error(),
+		})
+		return
+	}
+
+	t.filter.To = to
+	t.page = 0
+}
+
+func (t *transaction) setKind(ctx app.Context, e app.Event) {
+	t.filter.Kind = ctx.JSSrc().Get("value").String()
+	t.page = 0
+}
+
+func (t *transaction) prevPage(ctx app.Context, e app.Event) {
+	if t.page > 0 {
+		t.page--
+	}
+}
+
+func (t *transaction) nextPage(ctx app.Context, e app.Event) {
+	t.page++
+}
+
+// exportCSV downloads the filtered transactions as CSV.
+func (t *transaction) exportCSV(ctx app.Context, e app.Event) {
+	data, err := statementCSV(filterStatement(t.rows, t.filter))
+	if err != nil {
+		ctx.Notifications().New(app.Notification{
+			Title: "Error",
+			Body:  err.Error(),
+		})
+		return
+	}
+
+	download("transactions.csv", "text/csv", data)
+}
+
+// exportJSON downloads the filtered transactions as JSON.
+func (t *transaction) exportJSON(ctx app.Context, e app.Event) {
+	data, err := statementJSON(filterStatement(t.rows, t.filter))
+	if err != nil {
+		ctx.Notifications().New(app.Notification{
+			Title: "Error",
+			Body:  err.Error(),
+		})
+		return
+	}
+
+	download("transactions.json", "application/json", data)
+}
+
+// download makes the browser save data as a file called name.
+func download(name, mimeType string, data []byte) {
+	blob := app.Window().Get("Blob").New([]any{string(data)}, map[string]any{
+		"type": mimeType,
+	})
+
+	url := app.Window().Get("URL").Call("createObjectURL", blob)
+
+	link := app.Window().Get("document").Call("createElement", "a")
+	link.Set("href", url)
+	link.Set("download", name)
+	link.Call("click")
+
+	app.Window().Get("URL").Call("revokeObjectURL", url)
+}
+
+// formatAmount formats cents as euros with the sign of the change.
+func formatAmount(cents int) string {
+	sign := "+"
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+
+	return sign + "€" + strconv.FormatFloat(float64(float32(cents)/100), 'f', 2, 32)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/mar1n3r0/rps/engine"
+)
+
+func TestTransactionLabel(t *testing.T) {
+	tests := []struct {
+		name   string
+		tx     Transaction
+		label  string
+		signed int
+	}{
+		{"a deposit", Transaction{Type: TypeDebit, Kind: KindDeposit, Amount: 500}, "deposit", 500},
+		{"a withdrawal", Transaction{Type: TypeCredit, Kind: KindWithdrawal, Amount: 200}, "withdrawal", -200},
+		{"a stake", Transaction{Type: TypeCredit, Kind: KindStake, Amount: 300}, "stake", -300},
+		{"a prize", Transaction{Type: TypeDebit, Kind: KindPrize, Amount: 900}, "prize", 900},
+		{"a legacy debit", Transaction{Type: TypeDebit, Amount: 100}, "debit", 100},
+		{"a legacy credit", Transaction{Type: TypeCredit, Amount: 100}, "credit", -100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.tx.Label(); got != tt.label {
+				t.Fatalf("label %q, want %q", got, tt.label)
+			}
+
+			if got := tt.tx.SignedAmount(); got != tt.signed {
+				t.Fatalf("signed amount %d, want %d", got, tt.signed)
+			}
+		})
+	}
+}
+
+// kindsOf returns the kinds of the transactions of username on match, in the
+// order they were written.
+func kindsOf(t *testing.T, store DocStore, username, match string) []TransactionKind {
+	t.Helper()
+
+	transactionsJSON, err := store.Query(dbRpsTransaction, "username", username)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var transactions []Transaction
+
+	if err := json.Unmarshal(transactionsJSON, &transactions); err != nil {
+		t.Fatal(err)
+	}
+
+	var kinds []TransactionKind
+
+	for _, r := range newStatement(Posting{}, transactions) {
+		if r.MatchID == match {
+			kinds = append([]TransactionKind{r.Kind}, kinds...)
+		}
+	}
+
+	return kinds
+}
+
+func TestTransactionKinds(t *testing.T) {
+	players := newTestPlayers(t, 1000, "alice", "bob")
+	alice, bob := players[0], players[1]
+
+	if _, err := moveFunds(alice.store, alice.name, -200); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := kindsOf(t, alice.store, alice.name, ""); !reflect.DeepEqual(got, []TransactionKind{KindDeposit, KindWithdrawal}) {
+		t.Fatalf("wallet transactions %v", got)
+	}
+
+	// a declined match refunds the host's stake
+	declined := openedMatch(t, alice, bob, "bbbbbbbb-bbbb-bbbb-bbbb-bbbbbbbbbbb1", 100)
+
+	if _, err := declineMatch(bob.store, declined, bob.name); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := kindsOf(t, alice.store, alice.name, declined.ID); !reflect.DeepEqual(got, []TransactionKind{KindStake, KindRefund}) {
+		t.Fatalf("declined match transactions %v", got)
+	}
+
+	// a played match pays the pot to the winner
+	m := openedMatch(t, alice, bob, "bbbbbbbb-bbbb-bbbb-bbbb-bbbbbbbbbbb2", 100)
+
+	played, stakes, err := engine.Play(classicRules(t), m, engine.Selection{Username: bob.name, ItemName: "scissors", Bet: 100}, testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := settleMatch(bob.store, bob.name, played, stakes); err != nil {
+		t.Fatal(err)
+	}
+
+	played, err = getMatch(alice.store, m.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := revealMatch(alice.store, classicRules(t), played, commitSecret{Item: "rock", Salt: "salt"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for username, want := range map[string][]TransactionKind{
+		alice.name: {KindStake, KindPayout},
+		bob.name:   {KindStake},
+	} {
+		if got := kindsOf(t, alice.store, username, m.ID); !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s has transactions %v on the match, want %v", username, got, want)
+		}
+	}
+}
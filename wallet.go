@@ -4,11 +4,8 @@ import (
 	"encoding/json"
 	"strconv"
 	"strings"
-	"time"
 
-	"github.com/google/uuid"
 	"github.com/maxence-charriere/go-app/v10/pkg/app"
-	shell "github.com/stateless-minds/go-ipfs-api"
 )
 
 const (
@@ -19,18 +16,23 @@ const (
 // embedding app.Compo into a struct.
 type wallet struct {
 	app.Compo
-	sh              *shell.Shell
+	store           DocStore
 	myPeerID        string
 	playerName      string
 	debitAmount     float32
 	creditAmount    float32
 	transactionType TransactionType
-	balance         int // cents
+	balance         int  // cents
+	escrow          int  // cents held in the escrow of pending matches
+	signedByOther   bool // last change signed by another peer, e.g. a payout
+	ledger          LedgerCheck
 }
 
 type Balance struct {
-	ID     string `mapstructure:"_id" json:"_id" validate:"uuid_rfc4122"`       // ID
-	Amount int    `mapstructure:"amount" json:"amount" validate:"uuid_rfc4122"` // Amount
+	ID      string `mapstructure:"_id" json:"_id" validate:"uuid_rfc4122"`                 // ID
+	Amount  int    `mapstructure:"amount" json:"amount" validate:"uuid_rfc4122"`           // Amount
+	Signer  string `mapstructure:"signer" json:"signer,omitempty" validate:"uuid_rfc4122"` // Peer that signed the last change
+	Version int    `mapstructure:"version" json:"version" validate:"uuid_rfc4122"`         // Incremented on every write
 }
 
 func (w *wallet) OnMount(ctx app.Context) {
@@ -41,16 +43,15 @@ func (w *wallet) OnMount(ctx app.Context) {
 		return
 	}
 
-	sh := shell.NewShell("localhost:5001")
-	w.sh = sh
+	w.store = newDocStore()
 
-	myPeer, err := w.sh.ID()
+	myPeerID, err := w.store.PeerID()
 	if err != nil {
 		ctx.Navigate("/")
 		return
 	}
 
-	w.myPeerID = myPeer.ID
+	w.myPeerID = myPeerID
 
 	ctx.GetState("playerName", &w.playerName)
 
@@ -71,7 +72,17 @@ func (w *wallet) OnNav(ctx app.Context) {
 
 func (w *wallet) getBalance(ctx app.Context) {
 	ctx.Async(func() {
-		accountJSON, err := w.sh.OrbitDocsGet(dbRpsWallet, w.playerName)
+		// wallets from before the ledger are put on it on the first visit
+		err := openLedger(w.store, w.playerName)
+		if err != nil {
+			ctx.Notifications().New(app.Notification{
+				Title: "Error",
+				Body:  err.Error(),
+			})
+			return
+		}
+
+		accountJSON, err := w.store.Get(dbRpsWallet, w.playerName)
 		if err != nil {
 			ctx.Notifications().New(app.Notification{
 				Title: "Error",
@@ -92,9 +103,22 @@ func (w *wallet) getBalance(ctx app.Context) {
 				return
 			}
 
+			escrow, err := inEscrow(w.store, w.playerName)
+			if err != nil {
+				ctx.Notifications().New(app.Notification{
+					Title: "Error",
+					Body:  err.Error(),
+				})
+				return
+			}
+
 			ctx.Dispatch(func(ctx app.Context) {
 				w.balance = balances[0].Amount
+				w.escrow = escrow
+				w.signedByOther = balances[0].Signer != w.myPeerID
 			})
+
+			w.checkLedger(ctx)
 		} else {
 			w.createWallet(ctx)
 		}
@@ -117,7 +141,7 @@ func (w *wallet) createWallet(ctx app.Context) {
 	}
 
 	ctx.Async(func() {
-		err = w.sh.OrbitDocsPut(dbRpsWallet, walletJSON)
+		err = w.store.Put(dbRpsWallet, walletJSON)
 		if err != nil {
 			ctx.Notifications().New(app.Notification{
 				Title: "Error",
@@ -147,8 +171,16 @@ func (w *wallet) Render() app.UI {
 						Body(
 							app.H2().Text("Wallet"),
 							app.Div().Class("balance-container").Body(
-								app.P().Text("Balance: "),
+								app.P().Text("Available: "),
 								app.Span().ID("balance-amount").Text("€"+strconv.FormatFloat(float64(float32(w.balance)/100), 'f', 2, 32)),
+								app.P().Text("In escrow: "),
+								app.Span().ID("escrow-amount").Text("€"+strconv.FormatFloat(float64(float32(w.escrow)/100), 'f', 2, 32)),
+								app.If(w.ledger.Opened && !w.ledger.Balanced(), func() app.UI {
+									return app.Span().Class("signed-by-other").Text("Balance differs from the ledger, which holds €" + strconv.FormatFloat(float64(float32(w.ledger.Ledger)/100), 'f', 2, 32))
+								}),
+								app.If(w.signedByOther, func() app.UI {
+									return app.Span().Class("signed-by-other").Text("Last change signed by another player")
+								}),
 							),
 							app.Div().Class("tabs").Body(
 								app.Button().ID("deposit-tablink").Class("tablink active").Text("Deposit").OnClick(w.openDepositTab),
@@ -216,29 +248,12 @@ func (w *wallet) doAction(ctx app.Context, e app.Event) {
 }
 
 func (w *wallet) updateBalance(ctx app.Context, amount int) {
-	var newBalance int
-	if w.transactionType == TypeDebit {
-		newBalance = w.balance + amount
-	} else {
-		newBalance = w.balance - amount
-	}
-
-	balance := Balance{
-		ID:     w.playerName,
-		Amount: newBalance,
-	}
-
-	ballanceJSON, err := json.Marshal(balance)
-	if err != nil {
-		ctx.Notifications().New(app.Notification{
-			Title: "Error",
-			Body:  err.Error(),
-		})
-		return
+	if w.transactionType == TypeCredit {
+		amount = -amount
 	}
 
 	ctx.Async(func() {
-		err = w.sh.OrbitDocsPut(dbRpsWallet, ballanceJSON)
+		newBalance, err := moveFunds(w.store, w.playerName, amount)
 		if err != nil {
 			ctx.Notifications().New(app.Notification{
 				Title: "Error",
@@ -249,6 +264,7 @@ func (w *wallet) updateBalance(ctx app.Context, amount int) {
 
 		ctx.Dispatch(func(ctx app.Context) {
 			w.balance = newBalance
+			w.signedByOther = false
 
 			if w.transactionType == TypeDebit {
 				ctx.Notifications().New(app.Notification{
@@ -261,23 +277,16 @@ func (w *wallet) updateBalance(ctx app.Context, amount int) {
 					Body:  "You have withdrawn €" + strconv.FormatFloat(float64(w.creditAmount), 'f', 2, 32),
 				})
 			}
-
-			w.storeTransaction(ctx, amount)
-
 		})
+
+		w.checkLedger(ctx)
 	})
 }
 
-func (w *wallet) storeTransaction(ctx app.Context, amount int) {
-	transaction := Transaction{
-		ID:        uuid.NewString(),
-		Username:  w.playerName,
-		Type:      TransactionType(w.transactionType),
-		Amount:    amount,
-		Timestamp: time.Now(),
-	}
-
-	transactionJSON, err := json.Marshal(transaction)
+// checkLedger verifies the balance against the ledger. It is called from
+// async functions.
+func (w *wallet) checkLedger(ctx app.Context) {
+	check, err := verifyLedger(w.store, w.playerName)
 	if err != nil {
 		ctx.Notifications().New(app.Notification{
 			Title: "Error",
@@ -286,15 +295,8 @@ func (w *wallet) storeTransaction(ctx app.Context, amount int) {
 		return
 	}
 
-	ctx.Async(func() {
-		err = w.sh.OrbitDocsPut(dbRpsTransaction, transactionJSON)
-		if err != nil {
-			ctx.Notifications().New(app.Notification{
-				Title: "Error",
-				Body:  err.Error(),
-			})
-			return
-		}
+	ctx.Dispatch(func(ctx app.Context) {
+		w.ledger = check
 	})
 }
 